@@ -0,0 +1,190 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+var (
+	_ TTLCache = (*CodecCache)(nil)
+	_ Cache    = (*ByteCache)(nil)
+)
+
+// CodecCache is a TTLCache storing the values encoded by a Codec in a Cache, so the TTLCache wrappers can be used
+// with a Cache. The keys are converted to strings like RedisSimpleCache does.
+type CodecCache struct {
+	cache Cache
+	codec Codec
+}
+
+// NewCodecCache creates a CodecCache over cache, json is used when codec is nil.
+func NewCodecCache(cache Cache, codec Codec) *CodecCache {
+	if codec == nil {
+		codec = &JsonCodec{}
+	}
+	return &CodecCache{
+		cache: cache,
+		codec: codec,
+	}
+}
+
+func (c *CodecCache) Set(ctx context.Context, key any, value any) (err error) {
+	k, data, err := c.encode(key, value)
+	if err != nil {
+		return err
+	}
+	return c.cache.Set(ctx, k, data)
+}
+
+// SetWithTTL sets the key value with ttl when the cache is an ExpiringCache, otherwise with the cache default ttl.
+func (c *CodecCache) SetWithTTL(ctx context.Context, key any, value any, ttl time.Duration) (err error) {
+	expiring, ok := c.cache.(ExpiringCache)
+	if !ok {
+		return c.Set(ctx, key, value)
+	}
+	k, data, err := c.encode(key, value)
+	if err != nil {
+		return err
+	}
+	return expiring.SetWithTTL(ctx, k, data, ttl)
+}
+
+func (c *CodecCache) Get(ctx context.Context, key any, value any) (err error) {
+	k, err := keyToString(key)
+	if err != nil {
+		return err
+	}
+	data, err := c.cache.Get(ctx, k)
+	if err != nil {
+		return err
+	}
+	if err = c.codec.Decode(data, value); err != nil {
+		return &codecError{sentinel: ErrDecode, err: err}
+	}
+	return nil
+}
+
+func (c *CodecCache) Del(ctx context.Context, keys ...any) (err error) {
+	ks, err := keysToString(keys...)
+	if err != nil {
+		return err
+	}
+	for _, k := range ks {
+		if err = c.cache.Del(ctx, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Clear deletes every key with DelPattern when the cache is a PatternDeleter, otherwise it returns ErrNotSupported.
+func (c *CodecCache) Clear(ctx context.Context) (err error) {
+	deleter, ok := c.cache.(PatternDeleter)
+	if !ok {
+		return fmt.Errorf("%w: clearing %T", ErrNotSupported, c.cache)
+	}
+	_, err = deleter.DelPattern(ctx, "*")
+	return err
+}
+
+func (c *CodecCache) IsRunning(ctx context.Context) bool {
+	return c.cache.IsRunning(ctx)
+}
+
+func (c *CodecCache) Close() error {
+	return c.cache.Close()
+}
+
+func (c *CodecCache) encode(key any, value any) (string, []byte, error) {
+	k, err := keyToString(key)
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := c.codec.Encode(value)
+	if err != nil {
+		return "", nil, &codecError{sentinel: ErrEncode, err: err}
+	}
+	return k, data, nil
+}
+
+// ByteCache is a Cache storing the byte values in a TTLCache, so the Cache wrappers can be used with a TTLCache.
+// The TTLCache must accept string keys and []byte values, like TypedLibCache[string, []byte] or RedisSimpleCache.
+type ByteCache struct {
+	cache TTLCache
+}
+
+// NewByteCache creates a ByteCache over cache.
+func NewByteCache(cache TTLCache) *ByteCache {
+	return &ByteCache{
+		cache: cache,
+	}
+}
+
+func (c *ByteCache) Set(ctx context.Context, key string, value []byte) error {
+	return c.cache.Set(ctx, key, value)
+}
+
+func (c *ByteCache) Get(ctx context.Context, key string) (value []byte, err error) {
+	if err = c.cache.Get(ctx, key, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (c *ByteCache) Del(ctx context.Context, key string) error {
+	return c.cache.Del(ctx, key)
+}
+
+func (c *ByteCache) BatchGet(ctx context.Context, keys ...string) (result [][]byte, err error) {
+	result = make([][]byte, 0, len(keys))
+	for _, k := range keys {
+		value, err := c.Get(ctx, k)
+		if err != nil && err != ErrCacheMiss {
+			return nil, err
+		}
+		// value nil should also append to maintain order
+		result = append(result, value)
+	}
+	return result, nil
+}
+
+func (c *ByteCache) BatchSet(ctx context.Context, keyvalues ...interface{}) error {
+	if len(keyvalues)%2 != 0 {
+		return oddKeyValues(len(keyvalues))
+	}
+
+	for i := 0; i < len(keyvalues); i += 2 {
+		if _, ok := keyvalues[i].(string); !ok {
+			return fmt.Errorf("%w at index %d: expected string, got %T", ErrInvalidKey, i, keyvalues[i])
+		}
+
+		if _, ok := keyvalues[i+1].([]byte); !ok {
+			return fmt.Errorf("%w at index %d: expected []byte, got %T", ErrInvalidValue, i+1, keyvalues[i+1])
+		}
+	}
+
+	for i := 0; i < len(keyvalues); i += 2 {
+		if err := c.cache.Set(ctx, keyvalues[i], keyvalues[i+1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsRunning reports whether the TTLCache is running when it can tell, true otherwise.
+func (c *ByteCache) IsRunning(ctx context.Context) bool {
+	if health, ok := c.cache.(healthChecker); ok {
+		return health.IsRunning(ctx)
+	}
+	return true
+}
+
+// Close closes the TTLCache when it can be closed.
+func (c *ByteCache) Close() error {
+	if closer, ok := c.cache.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shaj13/libcache"
+	_ "github.com/shaj13/libcache/lru"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// plainCache hides the optional interfaces of a Cache.
+type plainCache struct {
+	Cache
+}
+
+func TestCodecCache(t *testing.T) {
+	ctx := context.Background()
+
+	type valueStruct struct {
+		Value string
+	}
+
+	byteCache, err := NewLibcache(10, time.Minute)
+	require.NoError(t, err)
+	cache := NewCodecCache(byteCache, nil)
+	defer cache.Close()
+
+	t.Run("Set and Get", func(t *testing.T) {
+		require.NoError(t, cache.Set(ctx, "key1", valueStruct{Value: "value1"}))
+		value, err := Get[valueStruct](ctx, cache, "key1")
+		require.NoError(t, err)
+		assert.Equal(t, valueStruct{Value: "value1"}, value)
+
+		data, err := byteCache.Get(ctx, "key1")
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"Value":"value1"}`, string(data))
+	})
+
+	t.Run("keys are strings", func(t *testing.T) {
+		require.NoError(t, cache.Set(ctx, 42, 1))
+		value, err := Get[int](ctx, cache, "42")
+		require.NoError(t, err)
+		assert.Equal(t, 1, value)
+	})
+
+	t.Run("SetWithTTL", func(t *testing.T) {
+		require.NoError(t, cache.SetWithTTL(ctx, "key2", 2, time.Hour))
+		ttl, err := byteCache.TTL(ctx, "key2")
+		require.NoError(t, err)
+		assert.Greater(t, ttl, time.Minute)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := Get[int](ctx, cache, "missing")
+		assert.Same(t, ErrCacheMiss, err)
+
+		assert.ErrorIs(t, cache.Set(ctx, "key", make(chan int)), ErrEncode)
+
+		require.NoError(t, cache.Set(ctx, "key3", "value3"))
+		_, err = Get[int](ctx, cache, "key3")
+		assert.ErrorIs(t, err, ErrDecode)
+	})
+
+	t.Run("Del and Clear", func(t *testing.T) {
+		require.NoError(t, cache.Set(ctx, "key4", 4))
+		require.NoError(t, cache.Set(ctx, "key5", 5))
+		require.NoError(t, cache.Del(ctx, "key4", "key5"))
+		_, err := Get[int](ctx, cache, "key4")
+		assert.ErrorIs(t, err, ErrCacheMiss)
+
+		require.NoError(t, cache.Clear(ctx))
+		_, err = Get[valueStruct](ctx, cache, "key1")
+		assert.ErrorIs(t, err, ErrCacheMiss)
+	})
+
+	t.Run("plain cache", func(t *testing.T) {
+		plain := NewCodecCache(plainCache{byteCache}, nil)
+		require.NoError(t, plain.SetWithTTL(ctx, "key6", 6, time.Hour))
+		ttl, err := byteCache.TTL(ctx, "key6")
+		require.NoError(t, err)
+		assert.LessOrEqual(t, ttl, time.Minute, "the cache default ttl is used")
+
+		assert.ErrorIs(t, plain.Clear(ctx), ErrNotSupported)
+	})
+}
+
+func TestByteCache(t *testing.T) {
+	ctx := context.Background()
+
+	cache := NewByteCache(NewTypedLibCache[string, []byte](libcache.LRU.New(10), time.Minute))
+	defer cache.Close()
+	assert.True(t, cache.IsRunning(ctx))
+
+	require.NoError(t, cache.Set(ctx, "key1", []byte("value1")))
+	require.NoError(t, cache.BatchSet(ctx, "key2", []byte("value2"), "key3", []byte("value3")))
+	assert.ErrorIs(t, cache.BatchSet(ctx, "key4"), ErrOddKeyValues)
+	assert.ErrorIs(t, cache.BatchSet(ctx, 4, []byte("value4")), ErrInvalidKey)
+	assert.ErrorIs(t, cache.BatchSet(ctx, "key4", "value4"), ErrInvalidValue)
+
+	value, err := cache.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value1"), value)
+
+	values, err := cache.BatchGet(ctx, "key3", "missing", "key1")
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("value3"), nil, []byte("value1")}, values)
+
+	require.NoError(t, cache.Del(ctx, "key2"))
+	_, err = cache.Get(ctx, "key2")
+	assert.Same(t, ErrCacheMiss, err)
+
+	t.Run("wrappers", func(t *testing.T) {
+		// a Cache wrapper over a TTLCache, and a TTLCache wrapper over the result
+		breaker := NewCircuitBreakerByteCache(cache, CircuitBreakerOptions{})
+		typed := NewCodecCache(breaker, nil)
+
+		require.NoError(t, typed.Set(ctx, "key5", 5))
+		got, err := Get[int](ctx, typed, "key5")
+		require.NoError(t, err)
+		assert.Equal(t, 5, got)
+	})
+}
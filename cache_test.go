@@ -39,8 +39,13 @@ func TestBatchSetGet(t *testing.T) {
 
 func TestRedisSet(t *testing.T) {
 	ctx := context.Background()
-	cache, err := NewRedisCache(ctx, "localhost:6379", 5*time.Second)
+	_, server := newRedisClient(t)
+	cache, err := NewRedisCache(ctx, server.Addr, 5*time.Second)
 	assert.Nil(t, err)
+	// NewRedisCache can't select the database of the test, the key is removed from the default one
+	t.Cleanup(func() {
+		_ = cache.Del(ctx, "hello")
+	})
 
 	cache.SetCtx(ctx, "hello", []byte("word"))
 	v, err := cache.GetCtx(ctx, "hello")
@@ -58,3 +63,53 @@ func TestRedisSet(t *testing.T) {
 		require.ErrorIs(t, cache.BatchSetCtx(ctx, "hello", false), ErrInvalidValue)
 	})
 }
+
+func TestMemLibCacheJanitor(t *testing.T) {
+	expired := make(chan any, 1)
+	cache, err := NewLibcache(0, 10*time.Millisecond, WithJanitor(5*time.Millisecond), WithExpiryCallback(func(key, value any) {
+		expired <- value
+	}))
+	require.NoError(t, err)
+	defer cache.Close()
+
+	ctx := context.Background()
+	require.NoError(t, cache.Set(ctx, "key1", []byte("hello1")))
+
+	select {
+	case value := <-expired:
+		assert.Equal(t, []byte("hello1"), value)
+	case <-time.After(time.Second):
+		t.Fatal("expiry callback not called")
+	}
+}
+
+func TestMemLibCacheMaxBytes(t *testing.T) {
+	ctx := context.Background()
+	cache, err := NewLibcache(0, time.Minute, WithMaxBytes(10))
+	require.NoError(t, err)
+	defer cache.Close()
+
+	require.NoError(t, cache.Set(ctx, "key1", []byte("1234")))
+	require.NoError(t, cache.Set(ctx, "key2", []byte("1234")))
+	// overwriting a key accounts the new size only
+	require.NoError(t, cache.Set(ctx, "key2", []byte("12345")))
+	_, err = cache.Get(ctx, "key1")
+	require.NoError(t, err)
+
+	// 4 + 5 + 4 > 10, key2 is the least recently used
+	require.NoError(t, cache.Set(ctx, "key3", []byte("1234")))
+	_, err = cache.Get(ctx, "key2")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+	values, err := cache.BatchGet(ctx, "key1", "key3")
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("1234"), []byte("1234")}, values)
+
+	// a value bigger than the whole cache is rejected
+	require.ErrorIs(t, cache.Set(ctx, "key4", make([]byte, 11)), ErrInvalidValue)
+
+	// a big value evicts as many entries as needed
+	require.NoError(t, cache.Set(ctx, "key5", make([]byte, 10)))
+	values, err = cache.BatchGet(ctx, "key1", "key3", "key5")
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{nil, nil, make([]byte, 10)}, values)
+}
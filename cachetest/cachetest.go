@@ -0,0 +1,368 @@
+// Package cachetest provides the conformance suites of the cache.Cache and cache.TTLCache implementations,
+// so every backend and wrapper can be checked against the same expectations.
+package cachetest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	cache "github.com/InjectiveLabs/injective-cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	defaultTTL         = 50 * time.Millisecond
+	defaultConcurrency = 8
+)
+
+// Option configures a conformance suite.
+type Option func(*options)
+
+type options struct {
+	ttl         time.Duration
+	sleep       func(d time.Duration)
+	invalidKey  any
+	concurrency int
+	// deferredValidation is set when the values are validated after Set returned
+	deferredValidation bool
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		ttl:         defaultTTL,
+		sleep:       time.Sleep,
+		concurrency: defaultConcurrency,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithTTL sets the ttl of the entries of the expiry tests, 50ms by default.
+func WithTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+// WithSleep sets how the expiry tests let time elapse for the cache, time.Sleep by default.
+// A fake redis server fast forwards its clock instead.
+func WithSleep(sleep func(d time.Duration)) Option {
+	return func(o *options) {
+		o.sleep = sleep
+	}
+}
+
+// WithInvalidKey sets a key the cache rejects with cache.ErrInvalidKey, the invalid key tests are skipped without it.
+func WithInvalidKey(key any) Option {
+	return func(o *options) {
+		o.invalidKey = key
+	}
+}
+
+// WithDeferredValidation tells that the cache validates the values once Set returned, like WriteBehind when
+// it applies the writes to the cache it wraps. The invalid value tests then only read a value into a wrong destination.
+func WithDeferredValidation() Option {
+	return func(o *options) {
+		o.deferredValidation = true
+	}
+}
+
+// WithConcurrency sets the number of goroutines of the concurrency tests, 8 by default.
+func WithConcurrency(n int) Option {
+	return func(o *options) {
+		o.concurrency = n
+	}
+}
+
+// TTLCacheFactory creates an empty TTLCache accepting string keys and string values, whose default ttl outlasts
+// the test. It's called once per test, the cache is closed at the end of the test when it's an io.Closer.
+type TTLCacheFactory func(t *testing.T) cache.TTLCache
+
+// RunTTLCacheSuite runs the conformance suite of the TTLCache implementations.
+func RunTTLCacheSuite(t *testing.T, factory TTLCacheFactory, opts ...Option) {
+	o := newOptions(opts)
+	ctx := context.Background()
+
+	newCache := func(t *testing.T) cache.TTLCache {
+		c := factory(t)
+		if closer, ok := c.(io.Closer); ok {
+			t.Cleanup(func() {
+				_ = closer.Close()
+			})
+		}
+		return c
+	}
+
+	t.Run("miss", func(t *testing.T) {
+		c := newCache(t)
+		_, err := cache.Get[string](ctx, c, "missing")
+		assert.ErrorIs(t, err, cache.ErrCacheMiss)
+	})
+
+	t.Run("set and get", func(t *testing.T) {
+		c := newCache(t)
+		require.NoError(t, c.Set(ctx, "key", "value1"))
+		value, err := cache.Get[string](ctx, c, "key")
+		require.NoError(t, err)
+		assert.Equal(t, "value1", value)
+
+		require.NoError(t, c.Set(ctx, "key", "value2"), "a key can be set again")
+		value, err = cache.Get[string](ctx, c, "key")
+		require.NoError(t, err)
+		assert.Equal(t, "value2", value)
+	})
+
+	t.Run("del", func(t *testing.T) {
+		c := newCache(t)
+		for i := 1; i <= 3; i++ {
+			require.NoError(t, c.Set(ctx, fmt.Sprintf("key%d", i), "value"))
+		}
+
+		require.NoError(t, c.Del(ctx, "key1"))
+		require.NoError(t, c.Del(ctx, "key2", "key3", "missing"), "deleting a missing key isn't an error")
+		for i := 1; i <= 3; i++ {
+			_, err := cache.Get[string](ctx, c, fmt.Sprintf("key%d", i))
+			assert.ErrorIs(t, err, cache.ErrCacheMiss)
+		}
+	})
+
+	t.Run("ttl expiry", func(t *testing.T) {
+		c := newCache(t)
+		require.NoError(t, c.SetWithTTL(ctx, "expiring", "value", o.ttl))
+		require.NoError(t, c.SetWithTTL(ctx, "persistent", "value", 0))
+		_, err := cache.Get[string](ctx, c, "expiring")
+		require.NoError(t, err, "the entry is there until its ttl elapses")
+
+		o.sleep(2 * o.ttl)
+		_, err = cache.Get[string](ctx, c, "expiring")
+		assert.ErrorIs(t, err, cache.ErrCacheMiss)
+		_, err = cache.Get[string](ctx, c, "persistent")
+		assert.NoError(t, err, "a ttl of 0 means no expiration")
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		if o.invalidKey == nil {
+			t.Skip("the cache accepts any key")
+		}
+		c := newCache(t)
+		assert.ErrorIs(t, c.Set(ctx, o.invalidKey, "value"), cache.ErrInvalidKey)
+		assert.ErrorIs(t, c.SetWithTTL(ctx, o.invalidKey, "value", time.Minute), cache.ErrInvalidKey)
+		assert.ErrorIs(t, c.Get(ctx, o.invalidKey, new(string)), cache.ErrInvalidKey)
+		assert.ErrorIs(t, c.Del(ctx, o.invalidKey), cache.ErrInvalidKey)
+	})
+
+	t.Run("invalid value", func(t *testing.T) {
+		c := newCache(t)
+		if !o.deferredValidation {
+			assert.ErrorIs(t, c.Set(ctx, "key", make(chan int)), cache.ErrInvalidValue)
+			assert.ErrorIs(t, c.SetWithTTL(ctx, "key", make(chan int), time.Minute), cache.ErrInvalidValue)
+			_, err := cache.Get[string](ctx, c, "key")
+			assert.ErrorIs(t, err, cache.ErrCacheMiss, "an invalid value isn't stored")
+		}
+
+		require.NoError(t, c.Set(ctx, "key", "value"))
+		err := c.Get(ctx, "key", new(chan int))
+		assert.Error(t, err, "the value doesn't fit the destination")
+		assert.NotErrorIs(t, err, cache.ErrCacheMiss)
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		c := newCache(t)
+		for i := 0; i < 10; i++ {
+			require.NoError(t, c.Set(ctx, fmt.Sprintf("key%d", i), "value"))
+		}
+
+		require.NoError(t, c.Clear(ctx))
+		for i := 0; i < 10; i++ {
+			_, err := cache.Get[string](ctx, c, fmt.Sprintf("key%d", i))
+			assert.ErrorIs(t, err, cache.ErrCacheMiss)
+		}
+
+		require.NoError(t, c.Set(ctx, "key", "value"), "the cache is usable after Clear")
+		value, err := cache.Get[string](ctx, c, "key")
+		require.NoError(t, err)
+		assert.Equal(t, "value", value)
+	})
+
+	t.Run("concurrency", func(t *testing.T) {
+		c := newCache(t)
+		run(t, o.concurrency, func(worker, i int) error {
+			own := fmt.Sprintf("worker%d:key%d", worker, i)
+			value := fmt.Sprintf("value%d", i)
+			if err := c.Set(ctx, own, value); err != nil {
+				return err
+			}
+			got, err := cache.Get[string](ctx, c, own)
+			if err != nil {
+				return err
+			}
+			if got != value {
+				return fmt.Errorf("got %q for %s, want %q", got, own, value)
+			}
+
+			// the shared key is set and deleted by everyone, any of the values or a miss can be read
+			if err = c.Set(ctx, "shared", value); err != nil {
+				return err
+			}
+			if _, err = cache.Get[string](ctx, c, "shared"); err != nil && err != cache.ErrCacheMiss {
+				return err
+			}
+			return c.Del(ctx, "shared")
+		})
+	})
+}
+
+// CacheFactory creates an empty Cache, whose default ttl outlasts the test.
+// It's called once per test, the cache is closed at the end of the test.
+type CacheFactory func(t *testing.T) cache.Cache
+
+// RunCacheSuite runs the conformance suite of the Cache implementations,
+// the expiry tests are run when the cache is a cache.ExpiringCache.
+func RunCacheSuite(t *testing.T, factory CacheFactory, opts ...Option) {
+	o := newOptions(opts)
+	ctx := context.Background()
+
+	newCache := func(t *testing.T) cache.Cache {
+		c := factory(t)
+		t.Cleanup(func() {
+			_ = c.Close()
+		})
+		return c
+	}
+
+	t.Run("running", func(t *testing.T) {
+		c := newCache(t)
+		assert.True(t, c.IsRunning(ctx))
+	})
+
+	t.Run("miss", func(t *testing.T) {
+		c := newCache(t)
+		_, err := c.Get(ctx, "missing")
+		assert.ErrorIs(t, err, cache.ErrCacheMiss)
+	})
+
+	t.Run("set and get", func(t *testing.T) {
+		c := newCache(t)
+		require.NoError(t, c.Set(ctx, "key", []byte("value1")))
+		value, err := c.Get(ctx, "key")
+		require.NoError(t, err)
+		assert.Equal(t, []byte("value1"), value)
+
+		require.NoError(t, c.Set(ctx, "key", []byte("value2")), "a key can be set again")
+		value, err = c.Get(ctx, "key")
+		require.NoError(t, err)
+		assert.Equal(t, []byte("value2"), value)
+	})
+
+	t.Run("del", func(t *testing.T) {
+		c := newCache(t)
+		require.NoError(t, c.Set(ctx, "key", []byte("value")))
+		require.NoError(t, c.Del(ctx, "key"))
+		_, err := c.Get(ctx, "key")
+		assert.ErrorIs(t, err, cache.ErrCacheMiss)
+		assert.NoError(t, c.Del(ctx, "missing"), "deleting a missing key isn't an error")
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		c := newCache(t)
+		require.NoError(t, c.BatchSet(ctx, "key1", []byte("value1"), "key2", []byte("value2"), "key3", []byte("value3")))
+
+		values, err := c.BatchGet(ctx, "key3", "missing", "key1", "key3")
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{[]byte("value3"), nil, []byte("value1"), []byte("value3")}, values,
+			"the values follow the keys order, with nil for the misses")
+
+		values, err = c.BatchGet(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, values)
+	})
+
+	t.Run("invalid batch", func(t *testing.T) {
+		c := newCache(t)
+		assert.ErrorIs(t, c.BatchSet(ctx, "key1", []byte("value1"), "key2"), cache.ErrOddKeyValues)
+		assert.ErrorIs(t, c.BatchSet(ctx, 1, []byte("value1")), cache.ErrInvalidKey)
+		assert.ErrorIs(t, c.BatchSet(ctx, "key1", "value1"), cache.ErrInvalidValue)
+	})
+
+	t.Run("ttl expiry", func(t *testing.T) {
+		c := newCache(t)
+		expiring, ok := c.(cache.ExpiringCache)
+		if !ok {
+			t.Skip("the cache isn't an ExpiringCache")
+		}
+
+		require.NoError(t, expiring.SetWithTTL(ctx, "expiring", []byte("value"), o.ttl))
+		require.NoError(t, expiring.SetWithTTL(ctx, "persistent", []byte("value"), 0))
+		require.NoError(t, expiring.BatchSetWithTTL(ctx, cache.BatchItem{Key: "batch", Value: []byte("value"), TTL: o.ttl}))
+
+		ttl, err := expiring.TTL(ctx, "expiring")
+		require.NoError(t, err)
+		assert.True(t, ttl > 0 && ttl <= o.ttl, "ttl %s", ttl)
+		ttl, err = expiring.TTL(ctx, "persistent")
+		require.NoError(t, err)
+		assert.Equal(t, cache.NoTTL, ttl)
+		_, err = expiring.TTL(ctx, "missing")
+		assert.ErrorIs(t, err, cache.ErrCacheMiss)
+
+		o.sleep(2 * o.ttl)
+		for _, key := range []string{"expiring", "batch"} {
+			_, err = c.Get(ctx, key)
+			assert.ErrorIs(t, err, cache.ErrCacheMiss, key)
+		}
+		_, err = c.Get(ctx, "persistent")
+		assert.NoError(t, err, "a ttl of 0 means no expiration")
+		assert.ErrorIs(t, expiring.Touch(ctx, "expiring", time.Minute), cache.ErrCacheMiss)
+	})
+
+	t.Run("concurrency", func(t *testing.T) {
+		c := newCache(t)
+		run(t, o.concurrency, func(worker, i int) error {
+			own := fmt.Sprintf("worker%d:key%d", worker, i)
+			value := []byte(fmt.Sprintf("value%d", i))
+			if err := c.BatchSet(ctx, own, value, "shared", value); err != nil {
+				return err
+			}
+			values, err := c.BatchGet(ctx, own, "shared")
+			if err != nil {
+				return err
+			}
+			if len(values) != 2 || string(values[0]) != string(value) {
+				return fmt.Errorf("got %q for %s, want %q", values, own, value)
+			}
+			if _, err = c.Get(ctx, "shared"); err != nil && err != cache.ErrCacheMiss {
+				return err
+			}
+			return c.Del(ctx, "shared")
+		})
+	})
+}
+
+// run calls fn concurrently from n workers, 100 times each, and fails t with the errors returned.
+func run(t *testing.T, n int, fn func(worker, i int) error) {
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for worker := 0; worker < n; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if err := fn(worker, i); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+}
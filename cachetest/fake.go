@@ -0,0 +1,335 @@
+package cachetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	cache "github.com/InjectiveLabs/injective-cache"
+)
+
+var _ cache.TTLCache = (*FakeTTLCache)(nil)
+
+// Call is a call to a FakeTTLCache.
+type Call struct {
+	// Method is the name of the called method, like "Get" or "SetWithTTL"
+	Method string
+	// Keys are the keys of the call, none for Clear
+	Keys []any
+	// Value is the value set, nil for the other methods
+	Value any
+	// TTL is the ttl of the value set, the default ttl for Set
+	TTL time.Duration
+	// Err is the error returned
+	Err error
+}
+
+// FakeTTLCache is an in-memory TTLCache for the tests of the code using a cache. The keys are converted to strings
+// and the values encoded in json like RedisSimpleCache does, so Set(ctx, 1, v) and Get(ctx, "1", &v) use the same
+// entry. The entries expire following a clock moved forward by Advance. It records the calls, and can fail them,
+// slow them down or force misses.
+type FakeTTLCache struct {
+	ttl   time.Duration
+	codec cache.Codec
+
+	mu      sync.Mutex
+	now     time.Time
+	entries map[string]fakeEntry
+	calls   []Call
+	// failures is the number of the next calls failing with failErr
+	failures int
+	failErr  error
+	latency  time.Duration
+	// misses are the keys read as misses, allMiss makes every read a miss
+	misses  map[string]struct{}
+	allMiss bool
+}
+
+type fakeEntry struct {
+	data []byte
+	// expiresAt is zero for an entry without expiration
+	expiresAt time.Time
+}
+
+// NewFakeTTLCache creates an empty FakeTTLCache whose entries expire after ttl by default, 0 means no expiration.
+// Its clock starts at the current time.
+func NewFakeTTLCache(ttl time.Duration) *FakeTTLCache {
+	return &FakeTTLCache{
+		ttl:     ttl,
+		codec:   &cache.JsonCodec{},
+		now:     time.Now(),
+		entries: make(map[string]fakeEntry),
+		misses:  make(map[string]struct{}),
+	}
+}
+
+func (f *FakeTTLCache) Set(ctx context.Context, key any, value any) (err error) {
+	return f.set(ctx, "Set", key, value, f.ttl)
+}
+
+func (f *FakeTTLCache) SetWithTTL(ctx context.Context, key any, value any, ttl time.Duration) (err error) {
+	return f.set(ctx, "SetWithTTL", key, value, ttl)
+}
+
+func (f *FakeTTLCache) Get(ctx context.Context, key any, value any) (err error) {
+	call := Call{Method: "Get", Keys: []any{key}}
+	defer f.record(&call, &err)
+	if err = f.inject(ctx); err != nil {
+		return err
+	}
+	k, err := fakeKey(key)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	entry, found := f.load(k)
+	_, miss := f.misses[k]
+	miss = miss || f.allMiss
+	f.mu.Unlock()
+	if !found || miss {
+		return cache.ErrCacheMiss
+	}
+	if err = f.codec.Decode(entry.data, value); err != nil {
+		return &codecError{sentinel: cache.ErrDecode, err: err}
+	}
+	return nil
+}
+
+func (f *FakeTTLCache) Del(ctx context.Context, keys ...any) (err error) {
+	// the caller may reuse the slice it passed
+	call := Call{Method: "Del", Keys: append([]any(nil), keys...)}
+	defer f.record(&call, &err)
+	if err = f.inject(ctx); err != nil {
+		return err
+	}
+	ks := make([]string, 0, len(keys))
+	for _, key := range keys {
+		k, err := fakeKey(key)
+		if err != nil {
+			return err
+		}
+		ks = append(ks, k)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, k := range ks {
+		delete(f.entries, k)
+	}
+	return nil
+}
+
+func (f *FakeTTLCache) Clear(ctx context.Context) (err error) {
+	call := Call{Method: "Clear"}
+	defer f.record(&call, &err)
+	if err = f.inject(ctx); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entries = make(map[string]fakeEntry)
+	return nil
+}
+
+// Now returns the time of the cache clock.
+func (f *FakeTTLCache) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Advance moves the cache clock forward by d, expiring the entries whose ttl elapsed.
+func (f *FakeTTLCache) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
+
+// Len returns the number of entries not expired.
+func (f *FakeTTLCache) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for key := range f.entries {
+		if _, found := f.load(key); found {
+			n++
+		}
+	}
+	return n
+}
+
+// Calls returns the calls made to the cache, in order.
+func (f *FakeTTLCache) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// CallsTo returns the calls made to method, in order.
+func (f *FakeTTLCache) CallsTo(method string) []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var calls []Call
+	for _, call := range f.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// ResetCalls forgets the calls made so far.
+func (f *FakeTTLCache) ResetCalls() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = nil
+}
+
+// FailNext makes the next n calls fail with err, cache.ErrCacheUnavailable when err is nil.
+func (f *FakeTTLCache) FailNext(n int, err error) {
+	if err == nil {
+		err = cache.ErrCacheUnavailable
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = n
+	f.failErr = err
+}
+
+// SetLatency makes every call wait d first, a call whose ctx is done meanwhile returns the ctx error.
+func (f *FakeTTLCache) SetLatency(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.latency = d
+}
+
+// ForceMiss makes the reads of keys miss even when they are set, every read misses without keys.
+// The keys are converted like the keys of the other methods, the invalid ones are ignored.
+func (f *FakeTTLCache) ForceMiss(keys ...any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(keys) == 0 {
+		f.allMiss = true
+	}
+	for _, key := range keys {
+		if k, err := fakeKey(key); err == nil {
+			f.misses[k] = struct{}{}
+		}
+	}
+}
+
+// ResetFaults removes the failures, the latency and the forced misses, the entries and the calls are kept.
+func (f *FakeTTLCache) ResetFaults() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = 0
+	f.failErr = nil
+	f.latency = 0
+	f.misses = make(map[string]struct{})
+	f.allMiss = false
+}
+
+func (f *FakeTTLCache) set(ctx context.Context, method string, key any, value any, ttl time.Duration) (err error) {
+	call := Call{Method: method, Keys: []any{key}, Value: value, TTL: ttl}
+	defer f.record(&call, &err)
+	if err = f.inject(ctx); err != nil {
+		return err
+	}
+	k, err := fakeKey(key)
+	if err != nil {
+		return err
+	}
+	data, err := f.codec.Encode(value)
+	if err != nil {
+		return &codecError{sentinel: cache.ErrEncode, err: err}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	entry := fakeEntry{data: data}
+	if ttl > 0 {
+		entry.expiresAt = f.now.Add(ttl)
+	}
+	f.entries[k] = entry
+	return nil
+}
+
+// load returns the entry of key unless it expired, it must be called with the lock held.
+func (f *FakeTTLCache) load(key string) (fakeEntry, bool) {
+	entry, found := f.entries[key]
+	if !found {
+		return fakeEntry{}, false
+	}
+	if !entry.expiresAt.IsZero() && !f.now.Before(entry.expiresAt) {
+		delete(f.entries, key)
+		return fakeEntry{}, false
+	}
+	return entry, true
+}
+
+// inject applies the latency and the failures to a call.
+func (f *FakeTTLCache) inject(ctx context.Context) error {
+	f.mu.Lock()
+	latency := f.latency
+	f.mu.Unlock()
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures > 0 {
+		f.failures--
+		return f.failErr
+	}
+	return nil
+}
+
+func (f *FakeTTLCache) record(call *Call, err *error) {
+	call.Err = *err
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, *call)
+}
+
+// fakeKey converts key to the string its entry is stored under like RedisSimpleCache does: a string is kept,
+// another key is formatted with %v and rejected if that gives an empty string.
+func fakeKey(key any) (string, error) {
+	if s, ok := key.(string); ok {
+		return s, nil
+	}
+	s := fmt.Sprintf("%v", key)
+	if s == "" {
+		return "", fmt.Errorf("%w: %T", cache.ErrInvalidKey, key)
+	}
+	return s, nil
+}
+
+// codecError is the failure of the codec, it matches its sentinel, cache.ErrEncode or cache.ErrDecode,
+// and unwraps to the codec error like the errors of the caches.
+type codecError struct {
+	sentinel error
+	err      error
+}
+
+func (e *codecError) Error() string {
+	return fmt.Sprintf("%v: %v", e.sentinel, e.err)
+}
+
+func (e *codecError) Is(target error) bool {
+	return errors.Is(e.sentinel, target)
+}
+
+func (e *codecError) Unwrap() error {
+	return e.err
+}
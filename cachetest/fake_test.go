@@ -0,0 +1,158 @@
+package cachetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	cache "github.com/InjectiveLabs/injective-cache"
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blankKey is a key formatted as an empty string, which FakeTTLCache rejects like RedisSimpleCache.
+type blankKey string
+
+func TestFakeTTLCache(t *testing.T) {
+	ctx := context.Background()
+
+	var fake *FakeTTLCache
+	RunTTLCacheSuite(t, func(t *testing.T) cache.TTLCache {
+		fake = NewFakeTTLCache(time.Minute)
+		return fake
+	}, WithSleep(func(d time.Duration) {
+		fake.Advance(d)
+	}), WithInvalidKey(blankKey("")))
+
+	t.Run("keys", func(t *testing.T) {
+		c := NewFakeTTLCache(time.Minute)
+		require.NoError(t, c.Set(ctx, 1, "one"))
+		value, err := cache.Get[string](ctx, c, "1")
+		require.NoError(t, err, "the keys are converted to strings like RedisSimpleCache does")
+		assert.Equal(t, "one", value)
+
+		c.ForceMiss(1)
+		assert.ErrorIs(t, c.Get(ctx, "1", new(string)), cache.ErrCacheMiss)
+
+		keys := []any{"1", "2"}
+		require.NoError(t, c.Del(ctx, keys...))
+		keys[0] = "changed"
+		assert.Equal(t, []any{"1", "2"}, c.CallsTo("Del")[0].Keys, "the recorded keys don't alias the caller's")
+	})
+
+	t.Run("codec errors", func(t *testing.T) {
+		c := NewFakeTTLCache(time.Minute)
+		err := c.Set(ctx, "key", make(chan int))
+		assert.ErrorIs(t, err, cache.ErrEncode)
+		var unsupported *json.UnsupportedTypeError
+		assert.ErrorAs(t, err, &unsupported, "the codec error is kept")
+
+		require.NoError(t, c.Set(ctx, "key", "value"))
+		err = c.Get(ctx, "key", new(int))
+		assert.ErrorIs(t, err, cache.ErrDecode)
+		var unmarshal *json.UnmarshalTypeError
+		assert.ErrorAs(t, err, &unmarshal, "the codec error is kept")
+	})
+
+	t.Run("clock", func(t *testing.T) {
+		c := NewFakeTTLCache(time.Minute)
+		start := c.Now()
+		require.NoError(t, c.Set(ctx, "default", 1))
+		require.NoError(t, c.SetWithTTL(ctx, "short", 2, time.Second))
+		assert.Equal(t, 2, c.Len())
+
+		c.Advance(time.Second)
+		assert.Equal(t, start.Add(time.Second), c.Now())
+		_, err := cache.Get[int](ctx, c, "short")
+		assert.ErrorIs(t, err, cache.ErrCacheMiss, "the ttl elapsed")
+		value, err := cache.Get[int](ctx, c, "default")
+		require.NoError(t, err)
+		assert.Equal(t, 1, value)
+
+		c.Advance(time.Minute)
+		assert.Zero(t, c.Len())
+	})
+
+	t.Run("calls", func(t *testing.T) {
+		c := NewFakeTTLCache(time.Minute)
+		require.NoError(t, c.Set(ctx, "key", "value"))
+		require.NoError(t, c.SetWithTTL(ctx, "key", "value", time.Second))
+		_, err := cache.Get[string](ctx, c, "missing")
+		require.ErrorIs(t, err, cache.ErrCacheMiss)
+		require.NoError(t, c.Del(ctx, "key1", "key2"))
+		require.NoError(t, c.Clear(ctx))
+
+		assert.Equal(t, []Call{
+			{Method: "Set", Keys: []any{"key"}, Value: "value", TTL: time.Minute},
+			{Method: "SetWithTTL", Keys: []any{"key"}, Value: "value", TTL: time.Second},
+			{Method: "Get", Keys: []any{"missing"}, Err: cache.ErrCacheMiss},
+			{Method: "Del", Keys: []any{"key1", "key2"}},
+			{Method: "Clear"},
+		}, c.Calls())
+		assert.Len(t, c.CallsTo("Get"), 1)
+
+		c.ResetCalls()
+		assert.Empty(t, c.Calls())
+	})
+
+	t.Run("fail next", func(t *testing.T) {
+		c := NewFakeTTLCache(time.Minute)
+		c.FailNext(2, nil)
+		assert.ErrorIs(t, c.Set(ctx, "key", 1), cache.ErrCacheUnavailable)
+		assert.ErrorIs(t, c.Get(ctx, "key", new(int)), cache.ErrCacheUnavailable)
+		require.NoError(t, c.Set(ctx, "key", 1), "only the next 2 calls fail")
+
+		errDown := errors.New("down")
+		c.FailNext(1, errDown)
+		assert.ErrorIs(t, c.Clear(ctx), errDown)
+		assert.Equal(t, errDown, c.CallsTo("Clear")[0].Err)
+		assert.Equal(t, 1, c.Len(), "a failed call changes nothing")
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		c := NewFakeTTLCache(time.Minute)
+		c.SetLatency(50 * time.Millisecond)
+
+		start := time.Now()
+		require.NoError(t, c.Set(ctx, "key", 1))
+		assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, c.Get(timeoutCtx, "key", new(int)), context.DeadlineExceeded)
+	})
+
+	t.Run("force miss", func(t *testing.T) {
+		c := NewFakeTTLCache(time.Minute)
+		require.NoError(t, c.Set(ctx, "key1", 1))
+		require.NoError(t, c.Set(ctx, "key2", 2))
+
+		c.ForceMiss("key1")
+		assert.ErrorIs(t, c.Get(ctx, "key1", new(int)), cache.ErrCacheMiss)
+		assert.NoError(t, c.Get(ctx, "key2", new(int)))
+
+		c.ForceMiss()
+		assert.ErrorIs(t, c.Get(ctx, "key2", new(int)), cache.ErrCacheMiss)
+
+		c.ResetFaults()
+		assert.NoError(t, c.Get(ctx, "key1", new(int)), "the entries are kept")
+	})
+
+	t.Run("with a wrapper", func(t *testing.T) {
+		c := NewFakeTTLCache(time.Minute)
+		rcc := cache.NewResourceCoalescingCache[string, int](c)
+
+		fetch := func() (int, error) { return 42, nil }
+		value, err := rcc.Get(ctx, "key", fetch)
+		require.NoError(t, err)
+		assert.Equal(t, 42, value)
+		assert.Len(t, c.CallsTo("Set"), 1, "the fetched value is cached")
+
+		c.ForceMiss()
+		_, err = rcc.Get(ctx, "key", fetch)
+		require.NoError(t, err)
+		assert.Len(t, c.CallsTo("Set"), 2, "a miss fetches the value again")
+	})
+}
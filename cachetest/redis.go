@@ -0,0 +1,55 @@
+package cachetest
+
+import (
+	"testing"
+	"time"
+
+	cache "github.com/InjectiveLabs/injective-cache"
+	"github.com/InjectiveLabs/injective-cache/internal/redistest"
+	"github.com/go-redis/redis/v8"
+)
+
+// Redis is an empty redis server for a test: an in-process fake by default, the REDIS_URL server,
+// localhost:6379 by default, when built with the injectivecache_redis tag. The tests on a real server
+// only use its REDIS_TEST_DB database, 15 by default, flushed before every test.
+type Redis struct {
+	// Client is a client of the server, closed at the end of the test
+	Client *redis.Client
+
+	server *redistest.Server
+}
+
+// NewRedis starts the redis server of the test, the fake one is stopped at the end of the test.
+func NewRedis(t testing.TB) *Redis {
+	server := redistest.Start(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr, DB: server.DB})
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return &Redis{
+		Client: client,
+		server: server,
+	}
+}
+
+// Addr returns the address of the server.
+func (r *Redis) Addr() string {
+	return r.server.Addr
+}
+
+// DB returns the database of the test, the other clients of the server must select it.
+func (r *Redis) DB() int {
+	return r.server.DB
+}
+
+// FastForward lets d elapse for the keys ttl: the clock of the fake server moves forward,
+// the test sleeps with a real server. Pass it to WithSleep to run the suites on redis.
+func (r *Redis) FastForward(d time.Duration) {
+	r.server.FastForward(d)
+}
+
+// NewRedisSimpleCache returns a RedisSimpleCache with the json codec on the redis server of the test, see NewRedis.
+func NewRedisSimpleCache(t testing.TB, ttl time.Duration, opts ...cache.Option) (*cache.RedisSimpleCache, *Redis) {
+	r := NewRedis(t)
+	return cache.NewRedisSimpleCache(r.Client, nil, ttl, opts...), r
+}
@@ -0,0 +1,380 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	_ TTLCache = (*CircuitBreaker)(nil)
+	_ Cache    = (*CircuitBreakerByteCache)(nil)
+)
+
+const (
+	defaultCircuitFailureThreshold = 5
+	defaultCircuitOpenTimeout      = 5 * time.Second
+	defaultCircuitHalfOpenProbes   = 1
+)
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets the calls through to the cache
+	CircuitClosed CircuitState = iota
+	// CircuitOpen short-circuits the calls without reaching the cache
+	CircuitOpen
+	// CircuitHalfOpen lets a few probe calls through to find out whether the cache recovered
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerOptions configures a circuit breaker, zero values fall back to the defaults.
+type CircuitBreakerOptions struct {
+	// FailureThreshold is the number of consecutive failures opening the circuit, 5 by default.
+	FailureThreshold int
+	// OpenTimeout is how long the circuit stays open before probing the cache, 5s by default.
+	OpenTimeout time.Duration
+	// HalfOpenProbes is the number of probe calls let through while half-open, and of successes closing the circuit, 1 by default.
+	HalfOpenProbes int
+	// Timeout bounds every call when positive, a call exceeding it counts as a failure.
+	Timeout time.Duration
+	// OpenErr is returned by the short-circuited calls, ErrCacheUnavailable by default.
+	// ErrCacheMiss makes the callers fall back to the source of the values like on a miss.
+	OpenErr error
+	// IsFailure reports whether an error returned by the cache counts as a failure, by default every error
+	// but ErrCacheMiss, ErrInvalidKey, ErrInvalidValue, ErrDecode, ErrOddKeyValues and ErrNotSupported,
+	// which don't tell anything about the cache health.
+	IsFailure func(error) bool
+	// OnStateChange is called on every state change
+	OnStateChange func(from, to CircuitState)
+}
+
+func (o CircuitBreakerOptions) withDefaults() CircuitBreakerOptions {
+	if o.FailureThreshold <= 0 {
+		o.FailureThreshold = defaultCircuitFailureThreshold
+	}
+	if o.OpenTimeout <= 0 {
+		o.OpenTimeout = defaultCircuitOpenTimeout
+	}
+	if o.HalfOpenProbes <= 0 {
+		o.HalfOpenProbes = defaultCircuitHalfOpenProbes
+	}
+	if o.OpenErr == nil {
+		o.OpenErr = ErrCacheUnavailable
+	}
+	if o.IsFailure == nil {
+		o.IsFailure = isCacheFailure
+	}
+	return o
+}
+
+func isCacheFailure(err error) bool {
+	return !errors.Is(err, ErrCacheMiss) && !errors.Is(err, ErrInvalidKey) && !errors.Is(err, ErrInvalidValue) &&
+		!errors.Is(err, ErrDecode) && !errors.Is(err, ErrOddKeyValues) && !errors.Is(err, ErrNotSupported)
+}
+
+// healthChecker is implemented by the caches able to tell whether their backend is reachable.
+type healthChecker interface {
+	IsRunning(ctx context.Context) bool
+}
+
+// circuitBreaker tracks the failures of a cache, the cache specific part is done by the wrappers.
+type circuitBreaker struct {
+	opts   CircuitBreakerOptions
+	health healthChecker
+
+	mu        sync.Mutex
+	state     CircuitState
+	failures  int
+	openedAt  time.Time
+	probes    int
+	successes int
+	// generation changes on every transition, the outcome of a call started before is ignored
+	generation uint64
+}
+
+func newCircuitBreaker(opts CircuitBreakerOptions, health healthChecker) *circuitBreaker {
+	return &circuitBreaker{
+		opts:   opts.withDefaults(),
+		health: health,
+	}
+}
+
+// call runs fn unless the circuit is open, and records its outcome.
+func (b *circuitBreaker) call(ctx context.Context, fn func(ctx context.Context) error) error {
+	generation, probe, allowed := b.allow()
+	if !allowed {
+		return b.opts.OpenErr
+	}
+
+	if b.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.opts.Timeout)
+		defer cancel()
+	}
+
+	// a probe first checks the cache is reachable before sending it the call
+	if probe && b.health != nil && !b.health.IsRunning(ctx) {
+		b.record(generation, probe, ErrCacheUnavailable)
+		return b.opts.OpenErr
+	}
+
+	err := fn(ctx)
+	if err != nil && !b.opts.IsFailure(err) {
+		b.record(generation, probe, nil)
+		return err
+	}
+	if err != nil && ctx.Err() == context.Canceled {
+		// canceled by the caller, it tells nothing about the cache
+		b.release(generation, probe)
+		return err
+	}
+	b.record(generation, probe, err)
+	return err
+}
+
+// allow reports whether a call can go through, and whether it's a probe of a half-open circuit,
+// along with the generation of the state it's started in.
+func (b *circuitBreaker) allow() (generation uint64, probe bool, allowed bool) {
+	b.mu.Lock()
+	var change func()
+	defer func() {
+		b.mu.Unlock()
+		if change != nil {
+			change()
+		}
+	}()
+
+	if b.state == CircuitOpen {
+		if time.Since(b.openedAt) < b.opts.OpenTimeout {
+			return b.generation, false, false
+		}
+		change = b.transition(CircuitHalfOpen)
+	}
+	if b.state == CircuitHalfOpen {
+		if b.probes >= b.opts.HalfOpenProbes {
+			return b.generation, false, false
+		}
+		b.probes++
+		return b.generation, true, true
+	}
+	return b.generation, false, true
+}
+
+// record accounts the outcome of a call started in generation, err is nil on success.
+func (b *circuitBreaker) record(generation uint64, probe bool, err error) {
+	b.mu.Lock()
+	var change func()
+	defer func() {
+		b.mu.Unlock()
+		if change != nil {
+			change()
+		}
+	}()
+
+	if generation != b.generation {
+		// the state changed since the call started, its probe slot was reset along
+		return
+	}
+	if probe {
+		b.probes--
+	}
+	switch {
+	case err == nil && b.state == CircuitClosed:
+		b.failures = 0
+	case err == nil && probe && b.state == CircuitHalfOpen:
+		b.successes++
+		if b.successes >= b.opts.HalfOpenProbes {
+			change = b.transition(CircuitClosed)
+		}
+	case err != nil && b.state == CircuitClosed:
+		b.failures++
+		if b.failures >= b.opts.FailureThreshold {
+			change = b.transition(CircuitOpen)
+		}
+	case err != nil && probe && b.state == CircuitHalfOpen:
+		change = b.transition(CircuitOpen)
+	}
+}
+
+// release frees the probe slot of a call which outcome is ignored.
+func (b *circuitBreaker) release(generation uint64, probe bool) {
+	if !probe {
+		return
+	}
+	b.mu.Lock()
+	if generation == b.generation {
+		b.probes--
+	}
+	b.mu.Unlock()
+}
+
+// transition changes the state, it must be called with the mutex held and returns
+// the notification to send once it's released.
+func (b *circuitBreaker) transition(to CircuitState) func() {
+	from := b.state
+	b.state = to
+	b.generation++
+	b.failures = 0
+	b.successes = 0
+	b.probes = 0
+	if to == CircuitOpen {
+		b.openedAt = time.Now()
+	}
+	if b.opts.OnStateChange == nil {
+		return nil
+	}
+	return func() {
+		b.opts.OnStateChange(from, to)
+	}
+}
+
+func (b *circuitBreaker) currentState() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// CircuitBreaker wraps a TTLCache and stops calling it after consecutive failures, so a slow or unreachable
+// backend doesn't add its timeout to every call. While the circuit is open the calls return OpenErr right away,
+// after OpenTimeout a few probe calls are let through and close the circuit if they succeed.
+// When the cache implements IsRunning, the probes first check it's reachable.
+type CircuitBreaker struct {
+	cache   TTLCache
+	breaker *circuitBreaker
+}
+
+// NewCircuitBreaker creates a new CircuitBreaker wrapping cache.
+func NewCircuitBreaker(cache TTLCache, opts CircuitBreakerOptions) *CircuitBreaker {
+	health, _ := cache.(healthChecker)
+	return &CircuitBreaker{
+		cache:   cache,
+		breaker: newCircuitBreaker(opts, health),
+	}
+}
+
+// State returns the current state of the circuit.
+func (c *CircuitBreaker) State() CircuitState {
+	return c.breaker.currentState()
+}
+
+func (c *CircuitBreaker) Set(ctx context.Context, key any, value any) (err error) {
+	return c.breaker.call(ctx, func(ctx context.Context) error {
+		return c.cache.Set(ctx, key, value)
+	})
+}
+
+func (c *CircuitBreaker) SetWithTTL(ctx context.Context, key any, value any, ttl time.Duration) (err error) {
+	return c.breaker.call(ctx, func(ctx context.Context) error {
+		return c.cache.SetWithTTL(ctx, key, value, ttl)
+	})
+}
+
+func (c *CircuitBreaker) Get(ctx context.Context, key any, value any) (err error) {
+	return c.breaker.call(ctx, func(ctx context.Context) error {
+		return c.cache.Get(ctx, key, value)
+	})
+}
+
+func (c *CircuitBreaker) Del(ctx context.Context, keys ...any) (err error) {
+	return c.breaker.call(ctx, func(ctx context.Context) error {
+		return c.cache.Del(ctx, keys...)
+	})
+}
+
+func (c *CircuitBreaker) Clear(ctx context.Context) (err error) {
+	return c.breaker.call(ctx, func(ctx context.Context) error {
+		return c.cache.Clear(ctx)
+	})
+}
+
+// IsRunning reports false while the circuit is open, otherwise whether the wrapped cache is running if it can tell.
+func (c *CircuitBreaker) IsRunning(ctx context.Context) bool {
+	if c.State() == CircuitOpen {
+		return false
+	}
+	if c.breaker.health == nil {
+		return true
+	}
+	return c.breaker.health.IsRunning(ctx)
+}
+
+// CircuitBreakerByteCache is the CircuitBreaker for a Cache.
+type CircuitBreakerByteCache struct {
+	cache   Cache
+	breaker *circuitBreaker
+}
+
+// NewCircuitBreakerByteCache creates a new CircuitBreakerByteCache wrapping cache.
+func NewCircuitBreakerByteCache(cache Cache, opts CircuitBreakerOptions) *CircuitBreakerByteCache {
+	return &CircuitBreakerByteCache{
+		cache:   cache,
+		breaker: newCircuitBreaker(opts, cache),
+	}
+}
+
+// State returns the current state of the circuit.
+func (c *CircuitBreakerByteCache) State() CircuitState {
+	return c.breaker.currentState()
+}
+
+func (c *CircuitBreakerByteCache) Set(ctx context.Context, key string, value []byte) error {
+	return c.breaker.call(ctx, func(ctx context.Context) error {
+		return c.cache.Set(ctx, key, value)
+	})
+}
+
+func (c *CircuitBreakerByteCache) Get(ctx context.Context, key string) (value []byte, err error) {
+	err = c.breaker.call(ctx, func(ctx context.Context) (err error) {
+		value, err = c.cache.Get(ctx, key)
+		return err
+	})
+	return value, err
+}
+
+func (c *CircuitBreakerByteCache) Del(ctx context.Context, key string) error {
+	return c.breaker.call(ctx, func(ctx context.Context) error {
+		return c.cache.Del(ctx, key)
+	})
+}
+
+func (c *CircuitBreakerByteCache) BatchGet(ctx context.Context, keys ...string) (values [][]byte, err error) {
+	err = c.breaker.call(ctx, func(ctx context.Context) (err error) {
+		values, err = c.cache.BatchGet(ctx, keys...)
+		return err
+	})
+	return values, err
+}
+
+func (c *CircuitBreakerByteCache) BatchSet(ctx context.Context, keyvalues ...interface{}) error {
+	return c.breaker.call(ctx, func(ctx context.Context) error {
+		return c.cache.BatchSet(ctx, keyvalues...)
+	})
+}
+
+// IsRunning reports false while the circuit is open, otherwise whether the wrapped cache is running.
+func (c *CircuitBreakerByteCache) IsRunning(ctx context.Context) bool {
+	if c.State() == CircuitOpen {
+		return false
+	}
+	return c.cache.IsRunning(ctx)
+}
+
+func (c *CircuitBreakerByteCache) Close() error {
+	return c.cache.Close()
+}
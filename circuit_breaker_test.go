@@ -0,0 +1,270 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	errDown := errors.New("connection refused")
+
+	t.Run("opens after consecutive failures", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		cache := NewMockTTLCache(ctrl)
+		cache.EXPECT().Get(gomock.Any(), "key", gomock.Any()).Return(errDown).Times(3)
+
+		var changes []CircuitState
+		cb := NewCircuitBreaker(cache, CircuitBreakerOptions{
+			FailureThreshold: 3,
+			OpenTimeout:      time.Minute,
+			OnStateChange: func(from, to CircuitState) {
+				changes = append(changes, to)
+			},
+		})
+
+		for i := 0; i < 3; i++ {
+			assert.ErrorIs(t, cb.Get(ctx, "key", new(int)), errDown)
+		}
+		assert.Equal(t, CircuitOpen, cb.State())
+		assert.Equal(t, []CircuitState{CircuitOpen}, changes)
+		assert.False(t, cb.IsRunning(ctx))
+
+		// short-circuited without calling the cache
+		assert.ErrorIs(t, cb.Get(ctx, "key", new(int)), ErrCacheUnavailable)
+		assert.ErrorIs(t, cb.Set(ctx, "key", 1), ErrCacheUnavailable)
+	})
+
+	t.Run("misses and successes reset the failures", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		cache := NewMockTTLCache(ctrl)
+		gomock.InOrder(
+			cache.EXPECT().Get(gomock.Any(), "key", gomock.Any()).Return(errDown).Times(2),
+			cache.EXPECT().Get(gomock.Any(), "key", gomock.Any()).Return(ErrCacheMiss),
+			cache.EXPECT().Get(gomock.Any(), "key", gomock.Any()).Return(errDown).Times(2),
+			cache.EXPECT().Set(gomock.Any(), "key", 1).Return(nil),
+			cache.EXPECT().Get(gomock.Any(), "key", gomock.Any()).Return(errDown).Times(2),
+		)
+
+		cb := NewCircuitBreaker(cache, CircuitBreakerOptions{FailureThreshold: 3})
+		for i := 0; i < 2; i++ {
+			assert.ErrorIs(t, cb.Get(ctx, "key", new(int)), errDown)
+		}
+		assert.ErrorIs(t, cb.Get(ctx, "key", new(int)), ErrCacheMiss)
+		for i := 0; i < 2; i++ {
+			assert.ErrorIs(t, cb.Get(ctx, "key", new(int)), errDown)
+		}
+		require.NoError(t, cb.Set(ctx, "key", 1))
+		for i := 0; i < 2; i++ {
+			assert.ErrorIs(t, cb.Get(ctx, "key", new(int)), errDown)
+		}
+		assert.Equal(t, CircuitClosed, cb.State())
+	})
+
+	t.Run("half-open probe", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		cache := NewMockTTLCache(ctrl)
+		gomock.InOrder(
+			cache.EXPECT().Get(gomock.Any(), "key", gomock.Any()).Return(errDown),
+			// the first probe fails and opens the circuit again
+			cache.EXPECT().Get(gomock.Any(), "key", gomock.Any()).Return(errDown),
+			cache.EXPECT().Get(gomock.Any(), "key", gomock.Any()).Return(nil),
+			cache.EXPECT().Get(gomock.Any(), "key", gomock.Any()).Return(nil),
+		)
+
+		var mu sync.Mutex
+		var changes []CircuitState
+		cb := NewCircuitBreaker(cache, CircuitBreakerOptions{
+			FailureThreshold: 1,
+			OpenTimeout:      50 * time.Millisecond,
+			OpenErr:          ErrCacheMiss,
+			OnStateChange: func(from, to CircuitState) {
+				mu.Lock()
+				defer mu.Unlock()
+				changes = append(changes, to)
+			},
+		})
+
+		assert.ErrorIs(t, cb.Get(ctx, "key", new(int)), errDown)
+		assert.ErrorIs(t, cb.Get(ctx, "key", new(int)), ErrCacheMiss)
+
+		time.Sleep(60 * time.Millisecond)
+		assert.ErrorIs(t, cb.Get(ctx, "key", new(int)), errDown)
+		assert.Equal(t, CircuitOpen, cb.State())
+
+		time.Sleep(60 * time.Millisecond)
+		require.NoError(t, cb.Get(ctx, "key", new(int)))
+		assert.Equal(t, CircuitClosed, cb.State())
+		require.NoError(t, cb.Get(ctx, "key", new(int)))
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitOpen, CircuitHalfOpen, CircuitClosed}, changes)
+	})
+
+	t.Run("single probe while half-open", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		cache := NewMockTTLCache(ctrl)
+		release := make(chan struct{})
+		gomock.InOrder(
+			cache.EXPECT().Get(gomock.Any(), "key", gomock.Any()).Return(errDown),
+			cache.EXPECT().Get(gomock.Any(), "key", gomock.Any()).DoAndReturn(func(context.Context, any, any) error {
+				<-release
+				return nil
+			}),
+		)
+
+		cb := NewCircuitBreaker(cache, CircuitBreakerOptions{FailureThreshold: 1, OpenTimeout: time.Millisecond})
+		assert.ErrorIs(t, cb.Get(ctx, "key", new(int)), errDown)
+		time.Sleep(5 * time.Millisecond)
+
+		probed := make(chan error)
+		go func() {
+			probed <- cb.Get(ctx, "key", new(int))
+		}()
+		require.Eventually(t, func() bool {
+			return cb.State() == CircuitHalfOpen
+		}, time.Second, time.Millisecond)
+
+		// the probe is in flight, the other calls are short-circuited
+		assert.ErrorIs(t, cb.Get(ctx, "key", new(int)), ErrCacheUnavailable)
+		close(release)
+		require.NoError(t, <-probed)
+		assert.Equal(t, CircuitClosed, cb.State())
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		cache := NewMockTTLCache(ctrl)
+		cache.EXPECT().Get(gomock.Any(), "key", gomock.Any()).DoAndReturn(func(ctx context.Context, _ any, _ any) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+		cb := NewCircuitBreaker(cache, CircuitBreakerOptions{FailureThreshold: 1, Timeout: 10 * time.Millisecond})
+		assert.ErrorIs(t, cb.Get(ctx, "key", new(int)), context.DeadlineExceeded)
+		assert.Equal(t, CircuitOpen, cb.State())
+	})
+
+	t.Run("canceled by the caller", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		cache := NewMockTTLCache(ctrl)
+		cache.EXPECT().Get(gomock.Any(), "key", gomock.Any()).DoAndReturn(func(ctx context.Context, _ any, _ any) error {
+			return ctx.Err()
+		})
+
+		cb := NewCircuitBreaker(cache, CircuitBreakerOptions{FailureThreshold: 1})
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		assert.ErrorIs(t, cb.Get(canceled, "key", new(int)), context.Canceled)
+		assert.Equal(t, CircuitClosed, cb.State())
+	})
+
+	t.Run("late probe", func(t *testing.T) {
+		b := newCircuitBreaker(CircuitBreakerOptions{FailureThreshold: 1, OpenTimeout: time.Millisecond, HalfOpenProbes: 2}, nil)
+		b.record(0, false, errDown)
+		time.Sleep(2 * time.Millisecond)
+
+		// the second probe reopens the circuit while the first one is running
+		late, probe, allowed := b.allow()
+		require.True(t, probe && allowed)
+		generation, probe, allowed := b.allow()
+		require.True(t, probe && allowed)
+		b.record(generation, probe, errDown)
+		require.Equal(t, CircuitOpen, b.currentState())
+
+		time.Sleep(2 * time.Millisecond)
+		generation, probe, allowed = b.allow()
+		require.True(t, probe && allowed)
+		b.record(late, true, nil)
+		b.release(late, true)
+		assert.Equal(t, 1, b.probes, "the late probe doesn't free the slot of the new one")
+		assert.Zero(t, b.successes, "the late probe doesn't count")
+
+		b.record(generation, probe, nil)
+		assert.Zero(t, b.probes)
+		assert.Equal(t, CircuitHalfOpen, b.currentState())
+	})
+}
+
+// flakyByteCache is a Cache failing while down is set.
+type flakyByteCache struct {
+	Cache
+	down  atomic.Bool
+	calls atomic.Int64
+}
+
+func (f *flakyByteCache) Get(ctx context.Context, key string) ([]byte, error) {
+	f.calls.Add(1)
+	if f.down.Load() {
+		return nil, errors.New("connection refused")
+	}
+	return f.Cache.Get(ctx, key)
+}
+
+func (f *flakyByteCache) Set(ctx context.Context, key string, value []byte) error {
+	if f.down.Load() {
+		return errors.New("connection refused")
+	}
+	return f.Cache.Set(ctx, key, value)
+}
+
+func (f *flakyByteCache) Del(ctx context.Context, key string) error {
+	if f.down.Load() {
+		return errors.New("connection refused")
+	}
+	return f.Cache.Del(ctx, key)
+}
+
+func (f *flakyByteCache) BatchSet(ctx context.Context, keyvalues ...interface{}) error {
+	if f.down.Load() {
+		return errors.New("connection refused")
+	}
+	return f.Cache.BatchSet(ctx, keyvalues...)
+}
+
+func (f *flakyByteCache) IsRunning(_ context.Context) bool {
+	return !f.down.Load()
+}
+
+func TestCircuitBreakerByteCache(t *testing.T) {
+	ctx := context.Background()
+
+	inner, err := NewLibcache(10, time.Minute)
+	require.NoError(t, err)
+	flaky := &flakyByteCache{Cache: inner}
+	require.NoError(t, flaky.Set(ctx, "key", []byte("value")))
+
+	cb := NewCircuitBreakerByteCache(flaky, CircuitBreakerOptions{FailureThreshold: 2, OpenTimeout: 20 * time.Millisecond})
+
+	flaky.down.Store(true)
+	for i := 0; i < 2; i++ {
+		_, err = cb.Get(ctx, "key")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, CircuitOpen, cb.State())
+	assert.False(t, cb.IsRunning(ctx))
+
+	// the probe checks IsRunning before calling the cache
+	time.Sleep(30 * time.Millisecond)
+	_, err = cb.Get(ctx, "key")
+	assert.ErrorIs(t, err, ErrCacheUnavailable)
+	assert.EqualValues(t, 2, flaky.calls.Load())
+	assert.Equal(t, CircuitOpen, cb.State())
+
+	flaky.down.Store(false)
+	time.Sleep(30 * time.Millisecond)
+	value, err := cb.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value"), value)
+	assert.Equal(t, CircuitClosed, cb.State())
+	assert.True(t, cb.IsRunning(ctx))
+}
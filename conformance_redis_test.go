@@ -0,0 +1,36 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cache "github.com/InjectiveLabs/injective-cache"
+	"github.com/InjectiveLabs/injective-cache/cachetest"
+)
+
+// blankKey is a key formatted as an empty string, the only kind of key RedisSimpleCache rejects.
+type blankKey string
+
+func TestRedisConformance(t *testing.T) {
+	t.Run("RedisSimpleCache", func(t *testing.T) {
+		var server *cachetest.Redis
+		cachetest.RunTTLCacheSuite(t, func(t *testing.T) cache.TTLCache {
+			var c *cache.RedisSimpleCache
+			c, server = cachetest.NewRedisSimpleCache(t, time.Minute)
+			return c
+		}, cachetest.WithSleep(func(d time.Duration) {
+			server.FastForward(d)
+		}), cachetest.WithInvalidKey(blankKey("")))
+	})
+
+	t.Run("RedisCache", func(t *testing.T) {
+		var server *cachetest.Redis
+		cachetest.RunCacheSuite(t, func(t *testing.T) cache.Cache {
+			server = cachetest.NewRedis(t)
+			return cache.NewRedisCacheWithClient(context.Background(), server.Client, time.Minute)
+		}, cachetest.WithSleep(func(d time.Duration) {
+			server.FastForward(d)
+		}))
+	})
+}
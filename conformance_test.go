@@ -0,0 +1,127 @@
+package cache_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	cache "github.com/InjectiveLabs/injective-cache"
+	"github.com/InjectiveLabs/injective-cache/cachetest"
+	"github.com/shaj13/libcache"
+	_ "github.com/shaj13/libcache/lru"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTTLCacheConformance(t *testing.T) {
+	t.Run("TypedLibCache", func(t *testing.T) {
+		cachetest.RunTTLCacheSuite(t, func(t *testing.T) cache.TTLCache {
+			return cache.NewTypedLibCache[string, string](libcache.LRU.New(0), time.Minute)
+		}, cachetest.WithInvalidKey(1))
+	})
+
+	t.Run("ShardedCache", func(t *testing.T) {
+		cachetest.RunTTLCacheSuite(t, func(t *testing.T) cache.TTLCache {
+			c, err := cache.NewShardedCache[string, string](4, 0, time.Minute)
+			require.NoError(t, err)
+			return c
+		}, cachetest.WithInvalidKey(1))
+	})
+
+	t.Run("DiskSimpleCache", func(t *testing.T) {
+		cachetest.RunTTLCacheSuite(t, func(t *testing.T) cache.TTLCache {
+			c, err := cache.NewDiskSimpleCache(filepath.Join(t.TempDir(), "cache.db"), nil, time.Minute)
+			require.NoError(t, err)
+			return c
+		})
+	})
+
+	t.Run("CodecCache", func(t *testing.T) {
+		cachetest.RunTTLCacheSuite(t, func(t *testing.T) cache.TTLCache {
+			c, err := cache.NewLibcache(0, time.Minute)
+			require.NoError(t, err)
+			return cache.NewCodecCache(c, nil)
+		})
+	})
+
+	t.Run("CircuitBreaker", func(t *testing.T) {
+		cachetest.RunTTLCacheSuite(t, func(t *testing.T) cache.TTLCache {
+			c := cache.NewTypedLibCache[string, string](libcache.LRU.New(0), time.Minute)
+			return cache.NewCircuitBreaker(c, cache.CircuitBreakerOptions{})
+		}, cachetest.WithInvalidKey(1))
+	})
+
+	t.Run("FailoverCache", func(t *testing.T) {
+		cachetest.RunTTLCacheSuite(t, func(t *testing.T) cache.TTLCache {
+			return cache.NewFailoverCache(
+				cache.NewTypedLibCache[string, string](libcache.LRU.New(0), time.Minute),
+				cache.NewTypedLibCache[string, string](libcache.LRU.New(0), time.Minute),
+				cache.FailoverOptions{},
+			)
+		}, cachetest.WithInvalidKey(1))
+	})
+
+	t.Run("WriteBehind", func(t *testing.T) {
+		cachetest.RunTTLCacheSuite(t, func(t *testing.T) cache.TTLCache {
+			c := cache.NewTypedLibCache[string, string](libcache.LRU.New(0), time.Minute)
+			return cache.NewWriteBehind(c, cache.WriteBehindOptions{})
+		}, cachetest.WithInvalidKey([]string{"not", "comparable"}), cachetest.WithDeferredValidation())
+	})
+}
+
+func TestCacheConformance(t *testing.T) {
+	t.Run("Libcache", func(t *testing.T) {
+		cachetest.RunCacheSuite(t, func(t *testing.T) cache.Cache {
+			c, err := cache.NewLibcache(0, time.Minute)
+			require.NoError(t, err)
+			return c
+		})
+	})
+
+	t.Run("ShardedMemCache", func(t *testing.T) {
+		cachetest.RunCacheSuite(t, func(t *testing.T) cache.Cache {
+			c, err := cache.NewShardedMemCache(4, 0, time.Minute)
+			require.NoError(t, err)
+			return c
+		})
+	})
+
+	t.Run("DiskCache", func(t *testing.T) {
+		cachetest.RunCacheSuite(t, func(t *testing.T) cache.Cache {
+			c, err := cache.NewDiskCache(filepath.Join(t.TempDir(), "cache.db"), time.Minute)
+			require.NoError(t, err)
+			return c
+		})
+	})
+
+	t.Run("ByteCache", func(t *testing.T) {
+		cachetest.RunCacheSuite(t, func(t *testing.T) cache.Cache {
+			return cache.NewByteCache(cache.NewTypedLibCache[string, []byte](libcache.LRU.New(0), time.Minute))
+		})
+	})
+
+	t.Run("CircuitBreakerByteCache", func(t *testing.T) {
+		cachetest.RunCacheSuite(t, func(t *testing.T) cache.Cache {
+			c, err := cache.NewLibcache(0, time.Minute)
+			require.NoError(t, err)
+			return cache.NewCircuitBreakerByteCache(c, cache.CircuitBreakerOptions{})
+		})
+	})
+
+	t.Run("FailoverByteCache", func(t *testing.T) {
+		cachetest.RunCacheSuite(t, func(t *testing.T) cache.Cache {
+			primary, err := cache.NewLibcache(0, time.Minute)
+			require.NoError(t, err)
+			fallback, err := cache.NewLibcache(0, time.Minute)
+			require.NoError(t, err)
+			return cache.NewFailoverByteCache(primary, fallback, cache.FailoverOptions{})
+		})
+	})
+
+	t.Run("WriteBehindByteCache", func(t *testing.T) {
+		cachetest.RunCacheSuite(t, func(t *testing.T) cache.Cache {
+			c, err := cache.NewLibcache(0, time.Minute)
+			require.NoError(t, err)
+			return cache.NewWriteBehindByteCache(c, cache.WriteBehindOptions{})
+		})
+	})
+}
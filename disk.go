@@ -0,0 +1,384 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	_ Cache    = (*diskCache)(nil)
+	_ TTLCache = (*DiskSimpleCache)(nil)
+)
+
+const (
+	// diskExpiryLen is the length of the expiration prefixing every stored value
+	diskExpiryLen = 8
+	// defaultDiskCompactionInterval is how often the expired entries are removed when WithJanitor isn't set
+	defaultDiskCompactionInterval = time.Minute
+	// diskCompactionBatch is the number of expired keys deleted per write transaction,
+	// to not block the writers for too long
+	diskCompactionBatch = 1000
+)
+
+var diskBucket = []byte("cache")
+
+// diskStore is an on-disk key value store backed by bbolt, where every value is prefixed by its expiration.
+// Expired entries are hidden when read and deleted by a background compaction.
+type diskStore struct {
+	db     *bolt.DB
+	closed atomic.Bool
+	jitter *ttlJitter
+
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+func openDiskStore(path string, opts options) (*diskStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening disk cache %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(diskBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("creating disk cache bucket: %w", err)
+	}
+
+	s := &diskStore{
+		db:      db,
+		jitter:  opts.jitter,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	interval := opts.janitorInterval
+	if interval <= 0 {
+		interval = defaultDiskCompactionInterval
+	}
+	go s.compaction(interval)
+	return s, nil
+}
+
+// encodeDiskValue prefixes value with its expiration in unix nanoseconds, 0 means no expiration.
+func encodeDiskValue(value []byte, ttl time.Duration) []byte {
+	data := make([]byte, diskExpiryLen+len(value))
+	if ttl > 0 {
+		binary.BigEndian.PutUint64(data, uint64(time.Now().Add(ttl).UnixNano()))
+	}
+	copy(data[diskExpiryLen:], value)
+	return data
+}
+
+// decodeDiskValue returns a copy of the value stored in data, false if it's expired or malformed.
+func decodeDiskValue(data []byte, now int64) ([]byte, bool) {
+	if len(data) < diskExpiryLen {
+		return nil, false
+	}
+	expiresAt := int64(binary.BigEndian.Uint64(data))
+	if expiresAt != 0 && expiresAt <= now {
+		return nil, false
+	}
+	value := make([]byte, len(data)-diskExpiryLen)
+	copy(value, data[diskExpiryLen:])
+	return value, true
+}
+
+func (s *diskStore) set(key string, value []byte, ttl time.Duration) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(diskBucket).Put([]byte(key), encodeDiskValue(value, s.jitter.apply(ttl)))
+	})
+}
+
+func (s *diskStore) get(key string) (value []byte, found bool, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		value, found = decodeDiskValue(tx.Bucket(diskBucket).Get([]byte(key)), time.Now().UnixNano())
+		return nil
+	})
+	return value, found, err
+}
+
+func (s *diskStore) del(keys ...string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(diskBucket)
+		for _, key := range keys {
+			if err := b.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *diskStore) clear() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(diskBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(diskBucket)
+		return err
+	})
+}
+
+func (s *diskStore) compaction(interval time.Duration) {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			_ = s.compact()
+		}
+	}
+}
+
+// compact deletes the expired entries, in batches of diskCompactionBatch keys.
+func (s *diskStore) compact() error {
+	for {
+		var expired [][]byte
+		now := time.Now().UnixNano()
+		err := s.db.View(func(tx *bolt.Tx) error {
+			return tx.Bucket(diskBucket).ForEach(func(k, v []byte) error {
+				if _, found := decodeDiskValue(v, now); !found {
+					expired = append(expired, append([]byte(nil), k...))
+				}
+				if len(expired) == diskCompactionBatch {
+					return errStopIteration
+				}
+				return nil
+			})
+		})
+		if err != nil && !errors.Is(err, errStopIteration) {
+			return err
+		}
+		if len(expired) == 0 {
+			return nil
+		}
+
+		err = s.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket(diskBucket)
+			for _, k := range expired {
+				// the key may have been set again since it was read
+				if _, found := decodeDiskValue(b.Get(k), now); found {
+					continue
+				}
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil || len(expired) < diskCompactionBatch {
+			return err
+		}
+	}
+}
+
+var errStopIteration = errors.New("stop iteration")
+
+// close stops the compaction and closes the database.
+func (s *diskStore) close() error {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	<-s.stopped
+	if s.closed.Swap(true) {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// diskCache is the Cache implementation backed by a diskStore.
+type diskCache struct {
+	store *diskStore
+	ttl   time.Duration
+}
+
+// NewDiskCache opens, or creates, a persistent Cache in the file at path. The entries expire after ttl, 0 means
+// no expiration, and the expired entries are removed every minute or every WithJanitor interval.
+// A file can only be opened by one cache at a time.
+func NewDiskCache(path string, ttl time.Duration, opts ...Option) (*diskCache, error) {
+	store, err := openDiskStore(path, newOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	return &diskCache{
+		store: store,
+		ttl:   ttl,
+	}, nil
+}
+
+func (d *diskCache) Set(_ context.Context, key string, value []byte) (err error) {
+	defer wrapCacheError(&err, backendDisk, "set", key)
+	return d.store.set(key, value, d.ttl)
+}
+
+func (d *diskCache) Get(_ context.Context, key string) (_ []byte, err error) {
+	defer wrapCacheError(&err, backendDisk, "get", key)
+	value, found, err := d.store.get(key)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrCacheMiss
+	}
+	return value, nil
+}
+
+func (d *diskCache) Del(_ context.Context, key string) (err error) {
+	defer wrapCacheError(&err, backendDisk, "del", key)
+	return d.store.del(key)
+}
+
+func (d *diskCache) BatchGet(_ context.Context, keys ...string) (result [][]byte, err error) {
+	defer wrapCacheError(&err, backendDisk, "batch get", nil)
+	result = make([][]byte, 0, len(keys))
+	now := time.Now().UnixNano()
+	err = d.store.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(diskBucket)
+		for _, key := range keys {
+			// value nil should also append to maintain order
+			value, _ := decodeDiskValue(b.Get([]byte(key)), now)
+			result = append(result, value)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (d *diskCache) BatchSet(_ context.Context, keyvalues ...interface{}) (err error) {
+	defer wrapCacheError(&err, backendDisk, "batch set", nil)
+	if len(keyvalues)%2 != 0 {
+		return oddKeyValues(len(keyvalues))
+	}
+
+	// all the entries are written in a single transaction
+	return d.store.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(diskBucket)
+		for i := 0; i < len(keyvalues); i += 2 {
+			key, ok := keyvalues[i].(string)
+			if !ok {
+				return fmt.Errorf("%w at index %d: expected string, got %T", ErrInvalidKey, i, keyvalues[i])
+			}
+
+			value, ok := keyvalues[i+1].([]byte)
+			if !ok {
+				return fmt.Errorf("%w at index %d: expected []byte, got %T", ErrInvalidValue, i+1, keyvalues[i+1])
+			}
+
+			if err := b.Put([]byte(key), encodeDiskValue(value, d.store.jitter.apply(d.ttl))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (d *diskCache) IsRunning(_ context.Context) bool {
+	return !d.store.closed.Load()
+}
+
+// Close stops the compaction and closes the file, the entries are kept.
+func (d *diskCache) Close() error {
+	return d.store.close()
+}
+
+// DiskSimpleCache is a persistent TTLCache stored in a local file, it encodes the values like RedisSimpleCache
+// and can replace it as a second level cache on the hosts without redis.
+type DiskSimpleCache struct {
+	store *diskStore
+	// ttl is the default time-to-live for cache entries: 0 means no expiration
+	ttl time.Duration
+	// codec allows to specify a custom codec for encoding/decoding values
+	// json is used by default
+	codec Codec
+}
+
+// NewDiskSimpleCache opens, or creates, a DiskSimpleCache in the file at path, see NewDiskCache.
+func NewDiskSimpleCache(path string, codec Codec, ttl time.Duration, opts ...Option) (*DiskSimpleCache, error) {
+	if codec == nil {
+		codec = &JsonCodec{}
+	}
+	store, err := openDiskStore(path, newOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	return &DiskSimpleCache{
+		store: store,
+		ttl:   ttl,
+		codec: codec,
+	}, nil
+}
+
+func (d *DiskSimpleCache) Set(ctx context.Context, key any, value any) (err error) {
+	return d.SetWithTTL(ctx, key, value, d.ttl)
+}
+
+func (d *DiskSimpleCache) SetWithTTL(_ context.Context, key any, value any, ttl time.Duration) (err error) {
+	defer wrapCacheError(&err, backendDisk, "set", key)
+	k, err := keyToString(key)
+	if err != nil {
+		return err
+	}
+	data, err := d.codec.Encode(value)
+	if err != nil {
+		return &codecError{sentinel: ErrEncode, err: err}
+	}
+	return d.store.set(k, data, ttl)
+}
+
+func (d *DiskSimpleCache) Get(_ context.Context, key any, value any) (err error) {
+	defer wrapCacheError(&err, backendDisk, "get", key)
+	k, err := keyToString(key)
+	if err != nil {
+		return err
+	}
+	data, found, err := d.store.get(k)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrCacheMiss
+	}
+
+	err = d.codec.Decode(data, value)
+	if err != nil {
+		return &codecError{sentinel: ErrDecode, err: err}
+	}
+	return nil
+}
+
+func (d *DiskSimpleCache) Del(_ context.Context, keys ...any) (err error) {
+	defer wrapCacheError(&err, backendDisk, "del", singleKey(keys))
+	ks, err := keysToString(keys...)
+	if err != nil {
+		return err
+	}
+	return d.store.del(ks...)
+}
+
+func (d *DiskSimpleCache) Clear(_ context.Context) (err error) {
+	defer wrapCacheError(&err, backendDisk, "clear", nil)
+	return d.store.clear()
+}
+
+// Close stops the compaction and closes the file, the entries are kept.
+func (d *DiskSimpleCache) Close() error {
+	return d.store.close()
+}
@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestDiskCache(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cache.db")
+
+	cache, err := NewDiskCache(path, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, cache.IsRunning(ctx))
+
+	require.NoError(t, cache.Set(ctx, "key1", []byte("value1")))
+	require.NoError(t, cache.BatchSet(ctx, "key2", []byte("value2"), "key3", []byte("value3")))
+	require.ErrorIs(t, cache.BatchSet(ctx, 1, []byte("value")), ErrInvalidKey)
+	require.ErrorIs(t, cache.BatchSet(ctx, "key4", "value"), ErrInvalidValue)
+
+	values, err := cache.BatchGet(ctx, "key3", "missing", "key1")
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("value3"), nil, []byte("value1")}, values)
+
+	require.NoError(t, cache.Del(ctx, "key2"))
+	_, err = cache.Get(ctx, "key2")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+
+	t.Run("persistent", func(t *testing.T) {
+		require.NoError(t, cache.Close())
+		assert.False(t, cache.IsRunning(ctx))
+
+		cache, err = NewDiskCache(path, time.Minute)
+		require.NoError(t, err)
+		defer cache.Close()
+
+		value, err := cache.Get(ctx, "key1")
+		require.NoError(t, err)
+		assert.Equal(t, []byte("value1"), value)
+	})
+}
+
+func TestDiskSimpleCache(t *testing.T) {
+	ctx := context.Background()
+
+	cache, err := NewDiskSimpleCache(filepath.Join(t.TempDir(), "cache.db"), nil, time.Minute)
+	require.NoError(t, err)
+	defer cache.Close()
+
+	type valueStruct struct {
+		Value string
+	}
+
+	t.Run("Set and Get", func(t *testing.T) {
+		require.NoError(t, cache.Set(ctx, "key1", &valueStruct{Value: "value1"}))
+
+		value, err := Get[*valueStruct](ctx, cache, "key1")
+		require.NoError(t, err)
+		assert.Equal(t, "value1", value.Value)
+	})
+
+	t.Run("SetWithTTL expiration", func(t *testing.T) {
+		require.NoError(t, cache.SetWithTTL(ctx, "key2", "value2", time.Millisecond))
+		time.Sleep(2 * time.Millisecond)
+		assert.ErrorIs(t, cache.Get(ctx, "key2", new(string)), ErrCacheMiss)
+	})
+
+	t.Run("Del and Clear", func(t *testing.T) {
+		require.NoError(t, cache.Set(ctx, "key3", "value3"))
+		require.NoError(t, cache.Set(ctx, "key4", "value4"))
+
+		require.NoError(t, cache.Del(ctx, "key3", "missing"))
+		assert.ErrorIs(t, cache.Get(ctx, "key3", new(string)), ErrCacheMiss)
+
+		require.NoError(t, cache.Clear(ctx))
+		assert.ErrorIs(t, cache.Get(ctx, "key4", new(string)), ErrCacheMiss)
+	})
+}
+
+func TestDiskCacheCompaction(t *testing.T) {
+	ctx := context.Background()
+
+	cache, err := NewDiskSimpleCache(filepath.Join(t.TempDir(), "cache.db"), nil, 0, WithJanitor(5*time.Millisecond))
+	require.NoError(t, err)
+	defer cache.Close()
+
+	for i := 0; i < diskCompactionBatch+10; i++ {
+		require.NoError(t, cache.SetWithTTL(ctx, i, i, time.Millisecond))
+	}
+	require.NoError(t, cache.Set(ctx, "key", "value"))
+
+	count := func() (n int) {
+		_ = cache.store.db.View(func(tx *bolt.Tx) error {
+			n = tx.Bucket(diskBucket).Stats().KeyN
+			return nil
+		})
+		return n
+	}
+	assert.Eventually(t, func() bool {
+		return count() == 1
+	}, time.Second, 5*time.Millisecond)
+}
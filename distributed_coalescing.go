@@ -0,0 +1,311 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	rediscache "github.com/go-redis/redis/v8"
+)
+
+const (
+	defaultCoalescingLockTTL      = 10 * time.Second
+	defaultCoalescingPollInterval = 100 * time.Millisecond
+	defaultCoalescingStoreTimeout = time.Second
+
+	// redisCoalesceLockPrefix prefixes the lock held by the replica fetching a key, under the internal prefix
+	redisCoalesceLockPrefix = "coalesce:lock:"
+	// redisCoalesceChannelPrefix prefixes the channel notified once the replica fetching a key is done
+	redisCoalesceChannelPrefix = "coalesce:done:"
+)
+
+// releaseLockScript deletes the lock KEYS[1] only if it still holds the token ARGV[1],
+// so a lock expired and taken by someone else is never released.
+var releaseLockScript = rediscache.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// DistributedCoalescingOptions configures a DistributedCoalescingCache, zero values fall back to the defaults.
+type DistributedCoalescingOptions struct {
+	// LockTTL bounds how long a replica holds the lock of a key, so a crashed replica doesn't block the others, 10s by default.
+	LockTTL time.Duration
+	// PollInterval is how often the waiting replicas look for the value in case a notification is missed, 100ms by default.
+	PollInterval time.Duration
+	// StoreTimeout bounds storing the fetched value and releasing the lock, which complete even when the ctx of
+	// the request is canceled meanwhile, so the other replicas don't wait for LockTTL, 1s by default.
+	StoreTimeout time.Duration
+}
+
+func (o DistributedCoalescingOptions) withDefaults() DistributedCoalescingOptions {
+	if o.LockTTL <= 0 {
+		o.LockTTL = defaultCoalescingLockTTL
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = defaultCoalescingPollInterval
+	}
+	if o.StoreTimeout <= 0 {
+		o.StoreTimeout = defaultCoalescingStoreTimeout
+	}
+	return o
+}
+
+// DistributedCoalescingCache coalesces the requests for the same resource across the replicas sharing a redis:
+// on a miss, the replica taking a short redis lock on the key fetches the value and stores it, the others wait
+// for the value to appear in redis, notified via pub/sub or by polling, instead of fetching it too.
+// Within a replica the requests are coalesced like in a ResourceCoalescingCache, and the waiting requests
+// share a single pub/sub connection.
+type DistributedCoalescingCache[K comparable, T any] struct {
+	// OnErr is called when the lock can't be taken or released, or the value can't be stored
+	OnErr    func(error)
+	cache    *RedisSimpleCache
+	local    *ResourceCoalescingCache[K, T]
+	notifier *coalesceNotifier
+	opts     DistributedCoalescingOptions
+}
+
+// NewDistributedCoalescingCache creates a new DistributedCoalescingCache storing the values in cache.
+func NewDistributedCoalescingCache[K comparable, T any](cache *RedisSimpleCache, opts DistributedCoalescingOptions) *DistributedCoalescingCache[K, T] {
+	return &DistributedCoalescingCache[K, T]{
+		cache:    cache,
+		local:    NewResourceCoalescingCache[K, T](cache),
+		notifier: newCoalesceNotifier(cache.client),
+		opts:     opts.withDefaults(),
+	}
+}
+
+// Get returns the cached value of key, or the value fetched by a single replica.
+// When redis can't be used to coordinate the replicas, the value is fetched without the lock.
+func (d *DistributedCoalescingCache[K, T]) Get(ctx context.Context, key K, fetch func() (T, error)) (result T, err error) {
+	var cachedRes T
+	if cacheErr := d.cache.Get(ctx, key, &cachedRes); cacheErr == nil {
+		return cachedRes, nil
+	}
+
+	return d.local.flight(ctx, key, func() (T, error) {
+		return d.fetch(ctx, key, fetch)
+	})
+}
+
+func (d *DistributedCoalescingCache[K, T]) fetch(ctx context.Context, key K, fetch func() (T, error)) (result T, err error) {
+	k, err := keyToString(key)
+	if err != nil {
+		return result, err
+	}
+	lockKey := d.cache.opts.internalKey(redisCoalesceLockPrefix, k)
+	channel := redisCoalesceChannelPrefix + k
+	token, err := newLockToken()
+	if err != nil {
+		return result, err
+	}
+
+	var notified <-chan struct{}
+
+	for {
+		acquired, lockErr := d.cache.client.SetNX(ctx, lockKey, token, d.opts.LockTTL).Result()
+		if lockErr != nil {
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+			d.report(fmt.Errorf("locking key %s: %w", k, lockErr))
+			return d.fetchAndStore(ctx, key, fetch)
+		}
+		if acquired {
+			defer d.release(ctx, lockKey, channel, token)
+			// the value may have been stored between the miss and the lock
+			if d.cache.Get(ctx, key, &result) == nil {
+				return result, nil
+			}
+			return d.fetchAndStore(ctx, key, fetch)
+		}
+
+		// another replica is fetching it, subscribe before looking for the value to not miss its notification
+		if notified == nil {
+			var unsubscribe func()
+			notified, unsubscribe = d.notifier.subscribe(ctx, channel, d.opts.PollInterval)
+			defer unsubscribe()
+		}
+		if d.cache.Get(ctx, key, &result) == nil {
+			return result, nil
+		}
+
+		timer := time.NewTimer(d.opts.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, ctx.Err()
+		case <-notified:
+		case <-timer.C:
+		}
+		timer.Stop()
+		if d.cache.Get(ctx, key, &result) == nil {
+			return result, nil
+		}
+		// the value is still missing: the fetch failed or the lock expired, compete for the lock again
+	}
+}
+
+func (d *DistributedCoalescingCache[K, T]) fetchAndStore(ctx context.Context, key K, fetch func() (T, error)) (result T, err error) {
+	result, err = fetch()
+	if err != nil {
+		return result, err
+	}
+	// the value is stored even if the request is canceled meanwhile, the other replicas are waiting for it
+	storeCtx, cancel := detach(ctx, d.opts.StoreTimeout)
+	defer cancel()
+	if setErr := d.cache.Set(storeCtx, key, result); setErr != nil {
+		d.report(setErr)
+	}
+	return result, nil
+}
+
+// release deletes the lock if it's still held and notifies the waiting replicas, even once ctx is canceled.
+func (d *DistributedCoalescingCache[K, T]) release(ctx context.Context, lockKey, channel, token string) {
+	ctx, cancel := detach(ctx, d.opts.StoreTimeout)
+	defer cancel()
+	if err := releaseLockScript.Run(ctx, d.cache.client, []string{lockKey}, token).Err(); err != nil {
+		d.report(fmt.Errorf("releasing lock %s: %w", lockKey, err))
+	}
+	if err := d.cache.client.Publish(ctx, channel, token).Err(); err != nil {
+		d.report(fmt.Errorf("notifying %s: %w", channel, err))
+	}
+}
+
+func (d *DistributedCoalescingCache[K, T]) report(err error) {
+	if d.OnErr != nil {
+		d.OnErr(err)
+	}
+}
+
+// coalesceNotifier shares a pub/sub connection between the requests waiting for the keys fetched by other
+// replicas: a channel is subscribed while a request waits on it, and the connection is closed once none waits.
+// The waiters are registered under the mutex, the round-trips to redis are made once it's released.
+type coalesceNotifier struct {
+	client *rediscache.Client
+
+	mu       sync.Mutex
+	sub      *rediscache.PubSub
+	channels map[string]*coalesceChannel
+}
+
+// coalesceChannel holds the requests waiting on a channel.
+type coalesceChannel struct {
+	waiters map[chan struct{}]struct{}
+	// subscribed is closed once redis confirmed the subscription
+	subscribed chan struct{}
+	confirmed  bool
+}
+
+func newCoalesceNotifier(client *rediscache.Client) *coalesceNotifier {
+	return &coalesceNotifier{
+		client:   client,
+		channels: make(map[string]*coalesceChannel),
+	}
+}
+
+// subscribe returns a chan receiving the notifications of channel, once redis confirmed the subscription
+// or after wait at the latest, and the func to call when done waiting.
+func (n *coalesceNotifier) subscribe(ctx context.Context, channel string, wait time.Duration) (<-chan struct{}, func()) {
+	notified := make(chan struct{}, 1)
+
+	n.mu.Lock()
+	if n.sub == nil {
+		n.sub = n.client.Subscribe(ctx)
+		go n.dispatch(n.sub, n.sub.ChannelWithSubscriptions(ctx, 100))
+	}
+	c, found := n.channels[channel]
+	if !found {
+		c = &coalesceChannel{
+			waiters:    make(map[chan struct{}]struct{}),
+			subscribed: make(chan struct{}),
+		}
+		n.channels[channel] = c
+	}
+	c.waiters[notified] = struct{}{}
+	sub := n.sub
+	n.mu.Unlock()
+
+	if !found {
+		// on failure the subscription is retried with the reconnection, the waiters poll meanwhile
+		_ = sub.Subscribe(ctx, channel)
+	}
+
+	timer := time.NewTimer(wait)
+	select {
+	case <-c.subscribed:
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+	timer.Stop()
+
+	return notified, func() {
+		n.unsubscribe(channel, notified)
+	}
+}
+
+func (n *coalesceNotifier) unsubscribe(channel string, notified chan struct{}) {
+	n.mu.Lock()
+	c, found := n.channels[channel]
+	if !found {
+		n.mu.Unlock()
+		return
+	}
+	delete(c.waiters, notified)
+	if len(c.waiters) > 0 {
+		n.mu.Unlock()
+		return
+	}
+	delete(n.channels, channel)
+	sub := n.sub
+	if len(n.channels) == 0 {
+		n.sub = nil
+		n.mu.Unlock()
+		_ = sub.Close()
+		return
+	}
+	n.mu.Unlock()
+	_ = sub.Unsubscribe(context.Background(), channel)
+}
+
+// dispatch forwards the messages of sub to the waiting requests until sub is closed.
+func (n *coalesceNotifier) dispatch(sub *rediscache.PubSub, messages <-chan interface{}) {
+	for msg := range messages {
+		n.mu.Lock()
+		if n.sub != sub {
+			// a message left from a closed connection
+			n.mu.Unlock()
+			continue
+		}
+		switch msg := msg.(type) {
+		case *rediscache.Subscription:
+			if c, found := n.channels[msg.Channel]; found && msg.Kind == "subscribe" && !c.confirmed {
+				c.confirmed = true
+				close(c.subscribed)
+			}
+		case *rediscache.Message:
+			if c, found := n.channels[msg.Channel]; found {
+				for waiter := range c.waiters {
+					select {
+					case waiter <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}
+		n.mu.Unlock()
+	}
+}
+
+// newLockToken returns a random token identifying the holder of a lock.
+func newLockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating lock token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -1,10 +1,106 @@
 package cache
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	ErrCacheMiss            = errors.New("not found in cache")
 	ErrInvalidKey           = errors.New("key is invalid")
 	ErrInvalidValue         = errors.New("value is invalid")
 	ErrMissingFetchFunction = errors.New("missing fetch function")
+	ErrClosed               = errors.New("cache is closed")
+	ErrUnsupportedPolicy    = errors.New("eviction policy is not supported")
+	ErrInvalidSnapshot      = errors.New("snapshot is invalid")
+	ErrLockNotAcquired      = errors.New("lock is held by someone else")
+	ErrLockNotHeld          = errors.New("lock is not held")
+	ErrCacheUnavailable     = errors.New("cache is unavailable")
+	ErrTimeout              = errors.New("cache operation timed out")
+	// ErrEncode is an ErrInvalidValue the codec failed to encode
+	ErrEncode = fmt.Errorf("%w: encoding failed", ErrInvalidValue)
+	// ErrDecode is a cached value the codec failed to decode
+	ErrDecode       = errors.New("decoding failed")
+	ErrOddKeyValues = errors.New("keyvalues len must be even")
+	ErrNotSupported = errors.New("operation is not supported by the cache")
+)
+
+// Backends of the CacheError.
+const (
+	backendRedis    = "redis"
+	backendDisk     = "disk"
+	backendLibcache = "libcache"
+	backendSharded  = "sharded"
 )
+
+// CacheError is the failure of an operation of a cache backend, errors.Is and errors.As see through it to its cause.
+// A miss is never wrapped, the backends return ErrCacheMiss as is.
+type CacheError struct {
+	// Op is the failed operation, like "get" or "batch set"
+	Op string
+	// Backend is the cache backend, like "redis" or "libcache"
+	Backend string
+	// Key is the key of the operation, empty for the operations on several keys
+	Key string
+	// Err is the cause
+	Err error
+}
+
+func (e *CacheError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("%s cache: %s: %v", e.Backend, e.Op, e.Err)
+	}
+	return fmt.Sprintf("%s cache: %s %s: %v", e.Backend, e.Op, e.Key, e.Err)
+}
+
+func (e *CacheError) Unwrap() error {
+	return e.Err
+}
+
+// wrapCacheError wraps *err into a CacheError of the operation op on key, nil for several keys.
+// It's deferred by the backends, nil, misses and the errors already wrapped by an inner backend are kept as is.
+func wrapCacheError(err *error, backend, op string, key any) {
+	if *err == nil || *err == ErrCacheMiss {
+		return
+	}
+	var cacheErr *CacheError
+	if errors.As(*err, &cacheErr) {
+		return
+	}
+	k := ""
+	if key != nil {
+		k = fmt.Sprint(key)
+	}
+	*err = &CacheError{Op: op, Backend: backend, Key: k, Err: *err}
+}
+
+// codecError is the failure of a codec, it matches its sentinel, ErrEncode or ErrDecode, and unwraps to the codec error.
+type codecError struct {
+	sentinel error
+	err      error
+}
+
+func (e *codecError) Error() string {
+	return fmt.Sprintf("%v: %v", e.sentinel, e.err)
+}
+
+func (e *codecError) Is(target error) bool {
+	return errors.Is(e.sentinel, target)
+}
+
+func (e *codecError) Unwrap() error {
+	return e.err
+}
+
+// oddKeyValues returns the ErrOddKeyValues of a batch of n keys and values.
+func oddKeyValues(n int) error {
+	return fmt.Errorf("%w: got %d", ErrOddKeyValues, n)
+}
+
+// singleKey returns the key of an operation on keys, nil when there are several.
+func singleKey(keys []any) any {
+	if len(keys) == 1 {
+		return keys[0]
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	rediscache "github.com/go-redis/redis/v8"
+	"github.com/shaj13/libcache"
+	_ "github.com/shaj13/libcache/lru"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheError(t *testing.T) {
+	t.Run("wrap", func(t *testing.T) {
+		err := io.EOF
+		wrapCacheError(&err, backendRedis, "get", "key")
+
+		var cacheErr *CacheError
+		require.ErrorAs(t, err, &cacheErr)
+		assert.Equal(t, &CacheError{Op: "get", Backend: "redis", Key: "key", Err: io.EOF}, cacheErr)
+		assert.ErrorIs(t, err, io.EOF)
+		assert.EqualError(t, err, "redis cache: get key: EOF")
+	})
+
+	t.Run("several keys", func(t *testing.T) {
+		err := io.EOF
+		wrapCacheError(&err, backendDisk, "batch get", nil)
+		assert.EqualError(t, err, "disk cache: batch get: EOF")
+	})
+
+	t.Run("nil and misses are kept", func(t *testing.T) {
+		var err error
+		wrapCacheError(&err, backendRedis, "get", "key")
+		assert.NoError(t, err)
+
+		err = ErrCacheMiss
+		wrapCacheError(&err, backendRedis, "get", "key")
+		assert.Same(t, ErrCacheMiss, err)
+	})
+
+	t.Run("wrapped once", func(t *testing.T) {
+		err := io.EOF
+		wrapCacheError(&err, backendLibcache, "set", "key")
+		inner := err
+		wrapCacheError(&err, backendSharded, "batch set", nil)
+		assert.Same(t, inner, err)
+	})
+
+	t.Run("codec", func(t *testing.T) {
+		cause := errors.New("unsupported type")
+		var err error = &codecError{sentinel: ErrEncode, err: cause}
+		assert.ErrorIs(t, err, ErrEncode)
+		assert.ErrorIs(t, err, ErrInvalidValue, "an encoding failure is an invalid value")
+		assert.ErrorIs(t, err, cause)
+		assert.NotErrorIs(t, err, ErrDecode)
+
+		err = &codecError{sentinel: ErrDecode, err: cause}
+		assert.ErrorIs(t, err, ErrDecode)
+		assert.NotErrorIs(t, err, ErrInvalidValue)
+		assert.ErrorIs(t, err, cause)
+	})
+}
+
+func TestBackendErrors(t *testing.T) {
+	ctx := context.Background()
+
+	assertCacheError := func(t *testing.T, err error, backend, op, key string, target error) {
+		t.Helper()
+		var cacheErr *CacheError
+		require.ErrorAs(t, err, &cacheErr)
+		assert.Equal(t, backend, cacheErr.Backend)
+		assert.Equal(t, op, cacheErr.Op)
+		assert.Equal(t, key, cacheErr.Key)
+		assert.ErrorIs(t, err, target)
+	}
+
+	t.Run("disk", func(t *testing.T) {
+		cache, err := NewDiskSimpleCache(filepath.Join(t.TempDir(), "cache.db"), nil, time.Minute)
+		require.NoError(t, err)
+		defer cache.Close()
+
+		err = cache.Set(ctx, "key", make(chan int))
+		assertCacheError(t, err, "disk", "set", "key", ErrEncode)
+		assert.ErrorIs(t, err, ErrInvalidValue)
+
+		require.NoError(t, cache.Set(ctx, "key", "value"))
+		var value int
+		err = cache.Get(ctx, "key", &value)
+		assertCacheError(t, err, "disk", "get", "key", ErrDecode)
+		assert.Error(t, errors.Unwrap(errors.Unwrap(err)), "the codec error is kept")
+
+		assert.Same(t, ErrCacheMiss, cache.Get(ctx, "missing", &value))
+
+		byteCache, err := NewDiskCache(filepath.Join(t.TempDir(), "bytes.db"), time.Minute)
+		require.NoError(t, err)
+		defer byteCache.Close()
+		assertCacheError(t, byteCache.BatchSet(ctx, "key"), "disk", "batch set", "", ErrOddKeyValues)
+		assertCacheError(t, byteCache.BatchSet(ctx, "key", "value"), "disk", "batch set", "", ErrInvalidValue)
+	})
+
+	t.Run("libcache", func(t *testing.T) {
+		cache := NewTypedLibCache[string, int](libcache.LRU.New(10), time.Minute)
+		assertCacheError(t, cache.Set(ctx, 1, 1), "libcache", "set", "1", ErrInvalidKey)
+		assertCacheError(t, cache.Set(ctx, "key", "value"), "libcache", "set", "key", ErrInvalidValue)
+		assertCacheError(t, cache.Del(ctx, "key1", 2), "libcache", "del", "", ErrInvalidKey)
+		assert.Same(t, ErrCacheMiss, cache.Get(ctx, "missing", new(int)))
+
+		assertCacheError(t, cache.SetWithTags(ctx, "key", "value", time.Minute, "tag"), "libcache", "set with tags", "key", ErrInvalidValue)
+
+		require.NoError(t, cache.Set(ctx, "key", 1))
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := cache.DelPrefix(canceled, "key")
+		assertCacheError(t, err, "libcache", "del prefix", "key", context.Canceled)
+		_, err = cache.DelPattern(canceled, "key*")
+		assertCacheError(t, err, "libcache", "del pattern", "key*", context.Canceled)
+
+		assertCacheError(t, cache.Restore(strings.NewReader("garbage")), "libcache", "restore", "", ErrInvalidSnapshot)
+		assertCacheError(t, cache.Snapshot(failingWriter{}), "libcache", "snapshot", "", io.ErrClosedPipe)
+
+		byteCache, err := NewLibcache(10, time.Minute, WithMaxBytes(4))
+		require.NoError(t, err)
+		assertCacheError(t, byteCache.BatchSet(ctx, "key", []byte("value"), "odd"), "libcache", "batch set", "", ErrOddKeyValues)
+		assertCacheError(t, byteCache.BatchSet(ctx, "key", 1), "libcache", "batch set", "", ErrInvalidValue)
+		err = byteCache.BatchSetWithTTL(ctx, BatchItem{Key: "key", Value: []byte("value")})
+		assertCacheError(t, err, "libcache", "set", "key", ErrInvalidValue)
+	})
+
+	t.Run("sharded", func(t *testing.T) {
+		cache, err := NewShardedCache[string, int](4, 10, time.Minute)
+		require.NoError(t, err)
+		defer cache.Close()
+		assertCacheError(t, cache.Set(ctx, "key", "value"), "sharded", "set", "key", ErrInvalidValue)
+		assertCacheError(t, cache.Get(ctx, 1, new(int)), "sharded", "get", "1", ErrInvalidKey)
+		assert.Same(t, ErrCacheMiss, cache.Get(ctx, "missing", new(int)))
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err = cache.DelPrefix(canceled, "key")
+		assertCacheError(t, err, "sharded", "del prefix", "key", context.Canceled)
+		_, err = cache.DelPattern(canceled, "key*")
+		assertCacheError(t, err, "sharded", "del pattern", "key*", context.Canceled)
+	})
+
+	t.Run("redis", func(t *testing.T) {
+		// nothing listens on the port
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := listener.Addr().String()
+		require.NoError(t, listener.Close())
+
+		client := rediscache.NewClient(&rediscache.Options{Addr: addr, MaxRetries: -1})
+		defer client.Close()
+
+		cache := NewRedisSimpleCache(client, nil, time.Minute)
+		var opErr *net.OpError
+		err = cache.Get(ctx, "key", new(int))
+		assertCacheError(t, err, "redis", "get", "key", err)
+		assert.ErrorAs(t, err, &opErr)
+
+		err = cache.Set(ctx, "key", make(chan int))
+		assertCacheError(t, err, "redis", "set", "key", ErrEncode)
+
+		byteCache := NewRedisCacheWithClient(ctx, client, time.Minute)
+		_, err = byteCache.BatchGet(ctx, "key1", "key2")
+		assertCacheError(t, err, "redis", "batch get", "", err)
+		assert.ErrorAs(t, err, &opErr)
+		assertCacheError(t, byteCache.BatchSet(ctx, "key"), "redis", "batch set", "", ErrOddKeyValues)
+	})
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
@@ -0,0 +1,525 @@
+package cache
+
+import (
+	"container/list"
+	"fmt"
+
+	"github.com/shaj13/libcache"
+	_ "github.com/shaj13/libcache/arc"
+	_ "github.com/shaj13/libcache/lfu"
+	_ "github.com/shaj13/libcache/lru"
+)
+
+// EvictionPolicy selects how an in-process cache picks the entries to evict once it is full.
+type EvictionPolicy uint8
+
+const (
+	// PolicyLRU evicts the least recently used entry.
+	PolicyLRU EvictionPolicy = iota
+	// PolicyLFU evicts the least frequently used entry.
+	PolicyLFU
+	// PolicyARC balances between recency and frequency, it resists scans better than LRU.
+	PolicyARC
+	// PolicyWTinyLFU admits new entries into the cache only if they are accessed more often than the entry
+	// they would evict, behind a small LRU window. It is only supported by ShardedCache.
+	PolicyWTinyLFU
+)
+
+func (p EvictionPolicy) String() string {
+	switch p {
+	case PolicyLRU:
+		return "LRU"
+	case PolicyLFU:
+		return "LFU"
+	case PolicyARC:
+		return "ARC"
+	case PolicyWTinyLFU:
+		return "W-TinyLFU"
+	default:
+		return "unknown"
+	}
+}
+
+// libcachePolicy returns the libcache implementation of p.
+func (p EvictionPolicy) libcachePolicy() (libcache.ReplacementPolicy, bool) {
+	switch p {
+	case PolicyLRU:
+		return libcache.LRU, true
+	case PolicyLFU:
+		return libcache.LFU, true
+	case PolicyARC:
+		return libcache.ARC, true
+	default:
+		return 0, false
+	}
+}
+
+// WithEvictionPolicy selects the eviction policy of an in-process cache, LRU by default.
+func WithEvictionPolicy(policy EvictionPolicy) Option {
+	return func(o *options) {
+		o.policy = policy
+	}
+}
+
+// newEvictorFunc returns the Evictor constructor of policy, given the capacity of the shard, 0 meaning unbounded.
+func newEvictorFunc[K comparable](policy EvictionPolicy) (func(capacity int) Evictor[K], error) {
+	switch policy {
+	case PolicyLRU:
+		return func(int) Evictor[K] {
+			return NewLRUEvictor[K]()
+		}, nil
+	case PolicyLFU:
+		return func(int) Evictor[K] {
+			return NewLFUEvictor[K]()
+		}, nil
+	case PolicyARC:
+		return NewARCEvictor[K], nil
+	case PolicyWTinyLFU:
+		return NewWTinyLFUEvictor[K], nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedPolicy, policy)
+	}
+}
+
+// Evictor decides which key a shard drops when it is full.
+// Each shard has its own Evictor, always called with the shard lock held.
+type Evictor[K comparable] interface {
+	// Add is called when key is inserted.
+	Add(key K)
+	// Access is called when key is read or overwritten.
+	Access(key K)
+	// Remove is called when key is deleted or expired.
+	Remove(key K)
+	// Evict stops tracking and returns the key to drop, false if there is none.
+	Evict() (key K, ok bool)
+}
+
+var _ Evictor[string] = (*lruEvictor[string])(nil)
+
+// lruEvictor evicts the least recently used key.
+type lruEvictor[K comparable] struct {
+	ll    *list.List
+	items map[K]*list.Element
+}
+
+// NewLRUEvictor returns an Evictor dropping the least recently used key.
+func NewLRUEvictor[K comparable]() Evictor[K] {
+	return newLRUEvictor[K]()
+}
+
+func newLRUEvictor[K comparable]() *lruEvictor[K] {
+	return &lruEvictor[K]{
+		ll:    list.New(),
+		items: make(map[K]*list.Element),
+	}
+}
+
+func (e *lruEvictor[K]) Add(key K) {
+	e.items[key] = e.ll.PushFront(key)
+}
+
+func (e *lruEvictor[K]) Access(key K) {
+	if el, found := e.items[key]; found {
+		e.ll.MoveToFront(el)
+	}
+}
+
+func (e *lruEvictor[K]) Remove(key K) {
+	if el, found := e.items[key]; found {
+		e.ll.Remove(el)
+		delete(e.items, key)
+	}
+}
+
+func (e *lruEvictor[K]) Evict() (key K, ok bool) {
+	el := e.ll.Back()
+	if el == nil {
+		return key, false
+	}
+	e.ll.Remove(el)
+	key = el.Value.(K)
+	delete(e.items, key)
+	return key, true
+}
+
+// oldest returns the least recently used key without removing it.
+func (e *lruEvictor[K]) oldest() (key K, ok bool) {
+	el := e.ll.Back()
+	if el == nil {
+		return key, false
+	}
+	return el.Value.(K), true
+}
+
+func (e *lruEvictor[K]) contains(key K) bool {
+	_, found := e.items[key]
+	return found
+}
+
+func (e *lruEvictor[K]) len() int {
+	return e.ll.Len()
+}
+
+var _ Evictor[string] = (*lfuEvictor[string])(nil)
+
+// lfuEvictor evicts the least frequently used key, the least recently used one among equals.
+// Keys are kept in buckets of same frequency, sorted by increasing frequency, so every operation is O(1).
+type lfuEvictor[K comparable] struct {
+	buckets *list.List
+	items   map[K]*lfuItem[K]
+}
+
+type lfuBucket[K comparable] struct {
+	freq int
+	keys *list.List
+}
+
+type lfuItem[K comparable] struct {
+	bucket *list.Element
+	el     *list.Element
+}
+
+// NewLFUEvictor returns an Evictor dropping the least frequently used key.
+func NewLFUEvictor[K comparable]() Evictor[K] {
+	return &lfuEvictor[K]{
+		buckets: list.New(),
+		items:   make(map[K]*lfuItem[K]),
+	}
+}
+
+func (e *lfuEvictor[K]) Add(key K) {
+	front := e.buckets.Front()
+	if front == nil || front.Value.(*lfuBucket[K]).freq != 1 {
+		front = e.buckets.PushFront(&lfuBucket[K]{freq: 1, keys: list.New()})
+	}
+	e.items[key] = &lfuItem[K]{
+		bucket: front,
+		el:     front.Value.(*lfuBucket[K]).keys.PushFront(key),
+	}
+}
+
+func (e *lfuEvictor[K]) Access(key K) {
+	item, found := e.items[key]
+	if !found {
+		return
+	}
+	current := item.bucket.Value.(*lfuBucket[K])
+	next := item.bucket.Next()
+	if next == nil || next.Value.(*lfuBucket[K]).freq != current.freq+1 {
+		next = e.buckets.InsertAfter(&lfuBucket[K]{freq: current.freq + 1, keys: list.New()}, item.bucket)
+	}
+	e.unlink(item)
+	item.bucket = next
+	item.el = next.Value.(*lfuBucket[K]).keys.PushFront(key)
+}
+
+func (e *lfuEvictor[K]) Remove(key K) {
+	if item, found := e.items[key]; found {
+		e.unlink(item)
+		delete(e.items, key)
+	}
+}
+
+func (e *lfuEvictor[K]) Evict() (key K, ok bool) {
+	front := e.buckets.Front()
+	if front == nil {
+		return key, false
+	}
+	key = front.Value.(*lfuBucket[K]).keys.Back().Value.(K)
+	e.Remove(key)
+	return key, true
+}
+
+// unlink removes item from its bucket, dropping the bucket once empty.
+func (e *lfuEvictor[K]) unlink(item *lfuItem[K]) {
+	bucket := item.bucket.Value.(*lfuBucket[K])
+	bucket.keys.Remove(item.el)
+	if bucket.keys.Len() == 0 {
+		e.buckets.Remove(item.bucket)
+	}
+}
+
+var _ Evictor[string] = (*arcEvictor[string])(nil)
+
+// arcEvictor implements the Adaptive Replacement Cache policy: t1 holds the keys seen once recently,
+// t2 the keys seen at least twice, and the ghost lists b1 and b2 remember the keys recently evicted
+// from them to adapt the target size p of t1.
+type arcEvictor[K comparable] struct {
+	capacity int
+	p        int
+	t1, t2   *lruEvictor[K]
+	b1, b2   *lruEvictor[K]
+	// newest is the last added key, it must not be evicted right away
+	newest K
+}
+
+// NewARCEvictor returns an Evictor implementing ARC for a shard of capacity entries.
+// When capacity is 0 the number of entries currently tracked is used.
+func NewARCEvictor[K comparable](capacity int) Evictor[K] {
+	return &arcEvictor[K]{
+		capacity: capacity,
+		t1:       newLRUEvictor[K](),
+		t2:       newLRUEvictor[K](),
+		b1:       newLRUEvictor[K](),
+		b2:       newLRUEvictor[K](),
+	}
+}
+
+func (e *arcEvictor[K]) Add(key K) {
+	e.newest = key
+	c := e.size()
+	switch {
+	case e.b1.contains(key):
+		// it was evicted too early from t1, grow it
+		e.p = minInt(c, e.p+maxInt(e.b2.len()/e.b1.len(), 1))
+		e.b1.Remove(key)
+		e.t2.Add(key)
+	case e.b2.contains(key):
+		e.p = maxInt(0, e.p-maxInt(e.b1.len()/e.b2.len(), 1))
+		e.b2.Remove(key)
+		e.t2.Add(key)
+	default:
+		e.t1.Add(key)
+	}
+}
+
+func (e *arcEvictor[K]) Access(key K) {
+	if e.t1.contains(key) {
+		e.t1.Remove(key)
+		e.t2.Add(key)
+		return
+	}
+	e.t2.Access(key)
+}
+
+func (e *arcEvictor[K]) Remove(key K) {
+	e.t1.Remove(key)
+	e.t2.Remove(key)
+}
+
+func (e *arcEvictor[K]) Evict() (key K, ok bool) {
+	fromT1 := e.t1.len() > 0 && (e.t1.len() > e.p || e.t2.len() == 0)
+	if oldest, _ := e.t1.oldest(); fromT1 && oldest == e.newest && e.t2.len() > 0 {
+		fromT1 = false
+	}
+
+	c := e.size()
+	if fromT1 {
+		key, ok = e.t1.Evict()
+		e.b1.Add(key)
+	} else {
+		key, ok = e.t2.Evict()
+		if ok {
+			e.b2.Add(key)
+		}
+	}
+	for e.b1.len() > c {
+		e.b1.Evict()
+	}
+	for e.b2.len() > c {
+		e.b2.Evict()
+	}
+	return key, ok
+}
+
+// size is the number of resident keys ARC adapts to.
+func (e *arcEvictor[K]) size() int {
+	if e.capacity > 0 {
+		return e.capacity
+	}
+	return e.t1.len() + e.t2.len()
+}
+
+var _ Evictor[string] = (*wTinyLFUEvictor[string])(nil)
+
+// wTinyLFUEvictor implements W-TinyLFU: new keys enter a small LRU window, keys leaving the window
+// are admitted into the main segmented LRU only if they are more frequent than its victim.
+// Frequencies are estimated by a count-min sketch which is periodically aged.
+type wTinyLFUEvictor[K comparable] struct {
+	capacity  int
+	window    *lruEvictor[K]
+	probation *lruEvictor[K]
+	protected *lruEvictor[K]
+	sketch    *countMinSketch
+}
+
+// NewWTinyLFUEvictor returns an Evictor implementing W-TinyLFU for a shard of capacity entries.
+// When capacity is 0 the number of entries currently tracked is used.
+func NewWTinyLFUEvictor[K comparable](capacity int) Evictor[K] {
+	return &wTinyLFUEvictor[K]{
+		capacity:  capacity,
+		window:    newLRUEvictor[K](),
+		probation: newLRUEvictor[K](),
+		protected: newLRUEvictor[K](),
+		sketch:    newCountMinSketch(capacity),
+	}
+}
+
+func (e *wTinyLFUEvictor[K]) Add(key K) {
+	e.sketch.increment(hashKey(key))
+	e.window.Add(key)
+}
+
+func (e *wTinyLFUEvictor[K]) Access(key K) {
+	e.sketch.increment(hashKey(key))
+	switch {
+	case e.window.contains(key):
+		e.window.Access(key)
+	case e.probation.contains(key):
+		// promote the key, demoting the oldest protected one if the protected segment is full
+		e.probation.Remove(key)
+		e.protected.Add(key)
+		if e.protected.len() > e.protectedSize() {
+			demoted, _ := e.protected.Evict()
+			e.probation.Add(demoted)
+		}
+	default:
+		e.protected.Access(key)
+	}
+}
+
+func (e *wTinyLFUEvictor[K]) Remove(key K) {
+	e.window.Remove(key)
+	e.probation.Remove(key)
+	e.protected.Remove(key)
+}
+
+func (e *wTinyLFUEvictor[K]) Evict() (key K, ok bool) {
+	// the keys leaving the window get into the main segment for free while it has room
+	for e.window.len() > e.windowSize() && e.probation.len()+e.protected.len() < e.mainSize() {
+		moved, _ := e.window.Evict()
+		e.probation.Add(moved)
+	}
+
+	victim, ok := e.mainVictim()
+	if e.window.len() <= e.windowSize() || !ok {
+		if ok {
+			return e.evictMain(victim), true
+		}
+		return e.window.Evict()
+	}
+
+	// the oldest key of the window competes with the main victim to get in
+	candidate, _ := e.window.Evict()
+	if e.sketch.estimate(hashKey(candidate)) <= e.sketch.estimate(hashKey(victim)) {
+		return candidate, true
+	}
+	e.evictMain(victim)
+	e.probation.Add(candidate)
+	return victim, true
+}
+
+func (e *wTinyLFUEvictor[K]) mainVictim() (key K, ok bool) {
+	if key, ok = e.probation.oldest(); ok {
+		return key, ok
+	}
+	return e.protected.oldest()
+}
+
+func (e *wTinyLFUEvictor[K]) evictMain(key K) K {
+	e.probation.Remove(key)
+	e.protected.Remove(key)
+	return key
+}
+
+func (e *wTinyLFUEvictor[K]) size() int {
+	if e.capacity > 0 {
+		return e.capacity
+	}
+	return e.window.len() + e.probation.len() + e.protected.len()
+}
+
+// windowSize is 1% of the capacity.
+func (e *wTinyLFUEvictor[K]) windowSize() int {
+	return maxInt(1, e.size()/100)
+}
+
+func (e *wTinyLFUEvictor[K]) mainSize() int {
+	return e.size() - e.windowSize()
+}
+
+// protectedSize is 80% of the main segment.
+func (e *wTinyLFUEvictor[K]) protectedSize() int {
+	return maxInt(1, e.mainSize()*8/10)
+}
+
+const (
+	sketchDepth        = 4
+	sketchMaxCount     = 15
+	sketchMinWidth     = 64
+	sketchSamplesRatio = 10
+)
+
+// countMinSketch estimates the access frequency of the keys with 4-bit saturating counters,
+// all the counters are halved every sampleSize increments so the old accesses fade out.
+type countMinSketch struct {
+	rows       [sketchDepth][]uint8
+	mask       uint64
+	additions  int
+	sampleSize int
+}
+
+func newCountMinSketch(capacity int) *countMinSketch {
+	width := sketchMinWidth
+	for width < capacity {
+		width *= 2
+	}
+	s := &countMinSketch{
+		mask:       uint64(width - 1),
+		sampleSize: sketchSamplesRatio * width,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *countMinSketch) index(hash uint64, row int) uint64 {
+	return mix64(hash+uint64(row)*0x9e3779b97f4a7c15) & s.mask
+}
+
+func (s *countMinSketch) increment(hash uint64) {
+	for i := range s.rows {
+		idx := s.index(hash, i)
+		if s.rows[i][idx] < sketchMaxCount {
+			s.rows[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.sampleSize {
+		s.reset()
+	}
+}
+
+func (s *countMinSketch) estimate(hash uint64) uint8 {
+	estimate := uint8(sketchMaxCount)
+	for i := range s.rows {
+		if count := s.rows[i][s.index(hash, i)]; count < estimate {
+			estimate = count
+		}
+	}
+	return estimate
+}
+
+func (s *countMinSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] /= 2
+		}
+	}
+	s.additions /= 2
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,185 @@
+package cache
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLFUEvictor(t *testing.T) {
+	e := NewLFUEvictor[int]()
+	for i := 1; i <= 3; i++ {
+		e.Add(i)
+	}
+	e.Access(1)
+	e.Access(1)
+	e.Access(3)
+
+	key, ok := e.Evict()
+	require.True(t, ok)
+	assert.Equal(t, 2, key)
+
+	e.Remove(3)
+	key, ok = e.Evict()
+	require.True(t, ok)
+	assert.Equal(t, 1, key)
+
+	_, ok = e.Evict()
+	assert.False(t, ok)
+}
+
+func TestARCEvictor(t *testing.T) {
+	e := NewARCEvictor[int](2)
+	e.Add(1)
+	e.Add(2)
+	// key 1 is seen twice and moves to the frequent list
+	e.Access(1)
+	e.Add(3)
+
+	key, ok := e.Evict()
+	require.True(t, ok)
+	assert.Equal(t, 2, key)
+
+	// key 2 is back after an early eviction, the recent list grows at the expense of the frequent one
+	e.Add(2)
+	key, ok = e.Evict()
+	require.True(t, ok)
+	assert.Equal(t, 1, key)
+}
+
+func TestWTinyLFUEvictor(t *testing.T) {
+	e := NewWTinyLFUEvictor[int](10)
+	for i := 0; i < 10; i++ {
+		e.Add(i)
+		for j := 0; j < 3; j++ {
+			e.Access(i)
+		}
+	}
+	e.Add(10)
+	_, ok := e.Evict()
+	require.True(t, ok)
+
+	// the keys seen once are rejected in favour of the frequent ones
+	for i := 11; i < 13; i++ {
+		e.Add(i)
+		key, ok := e.Evict()
+		require.True(t, ok)
+		assert.Equal(t, i-1, key)
+	}
+}
+
+func TestEvictionPolicies(t *testing.T) {
+	ctx := context.Background()
+
+	for _, policy := range []EvictionPolicy{PolicyLRU, PolicyLFU, PolicyARC, PolicyWTinyLFU} {
+		t.Run(policy.String(), func(t *testing.T) {
+			cache, err := NewShardedCache[int, int](1, 10, time.Minute, WithEvictionPolicy(policy))
+			require.NoError(t, err)
+			for i := 0; i < 100; i++ {
+				require.NoError(t, cache.Set(ctx, i, i))
+			}
+			assert.LessOrEqual(t, cache.Len(), 10)
+
+			libcache, err := NewLibcache(10, time.Minute, WithEvictionPolicy(policy))
+			if policy == PolicyWTinyLFU {
+				require.ErrorIs(t, err, ErrUnsupportedPolicy)
+				return
+			}
+			require.NoError(t, err)
+			for i := 0; i < 100; i++ {
+				require.NoError(t, libcache.Set(ctx, string(rune('a'+i)), []byte{byte(i)}))
+			}
+			assert.Equal(t, 10, libcache.cache.cache.Len())
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		unknown := WithEvictionPolicy(EvictionPolicy(99))
+		_, err := NewShardedCache[int, int](1, 10, time.Minute, unknown)
+		assert.ErrorIs(t, err, ErrUnsupportedPolicy)
+		_, err = NewShardedMemCache(1, 10, time.Minute, unknown)
+		assert.ErrorIs(t, err, ErrUnsupportedPolicy)
+		_, err = NewLibcache(10, time.Minute, unknown)
+		assert.ErrorIs(t, err, ErrUnsupportedPolicy)
+		_, err = NewTypedLibCacheWithPolicy[int, int](EvictionPolicy(99), 10, time.Minute)
+		assert.ErrorIs(t, err, ErrUnsupportedPolicy)
+	})
+}
+
+// hitRatioTrace generates the keys of a synthetic workload.
+type hitRatioTrace func(r *rand.Rand, n int) []uint64
+
+// zipfTrace follows a Zipf distribution over keys keys.
+func zipfTrace(keys uint64) hitRatioTrace {
+	return func(r *rand.Rand, n int) []uint64 {
+		zipf := rand.NewZipf(r, 1.01, 1, keys-1)
+		trace := make([]uint64, n)
+		for i := range trace {
+			trace[i] = zipf.Uint64()
+		}
+		return trace
+	}
+}
+
+// scanTrace mixes a Zipf workload with periodic sequential scans over keys never seen before.
+func scanTrace(keys uint64, scanEvery, scanLen int) hitRatioTrace {
+	return func(r *rand.Rand, n int) []uint64 {
+		zipf := rand.NewZipf(r, 1.01, 1, keys-1)
+		trace := make([]uint64, 0, n)
+		next := keys
+		for len(trace) < n {
+			for i := 0; i < scanEvery && len(trace) < n; i++ {
+				trace = append(trace, zipf.Uint64())
+			}
+			for i := 0; i < scanLen && len(trace) < n; i++ {
+				trace = append(trace, next)
+				next++
+			}
+		}
+		return trace
+	}
+}
+
+func BenchmarkHitRatio(b *testing.B) {
+	ctx := context.Background()
+	const (
+		capacity = 1000
+		requests = 100_000
+	)
+	traces := map[string]hitRatioTrace{
+		"Zipf": zipfTrace(100_000),
+		"Scan": scanTrace(10_000, 5_000, 2_000),
+	}
+	evictors := map[string]func() Evictor[uint64]{
+		"LRU":       func() Evictor[uint64] { return NewLRUEvictor[uint64]() },
+		"LFU":       func() Evictor[uint64] { return NewLFUEvictor[uint64]() },
+		"ARC":       func() Evictor[uint64] { return NewARCEvictor[uint64](capacity) },
+		"W-TinyLFU": func() Evictor[uint64] { return NewWTinyLFUEvictor[uint64](capacity) },
+	}
+
+	for name, trace := range traces {
+		keys := trace(rand.New(rand.NewSource(1)), requests)
+		for policy, newEvictor := range evictors {
+			b.Run(name+"/"+policy, func(b *testing.B) {
+				var hits, total int
+				for n := 0; n < b.N; n++ {
+					cache := NewShardedCacheWithEvictor[uint64, uint64](1, capacity, time.Hour, newEvictor)
+					var value uint64
+					for _, key := range keys {
+						total++
+						if cache.Get(ctx, key, &value) == nil {
+							hits++
+							continue
+						}
+						_ = cache.Set(ctx, key, key)
+					}
+				}
+				b.ReportMetric(float64(hits)/float64(total)*100, "hit%")
+			})
+		}
+	}
+}
@@ -0,0 +1,554 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	_ TTLCache = (*FailoverCache)(nil)
+	_ Cache    = (*FailoverByteCache)(nil)
+)
+
+const (
+	defaultFailoverCheckInterval = time.Second
+	defaultFailoverJournalSize   = 10000
+)
+
+// FailoverOptions configures a failover cache, zero values fall back to the defaults.
+type FailoverOptions struct {
+	// CheckInterval is how often the primary health is checked with IsRunning, and the journal
+	// replayed once it recovered, 1s by default.
+	CheckInterval time.Duration
+	// JournalSize is the maximum number of keys written to the fallback kept to be written back
+	// to the primary, the oldest ones are dropped once it's reached, 10000 by default.
+	JournalSize int
+	// IsFailure reports whether an error returned by the primary means it's unavailable, by default every error
+	// but the ones the CircuitBreaker doesn't count as failures either, like ErrCacheMiss or ErrInvalidValue.
+	IsFailure func(error) bool
+	// OnDegraded is called when the fallback starts serving, with true, and when the primary serves again, with false.
+	OnDegraded func(degraded bool)
+}
+
+func (o FailoverOptions) withDefaults() FailoverOptions {
+	if o.CheckInterval <= 0 {
+		o.CheckInterval = defaultFailoverCheckInterval
+	}
+	if o.JournalSize <= 0 {
+		o.JournalSize = defaultFailoverJournalSize
+	}
+	if o.IsFailure == nil {
+		o.IsFailure = isCacheFailure
+	}
+	return o
+}
+
+// journalEntry is a write done on the fallback, to replay on the primary.
+type journalEntry struct {
+	op *writeOp
+	at time.Time
+}
+
+// failover routes the calls to the primary or the fallback and replays the writes done on the fallback
+// once the primary recovers, the cache specific part is done by the wrappers.
+type failover struct {
+	opts   FailoverOptions
+	health healthChecker
+	// replay applies a journaled write to the primary, elapsed is the time since it was done
+	replay func(ctx context.Context, op *writeOp, elapsed time.Duration) error
+	// clearPrimary clears the primary, nil if it can't be cleared
+	clearPrimary func(ctx context.Context) error
+	// forget deletes the replayed keys from the fallback, so it doesn't serve them once stale
+	forget func(ctx context.Context, keys []any) error
+	onErr  func(error)
+
+	mu           sync.Mutex
+	degraded     bool
+	journal      map[any]*list.Element
+	order        *list.List
+	pendingClear bool
+
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+func newFailover(opts FailoverOptions, health healthChecker) *failover {
+	return &failover{
+		opts:    opts.withDefaults(),
+		health:  health,
+		journal: make(map[any]*list.Element),
+		order:   list.New(),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+func (f *failover) start() {
+	go f.monitor()
+}
+
+func (f *failover) isDegraded() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.degraded
+}
+
+// read calls primary, or fallback while the primary is unavailable.
+func (f *failover) read(ctx context.Context, primary, fallback func(ctx context.Context) error) error {
+	if !f.isDegraded() {
+		err := primary(ctx)
+		if !f.failed(ctx, err) {
+			return err
+		}
+	}
+	return fallback(ctx)
+}
+
+// write calls primary, or fallback while the primary is unavailable and journals op to replay it later.
+func (f *failover) write(ctx context.Context, ops []*writeOp, primary, fallback func(ctx context.Context) error) error {
+	if !f.isDegraded() {
+		err := primary(ctx)
+		if !f.failed(ctx, err) {
+			return err
+		}
+	}
+	if err := fallback(ctx); err != nil {
+		return err
+	}
+	f.record(ops...)
+	return nil
+}
+
+// failed reports whether err means the primary is unavailable, and switches to the fallback if so.
+func (f *failover) failed(ctx context.Context, err error) bool {
+	if err == nil || !f.opts.IsFailure(err) || ctx.Err() != nil {
+		return false
+	}
+	f.report(fmt.Errorf("primary cache failed, switching to the fallback: %w", err))
+	f.setDegraded(true)
+	return true
+}
+
+func (f *failover) setDegraded(degraded bool) {
+	f.mu.Lock()
+	changed := f.degraded != degraded
+	f.degraded = degraded
+	f.mu.Unlock()
+
+	if changed && f.opts.OnDegraded != nil {
+		f.opts.OnDegraded(degraded)
+	}
+}
+
+// record journals the writes done on the fallback, only the latest write per key is kept.
+func (f *failover) record(ops ...*writeOp) {
+	f.mu.Lock()
+	now := time.Now()
+	var dropped []any
+	for _, op := range ops {
+		if el, found := f.journal[op.key]; found {
+			f.order.Remove(el)
+			delete(f.journal, op.key)
+		}
+		if f.order.Len() >= f.opts.JournalSize {
+			oldest := f.order.Front()
+			f.order.Remove(oldest)
+			key := oldest.Value.(*journalEntry).op.key
+			delete(f.journal, key)
+			dropped = append(dropped, key)
+		}
+		f.journal[op.key] = f.order.PushBack(&journalEntry{op: op, at: now})
+	}
+	f.mu.Unlock()
+
+	if len(dropped) > 0 {
+		f.report(fmt.Errorf("failover journal is full, the writes of the keys %v won't be replayed on the primary", dropped))
+	}
+}
+
+// clear records that the primary must be cleared before the journal is replayed, the journal is dropped.
+func (f *failover) clear() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.journal = make(map[any]*list.Element)
+	f.order.Init()
+	f.pendingClear = true
+}
+
+func (f *failover) monitor() {
+	defer close(f.stopped)
+
+	ticker := time.NewTicker(f.opts.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), f.opts.CheckInterval)
+			f.check(ctx)
+			cancel()
+		}
+	}
+}
+
+// check switches to the fallback when the primary isn't running, and back to the primary
+// once it's running again and the journal is replayed.
+func (f *failover) check(ctx context.Context) {
+	running := f.health == nil || f.health.IsRunning(ctx)
+	degraded := f.isDegraded()
+	switch {
+	case !running && !degraded:
+		f.report(fmt.Errorf("primary cache is not running, switching to the fallback: %w", ErrCacheUnavailable))
+		f.setDegraded(true)
+	case running && (degraded || f.pending()):
+		if err := f.resync(ctx); err != nil {
+			f.report(fmt.Errorf("replaying the failover journal: %w", err))
+		}
+	}
+}
+
+// resync replays the journal on the primary, and serves from the primary again once it's empty.
+func (f *failover) resync(ctx context.Context) error {
+	f.mu.Lock()
+	pendingClear := f.pendingClear
+	entries := make([]*journalEntry, 0, f.order.Len())
+	for el := f.order.Front(); el != nil; el = el.Next() {
+		entries = append(entries, el.Value.(*journalEntry))
+	}
+	f.mu.Unlock()
+
+	if pendingClear && f.clearPrimary != nil {
+		if err := f.clearPrimary(ctx); err != nil {
+			return err
+		}
+		f.mu.Lock()
+		f.pendingClear = false
+		f.mu.Unlock()
+	}
+
+	replayed := make([]any, 0, len(entries))
+	for _, entry := range entries {
+		if err := f.replay(ctx, entry.op, time.Since(entry.at)); err != nil {
+			return fmt.Errorf("key %v: %w", entry.op.key, err)
+		}
+
+		f.mu.Lock()
+		// the key may have been written again since the journal was read
+		if el, found := f.journal[entry.op.key]; found && el.Value == entry {
+			f.order.Remove(el)
+			delete(f.journal, entry.op.key)
+			replayed = append(replayed, entry.op.key)
+		}
+		f.mu.Unlock()
+	}
+
+	if len(replayed) > 0 {
+		if err := f.forget(ctx, replayed); err != nil {
+			f.report(fmt.Errorf("deleting the replayed keys from the fallback: %w", err))
+		}
+	}
+
+	f.mu.Lock()
+	recovered := f.degraded && f.order.Len() == 0 && !f.pendingClear
+	if recovered {
+		f.degraded = false
+	}
+	f.mu.Unlock()
+	if recovered && f.opts.OnDegraded != nil {
+		f.opts.OnDegraded(false)
+	}
+	return nil
+}
+
+// pending reports whether writes are waiting to be replayed, a write started before
+// the primary recovered can be journaled after.
+func (f *failover) pending() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.order.Len() > 0 || f.pendingClear
+}
+
+func (f *failover) report(err error) {
+	if f.onErr != nil {
+		f.onErr(err)
+	}
+}
+
+// close stops the health checks.
+func (f *failover) close() {
+	f.once.Do(func() {
+		close(f.stop)
+	})
+	<-f.stopped
+}
+
+// FailoverCache serves from a primary TTLCache, usually a RedisSimpleCache, and switches to a fallback, usually
+// an in-process cache, when the primary fails or its IsRunning reports false. The writes done on the fallback are
+// journaled and replayed on the primary once it's running again, then the primary serves again.
+type FailoverCache struct {
+	// OnErr is called when the primary fails and when the journal can't be replayed
+	OnErr    func(error)
+	primary  TTLCache
+	fallback TTLCache
+	failover *failover
+}
+
+// NewFailoverCache creates a new FailoverCache, Close stops the health checks.
+func NewFailoverCache(primary, fallback TTLCache, opts FailoverOptions) *FailoverCache {
+	health, _ := primary.(healthChecker)
+	c := &FailoverCache{
+		primary:  primary,
+		fallback: fallback,
+		failover: newFailover(opts, health),
+	}
+	c.failover.replay = c.replay
+	c.failover.clearPrimary = primary.Clear
+	c.failover.forget = func(ctx context.Context, keys []any) error {
+		return fallback.Del(ctx, keys...)
+	}
+	c.failover.onErr = func(err error) {
+		if c.OnErr != nil {
+			c.OnErr(err)
+		}
+	}
+	c.failover.start()
+	return c
+}
+
+// Degraded reports whether the fallback is serving.
+func (c *FailoverCache) Degraded() bool {
+	return c.failover.isDegraded()
+}
+
+func (c *FailoverCache) Set(ctx context.Context, key any, value any) (err error) {
+	return c.failover.write(ctx, []*writeOp{{key: key, value: value, defaultTTL: true}}, func(ctx context.Context) error {
+		return c.primary.Set(ctx, key, value)
+	}, func(ctx context.Context) error {
+		return c.fallback.Set(ctx, key, value)
+	})
+}
+
+func (c *FailoverCache) SetWithTTL(ctx context.Context, key any, value any, ttl time.Duration) (err error) {
+	return c.failover.write(ctx, []*writeOp{{key: key, value: value, ttl: ttl}}, func(ctx context.Context) error {
+		return c.primary.SetWithTTL(ctx, key, value, ttl)
+	}, func(ctx context.Context) error {
+		return c.fallback.SetWithTTL(ctx, key, value, ttl)
+	})
+}
+
+func (c *FailoverCache) Get(ctx context.Context, key any, value any) (err error) {
+	return c.failover.read(ctx, func(ctx context.Context) error {
+		return c.primary.Get(ctx, key, value)
+	}, func(ctx context.Context) error {
+		return c.fallback.Get(ctx, key, value)
+	})
+}
+
+func (c *FailoverCache) Del(ctx context.Context, keys ...any) (err error) {
+	ops := make([]*writeOp, 0, len(keys))
+	for _, key := range keys {
+		ops = append(ops, &writeOp{key: key, del: true})
+	}
+	return c.failover.write(ctx, ops, func(ctx context.Context) error {
+		return c.primary.Del(ctx, keys...)
+	}, func(ctx context.Context) error {
+		return c.fallback.Del(ctx, keys...)
+	})
+}
+
+// Clear clears both caches, the primary is cleared once it recovers if it's unavailable.
+func (c *FailoverCache) Clear(ctx context.Context) (err error) {
+	if err = c.fallback.Clear(ctx); err != nil {
+		return err
+	}
+	return c.failover.read(ctx, func(ctx context.Context) error {
+		return c.primary.Clear(ctx)
+	}, func(ctx context.Context) error {
+		c.failover.clear()
+		return nil
+	})
+}
+
+// IsRunning reports whether one of the caches is running, FailoverCache serves as long as one is.
+// A cache without an IsRunning method is considered running.
+func (c *FailoverCache) IsRunning(ctx context.Context) bool {
+	if c.failover.health == nil || c.failover.health.IsRunning(ctx) {
+		return true
+	}
+	fallback, ok := c.fallback.(healthChecker)
+	return !ok || fallback.IsRunning(ctx)
+}
+
+// Close stops the health checks, the caches are not closed.
+func (c *FailoverCache) Close() error {
+	c.failover.close()
+	return nil
+}
+
+func (c *FailoverCache) replay(ctx context.Context, op *writeOp, elapsed time.Duration) error {
+	switch {
+	case op.del:
+		return c.primary.Del(ctx, op.key)
+	case op.defaultTTL:
+		return c.primary.Set(ctx, op.key, op.value)
+	case op.ttl <= 0:
+		return c.primary.SetWithTTL(ctx, op.key, op.value, op.ttl)
+	case op.ttl <= elapsed:
+		// expired on the fallback, the primary must not keep an older value either
+		return c.primary.Del(ctx, op.key)
+	default:
+		return c.primary.SetWithTTL(ctx, op.key, op.value, op.ttl-elapsed)
+	}
+}
+
+// FailoverByteCache is the FailoverCache for a Cache, usually a redis cache with an in-process fallback.
+type FailoverByteCache struct {
+	// OnErr is called when the primary fails and when the journal can't be replayed
+	OnErr    func(error)
+	primary  Cache
+	fallback Cache
+	failover *failover
+}
+
+// NewFailoverByteCache creates a new FailoverByteCache, Close stops the health checks and closes both caches.
+// The writes done on the fallback are replayed with the default ttl of the primary minus the time they waited
+// in the journal when the primary is an ExpiringCache, with its whole default ttl otherwise.
+func NewFailoverByteCache(primary, fallback Cache, opts FailoverOptions) *FailoverByteCache {
+	c := &FailoverByteCache{
+		primary:  primary,
+		fallback: fallback,
+		failover: newFailover(opts, primary),
+	}
+	c.failover.replay = c.replay
+	c.failover.forget = func(ctx context.Context, keys []any) error {
+		for _, key := range keys {
+			if err := fallback.Del(ctx, key.(string)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	c.failover.onErr = func(err error) {
+		if c.OnErr != nil {
+			c.OnErr(err)
+		}
+	}
+	c.failover.start()
+	return c
+}
+
+// Degraded reports whether the fallback is serving.
+func (c *FailoverByteCache) Degraded() bool {
+	return c.failover.isDegraded()
+}
+
+func (c *FailoverByteCache) Set(ctx context.Context, key string, value []byte) error {
+	return c.failover.write(ctx, []*writeOp{{key: key, value: value, defaultTTL: true}}, func(ctx context.Context) error {
+		return c.primary.Set(ctx, key, value)
+	}, func(ctx context.Context) error {
+		return c.fallback.Set(ctx, key, value)
+	})
+}
+
+func (c *FailoverByteCache) Get(ctx context.Context, key string) (value []byte, err error) {
+	err = c.failover.read(ctx, func(ctx context.Context) (err error) {
+		value, err = c.primary.Get(ctx, key)
+		return err
+	}, func(ctx context.Context) (err error) {
+		value, err = c.fallback.Get(ctx, key)
+		return err
+	})
+	return value, err
+}
+
+func (c *FailoverByteCache) Del(ctx context.Context, key string) error {
+	return c.failover.write(ctx, []*writeOp{{key: key, del: true}}, func(ctx context.Context) error {
+		return c.primary.Del(ctx, key)
+	}, func(ctx context.Context) error {
+		return c.fallback.Del(ctx, key)
+	})
+}
+
+func (c *FailoverByteCache) BatchGet(ctx context.Context, keys ...string) (values [][]byte, err error) {
+	err = c.failover.read(ctx, func(ctx context.Context) (err error) {
+		values, err = c.primary.BatchGet(ctx, keys...)
+		return err
+	}, func(ctx context.Context) (err error) {
+		values, err = c.fallback.BatchGet(ctx, keys...)
+		return err
+	})
+	return values, err
+}
+
+func (c *FailoverByteCache) BatchSet(ctx context.Context, keyvalues ...interface{}) error {
+	if len(keyvalues)%2 != 0 {
+		return oddKeyValues(len(keyvalues))
+	}
+
+	ops := make([]*writeOp, 0, len(keyvalues)/2)
+	for i := 0; i < len(keyvalues); i += 2 {
+		key, ok := keyvalues[i].(string)
+		if !ok {
+			return fmt.Errorf("%w at index %d: expected string, got %T", ErrInvalidKey, i, keyvalues[i])
+		}
+		value, ok := keyvalues[i+1].([]byte)
+		if !ok {
+			return fmt.Errorf("%w at index %d: expected []byte, got %T", ErrInvalidValue, i+1, keyvalues[i+1])
+		}
+		ops = append(ops, &writeOp{key: key, value: value, defaultTTL: true})
+	}
+	return c.failover.write(ctx, ops, func(ctx context.Context) error {
+		return c.primary.BatchSet(ctx, keyvalues...)
+	}, func(ctx context.Context) error {
+		return c.fallback.BatchSet(ctx, keyvalues...)
+	})
+}
+
+// IsRunning reports whether one of the caches is running, FailoverByteCache serves as long as one is.
+func (c *FailoverByteCache) IsRunning(ctx context.Context) bool {
+	return c.primary.IsRunning(ctx) || c.fallback.IsRunning(ctx)
+}
+
+// Close stops the health checks and closes both caches.
+func (c *FailoverByteCache) Close() error {
+	c.failover.close()
+	err := c.primary.Close()
+	if fallbackErr := c.fallback.Close(); err == nil {
+		err = fallbackErr
+	}
+	return err
+}
+
+func (c *FailoverByteCache) replay(ctx context.Context, op *writeOp, elapsed time.Duration) error {
+	key := op.key.(string)
+	if op.del {
+		return c.primary.Del(ctx, key)
+	}
+	if err := c.primary.Set(ctx, key, op.value.([]byte)); err != nil {
+		return err
+	}
+	expiring, ok := c.primary.(ExpiringCache)
+	if !ok {
+		return nil
+	}
+
+	// the value was written with the default ttl when it was journaled, it must not outlive it on the primary
+	ttl, err := expiring.TTL(ctx, key)
+	switch {
+	case errors.Is(err, ErrCacheMiss):
+		return nil
+	case err != nil || ttl == NoTTL:
+		return err
+	case ttl <= elapsed:
+		return expiring.Del(ctx, key)
+	default:
+		return expiring.Touch(ctx, key, ttl-elapsed)
+	}
+}
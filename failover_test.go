@@ -0,0 +1,309 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shaj13/libcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyCache is a TTLCache failing while down is set.
+type flakyCache struct {
+	TTLCache
+	down atomic.Bool
+}
+
+var errConnRefused = errors.New("connection refused")
+
+func (f *flakyCache) Set(ctx context.Context, key any, value any) error {
+	if f.down.Load() {
+		return errConnRefused
+	}
+	return f.TTLCache.Set(ctx, key, value)
+}
+
+func (f *flakyCache) SetWithTTL(ctx context.Context, key any, value any, ttl time.Duration) error {
+	if f.down.Load() {
+		return errConnRefused
+	}
+	return f.TTLCache.SetWithTTL(ctx, key, value, ttl)
+}
+
+func (f *flakyCache) Get(ctx context.Context, key any, value any) error {
+	if f.down.Load() {
+		return errConnRefused
+	}
+	return f.TTLCache.Get(ctx, key, value)
+}
+
+func (f *flakyCache) Del(ctx context.Context, keys ...any) error {
+	if f.down.Load() {
+		return errConnRefused
+	}
+	return f.TTLCache.Del(ctx, keys...)
+}
+
+func (f *flakyCache) Clear(ctx context.Context) error {
+	if f.down.Load() {
+		return errConnRefused
+	}
+	return f.TTLCache.Clear(ctx)
+}
+
+func (f *flakyCache) IsRunning(_ context.Context) bool {
+	return !f.down.Load()
+}
+
+func TestFailoverCache(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T, opts FailoverOptions) (*flakyCache, *TypedLibCache[string, int], *FailoverCache) {
+		primary := &flakyCache{TTLCache: NewTypedLibCache[string, int](libcache.LRU.New(100), time.Minute)}
+		fallback := NewTypedLibCache[string, int](libcache.LRU.New(100), time.Minute)
+		if opts.CheckInterval == 0 {
+			opts.CheckInterval = 10 * time.Millisecond
+		}
+		c := NewFailoverCache(primary, fallback, opts)
+		t.Cleanup(func() {
+			require.NoError(t, c.Close())
+		})
+		return primary, fallback, c
+	}
+
+	t.Run("primary serves", func(t *testing.T) {
+		primary, fallback, c := setup(t, FailoverOptions{})
+
+		require.NoError(t, c.Set(ctx, "key", 1))
+		value, err := Get[int](ctx, c, "key")
+		require.NoError(t, err)
+		assert.Equal(t, 1, value)
+		assert.ErrorIs(t, c.Get(ctx, "missing", new(int)), ErrCacheMiss)
+
+		assert.NoError(t, primary.Get(ctx, "key", new(int)))
+		assert.ErrorIs(t, fallback.Get(ctx, "key", new(int)), ErrCacheMiss)
+		assert.False(t, c.Degraded())
+	})
+
+	t.Run("failover and replay", func(t *testing.T) {
+		var mu sync.Mutex
+		var changes []bool
+		primary, fallback, c := setup(t, FailoverOptions{
+			OnDegraded: func(degraded bool) {
+				mu.Lock()
+				defer mu.Unlock()
+				changes = append(changes, degraded)
+			},
+		})
+		var reported atomic.Int64
+		c.OnErr = func(error) { reported.Add(1) }
+		require.NoError(t, c.Set(ctx, "deleted", 1))
+		require.NoError(t, c.Set(ctx, "kept", 1))
+
+		primary.down.Store(true)
+		require.NoError(t, c.Set(ctx, "key", 2))
+		assert.True(t, c.Degraded())
+		require.NoError(t, c.SetWithTTL(ctx, "ttl", 3, time.Hour))
+		require.NoError(t, c.SetWithTTL(ctx, "expired", 4, time.Millisecond))
+		require.NoError(t, c.Del(ctx, "deleted"))
+
+		value, err := Get[int](ctx, c, "key")
+		require.NoError(t, err)
+		assert.Equal(t, 2, value)
+		assert.ErrorIs(t, c.Get(ctx, "kept", new(int)), ErrCacheMiss, "the fallback only has the keys written during the outage")
+
+		primary.down.Store(false)
+		require.Eventually(t, func() bool {
+			return !c.Degraded()
+		}, time.Second, 5*time.Millisecond)
+
+		value, err = Get[int](ctx, primary, "key")
+		require.NoError(t, err)
+		assert.Equal(t, 2, value)
+		ttl, err := primary.TTLCache.(*TypedLibCache[string, int]).TTL(ctx, "ttl")
+		require.NoError(t, err)
+		assert.InDelta(t, time.Hour, ttl, float64(time.Second))
+		assert.ErrorIs(t, primary.Get(ctx, "expired", new(int)), ErrCacheMiss)
+		assert.ErrorIs(t, primary.Get(ctx, "deleted", new(int)), ErrCacheMiss)
+		assert.NoError(t, primary.Get(ctx, "kept", new(int)))
+
+		// the replayed keys are removed from the fallback
+		assert.ErrorIs(t, fallback.Get(ctx, "key", new(int)), ErrCacheMiss)
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, []bool{true, false}, changes)
+		assert.EqualValues(t, 1, reported.Load())
+	})
+
+	t.Run("health check", func(t *testing.T) {
+		primary, _, c := setup(t, FailoverOptions{})
+
+		primary.down.Store(true)
+		require.Eventually(t, c.Degraded, time.Second, 5*time.Millisecond)
+		assert.True(t, c.IsRunning(ctx), "the fallback serves")
+
+		primary.down.Store(false)
+		require.Eventually(t, func() bool {
+			return !c.Degraded()
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		primary, _, c := setup(t, FailoverOptions{CheckInterval: time.Hour})
+		require.NoError(t, c.Set(ctx, "key", 1))
+
+		primary.down.Store(true)
+		require.NoError(t, c.Clear(ctx))
+		require.NoError(t, c.Set(ctx, "other", 2))
+
+		primary.down.Store(false)
+		c.failover.check(ctx)
+		assert.False(t, c.Degraded())
+		assert.ErrorIs(t, primary.Get(ctx, "key", new(int)), ErrCacheMiss)
+		assert.NoError(t, primary.Get(ctx, "other", new(int)))
+	})
+
+	t.Run("journal size", func(t *testing.T) {
+		primary, _, c := setup(t, FailoverOptions{CheckInterval: time.Hour, JournalSize: 2})
+		var reported []error
+		c.OnErr = func(err error) { reported = append(reported, err) }
+
+		primary.down.Store(true)
+		for _, key := range []string{"a", "b", "c"} {
+			require.NoError(t, c.Set(ctx, key, 1))
+		}
+		require.Len(t, reported, 2)
+		assert.Contains(t, reported[1].Error(), "journal is full, the writes of the keys [a]")
+
+		primary.down.Store(false)
+		c.failover.check(ctx)
+		assert.ErrorIs(t, primary.Get(ctx, "a", new(int)), ErrCacheMiss)
+		assert.NoError(t, primary.Get(ctx, "b", new(int)))
+		assert.NoError(t, primary.Get(ctx, "c", new(int)))
+	})
+
+	t.Run("invalid values don't fail over", func(t *testing.T) {
+		_, _, c := setup(t, FailoverOptions{})
+		assert.ErrorIs(t, c.Set(ctx, "key", "not an int"), ErrInvalidValue)
+		assert.False(t, c.Degraded())
+	})
+}
+
+func TestFailoverByteCache(t *testing.T) {
+	ctx := context.Background()
+
+	inner, err := NewLibcache(100, time.Minute)
+	require.NoError(t, err)
+	primary := &flakyByteCache{Cache: inner}
+	fallback, err := NewLibcache(100, time.Minute)
+	require.NoError(t, err)
+
+	c := NewFailoverByteCache(primary, fallback, FailoverOptions{CheckInterval: 10 * time.Millisecond})
+	defer c.Close()
+
+	require.NoError(t, c.Set(ctx, "key", []byte("1")))
+
+	primary.down.Store(true)
+	require.NoError(t, c.BatchSet(ctx, "a", []byte("a"), "b", []byte("b")))
+	assert.True(t, c.Degraded())
+	require.NoError(t, c.Del(ctx, "key"))
+
+	values, err := c.BatchGet(ctx, "a", "b", "key")
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b"), nil}, values)
+	assert.True(t, c.IsRunning(ctx))
+
+	primary.down.Store(false)
+	require.Eventually(t, func() bool {
+		return !c.Degraded()
+	}, time.Second, 5*time.Millisecond)
+
+	values, err = primary.BatchGet(ctx, "a", "b", "key")
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b"), nil}, values)
+	_, err = fallback.Get(ctx, "a")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+}
+
+// flakyExpiringCache is a flakyByteCache keeping the ttl methods of the ExpiringCache it wraps.
+type flakyExpiringCache struct {
+	*flakyByteCache
+	expiring ExpiringCache
+}
+
+func newFlakyExpiringCache(c ExpiringCache) *flakyExpiringCache {
+	return &flakyExpiringCache{flakyByteCache: &flakyByteCache{Cache: c}, expiring: c}
+}
+
+func (f *flakyExpiringCache) SetWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if f.down.Load() {
+		return errConnRefused
+	}
+	return f.expiring.SetWithTTL(ctx, key, value, ttl)
+}
+
+func (f *flakyExpiringCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	if f.down.Load() {
+		return 0, errConnRefused
+	}
+	return f.expiring.TTL(ctx, key)
+}
+
+func (f *flakyExpiringCache) Touch(ctx context.Context, key string, ttl time.Duration) error {
+	if f.down.Load() {
+		return errConnRefused
+	}
+	return f.expiring.Touch(ctx, key, ttl)
+}
+
+func (f *flakyExpiringCache) BatchSetWithTTL(ctx context.Context, items ...BatchItem) error {
+	if f.down.Load() {
+		return errConnRefused
+	}
+	return f.expiring.BatchSetWithTTL(ctx, items...)
+}
+
+func TestFailoverByteCacheReplayTTL(t *testing.T) {
+	ctx := context.Background()
+
+	inner, err := NewLibcache(100, time.Minute)
+	require.NoError(t, err)
+	primary := newFlakyExpiringCache(inner)
+	fallback, err := NewLibcache(100, time.Hour)
+	require.NoError(t, err)
+	c := NewFailoverByteCache(primary, fallback, FailoverOptions{CheckInterval: time.Hour})
+	defer c.Close()
+
+	primary.down.Store(true)
+	require.NoError(t, c.Set(ctx, "key", []byte("value")))
+	require.True(t, c.Degraded())
+	entry := c.failover.journal["key"].Value.(*journalEntry)
+	// the write waited 10s in the journal
+	entry.at = entry.at.Add(-10 * time.Second)
+
+	primary.down.Store(false)
+	c.failover.check(ctx)
+	require.False(t, c.Degraded())
+	ttl, err := inner.TTL(ctx, "key")
+	require.NoError(t, err)
+	assert.InDelta(t, 50*time.Second, ttl, float64(time.Second), "the time spent in the journal is subtracted from the default ttl")
+
+	t.Run("expired in the journal", func(t *testing.T) {
+		primary.down.Store(true)
+		require.NoError(t, c.Set(ctx, "key", []byte("new value")))
+		entry := c.failover.journal["key"].Value.(*journalEntry)
+		entry.at = entry.at.Add(-time.Hour)
+
+		primary.down.Store(false)
+		c.failover.check(ctx)
+		require.False(t, c.Degraded())
+		_, err := inner.Get(ctx, "key")
+		assert.ErrorIs(t, err, ErrCacheMiss)
+	})
+}
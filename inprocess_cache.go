@@ -2,25 +2,26 @@ package cache
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"time"
-
-	"github.com/shaj13/libcache"
-	_ "github.com/shaj13/libcache/lru"
 )
 
 var _ Cache = (*memLibCache)(nil)
 
 type memLibCache struct {
 	// caveat:
-	// libcache won't evict upon timeout, eviction only happens when it's expired + the cache key is read
-	cache libcache.Cache
+	// libcache won't evict upon timeout, eviction only happens when it's expired + the cache key is read,
+	// unless a janitor is configured
+	cache *TypedLibCache[string, []byte]
 }
 
-func NewLibcache(cap int, ttl time.Duration) (*memLibCache, error) {
-	c := libcache.LRU.New(cap) // new thread-safe cache
-	c.SetTTL(ttl)
+// NewLibcache creates an in-process Cache of cap entries evicting the least recently used ones,
+// WithEvictionPolicy selects another policy. PolicyWTinyLFU and unknown policies return ErrUnsupportedPolicy.
+func NewLibcache(cap int, ttl time.Duration, opts ...Option) (*memLibCache, error) {
+	c, err := NewTypedLibCacheWithPolicy[string, []byte](newOptions(opts).policy, cap, ttl, opts...)
+	if err != nil {
+		return nil, err
+	}
 	return &memLibCache{
 		cache: c,
 	}, nil
@@ -28,38 +29,36 @@ func NewLibcache(cap int, ttl time.Duration) (*memLibCache, error) {
 
 func (l *memLibCache) Set(ctx context.Context, key string, value []byte) (err error) {
 	// with default ttl
-	l.cache.Store(key, value)
-	return nil
+	return l.cache.Set(ctx, key, value)
 }
 
-func (l *memLibCache) Get(ctx context.Context, key string) ([]byte, error) {
-	value, exist := l.cache.Load(key)
-	if !exist {
-		return nil, ErrCacheMiss
+func (l *memLibCache) Get(ctx context.Context, key string) (value []byte, err error) {
+	if err = l.cache.Get(ctx, key, &value); err != nil {
+		return nil, err
 	}
-	return value.([]byte), nil
+	return value, nil
 }
 
 func (l *memLibCache) Del(ctx context.Context, key string) (err error) {
-	l.cache.Delete(key)
-	return nil
+	return l.cache.Del(ctx, key)
 }
 
 func (l *memLibCache) BatchGet(ctx context.Context, keys ...string) (result [][]byte, err error) {
 	for _, k := range keys {
-		value, exist := l.cache.Load(k)
-		if !exist {
+		value, err := l.Get(ctx, k)
+		if err != nil {
 			result = append(result, nil)
 			continue
 		}
-		result = append(result, value.([]byte))
+		result = append(result, value)
 	}
 	return result, nil
 }
 
-func (l *memLibCache) BatchSet(ctx context.Context, keyvalues ...interface{}) error {
+func (l *memLibCache) BatchSet(ctx context.Context, keyvalues ...interface{}) (err error) {
+	defer wrapCacheError(&err, backendLibcache, "batch set", nil)
 	if len(keyvalues)%2 != 0 {
-		return errors.New("keyvalues len must be even")
+		return oddKeyValues(len(keyvalues))
 	}
 
 	for i := 0; i < len(keyvalues); i += 2 {
@@ -70,17 +69,21 @@ func (l *memLibCache) BatchSet(ctx context.Context, keyvalues ...interface{}) er
 
 		value, ok := keyvalues[i+1].([]byte)
 		if !ok {
-			return fmt.Errorf("%w at index %d: expected []byte, got %T", ErrInvalidValue, i, keyvalues[i])
+			return fmt.Errorf("%w at index %d: expected []byte, got %T", ErrInvalidValue, i+1, keyvalues[i+1])
 		}
 
-		l.cache.Store(key, value)
+		if err := l.cache.Set(ctx, key, value); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
 func (l *memLibCache) Close() error {
-	l.cache.Purge()
-	return nil
+	if err := l.cache.Clear(context.Background()); err != nil {
+		return err
+	}
+	return l.cache.Close()
 }
 
 func (r *memLibCache) IsRunning(ctx context.Context) bool {
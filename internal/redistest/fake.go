@@ -0,0 +1,18 @@
+//go:build !injectivecache_redis
+
+package redistest
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// Start starts an in-process fake redis server, stopped at the end of the test.
+func Start(t testing.TB) *Server {
+	server := miniredis.RunT(t)
+	return &Server{
+		Addr:        server.Addr(),
+		fastForward: server.FastForward,
+	}
+}
@@ -0,0 +1,51 @@
+//go:build injectivecache_redis
+
+package redistest
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	defaultRedisURL = "localhost:6379"
+	// defaultRedisDB is the last of the 16 databases of a default redis configuration, the least likely in use
+	defaultRedisDB = 15
+)
+
+// Start returns the REDIS_URL server, localhost:6379 by default, with its REDIS_TEST_DB database, 15 by default,
+// flushed for the test. The other databases of the server are left untouched.
+func Start(t testing.TB) *Server {
+	ctx := context.Background()
+
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		redisURL = defaultRedisURL
+	}
+	db := defaultRedisDB
+	if s := os.Getenv("REDIS_TEST_DB"); s != "" {
+		var err error
+		if db, err = strconv.Atoi(s); err != nil {
+			t.Fatalf("parsing REDIS_TEST_DB %q: %v", s, err)
+		}
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: redisURL, DB: db})
+	defer client.Close()
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Fatalf("connecting to redis at %s: %v", redisURL, err)
+	}
+	if err := client.FlushDB(ctx).Err(); err != nil {
+		t.Fatalf("flushing the database %d of redis at %s: %v", db, redisURL, err)
+	}
+	return &Server{
+		Addr:        redisURL,
+		DB:          db,
+		fastForward: time.Sleep,
+	}
+}
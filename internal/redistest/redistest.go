@@ -0,0 +1,22 @@
+// Package redistest starts the redis server of the tests: an in-process fake by default,
+// the REDIS_URL server, localhost:6379 by default, when built with the injectivecache_redis tag.
+// The tests then only use the REDIS_TEST_DB database of the server, 15 by default.
+package redistest
+
+import "time"
+
+// Server is the redis server of a test.
+type Server struct {
+	// Addr is the address of the server
+	Addr string
+	// DB is the database of the test, the clients must select it
+	DB int
+
+	fastForward func(d time.Duration)
+}
+
+// FastForward lets d elapse for the keys ttl: the clock of the fake server moves forward,
+// the test sleeps with a real server.
+func (s *Server) FastForward(d time.Duration) {
+	s.fastForward(d)
+}
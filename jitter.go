@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// WithTTLJitter adds a random duration of up to fraction of the ttl to every ttl applied by the cache,
+// so entries set together don't expire at the same instant. A fraction of 0.1 turns a ttl of 1m into
+// a ttl between 1m and 1m6s. It applies to every backend.
+func WithTTLJitter(fraction float64) Option {
+	return func(o *options) {
+		o.jitterFraction = fraction
+	}
+}
+
+// WithTTLJitterRange adds a random duration between min and max to every ttl applied by the cache,
+// see WithTTLJitter. It applies to every backend.
+func WithTTLJitterRange(min, max time.Duration) Option {
+	return func(o *options) {
+		o.jitterMin = min
+		o.jitterMax = max
+	}
+}
+
+// WithRandSeed seeds the random jitter added to the ttl, so it's deterministic in tests.
+func WithRandSeed(seed int64) Option {
+	return func(o *options) {
+		o.seed = seed
+		o.seeded = true
+	}
+}
+
+// ttlJitter draws the random durations added to the ttl, it's safe for concurrent use.
+type ttlJitter struct {
+	mu       sync.Mutex
+	rand     *rand.Rand
+	fraction float64
+	min, max time.Duration
+}
+
+func newTTLJitter(o options) *ttlJitter {
+	if o.jitterFraction <= 0 && o.jitterMax <= 0 {
+		return nil
+	}
+	seed := o.seed
+	if !o.seeded {
+		seed = time.Now().UnixNano()
+	}
+	return &ttlJitter{
+		rand:     rand.New(rand.NewSource(seed)),
+		fraction: o.jitterFraction,
+		min:      o.jitterMin,
+		max:      o.jitterMax,
+	}
+}
+
+// apply returns ttl with a random jitter added, a ttl of 0 means no expiration and is kept as is.
+func (j *ttlJitter) apply(ttl time.Duration) time.Duration {
+	if j == nil || ttl <= 0 {
+		return ttl
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.fraction > 0 {
+		if max := int64(float64(ttl) * j.fraction); max > 0 {
+			ttl += time.Duration(j.rand.Int63n(max + 1))
+		}
+	}
+	if j.max > 0 {
+		jitter := j.min
+		if j.max > j.min {
+			jitter += time.Duration(j.rand.Int63n(int64(j.max-j.min) + 1))
+		}
+		ttl += jitter
+	}
+	return ttl
+}
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/shaj13/libcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTTLJitter(t *testing.T) {
+	t.Run("fraction", func(t *testing.T) {
+		jitter := newOptions([]Option{WithTTLJitter(0.1)}).jitter
+		seen := make(map[time.Duration]bool)
+		for i := 0; i < 100; i++ {
+			ttl := jitter.apply(time.Minute)
+			assert.GreaterOrEqual(t, ttl, time.Minute)
+			assert.LessOrEqual(t, ttl, time.Minute+6*time.Second)
+			seen[ttl] = true
+		}
+		assert.Greater(t, len(seen), 90)
+		assert.Zero(t, jitter.apply(0))
+	})
+
+	t.Run("range", func(t *testing.T) {
+		jitter := newOptions([]Option{WithTTLJitterRange(time.Second, 2*time.Second)}).jitter
+		for i := 0; i < 100; i++ {
+			ttl := jitter.apply(time.Minute)
+			assert.GreaterOrEqual(t, ttl, time.Minute+time.Second)
+			assert.LessOrEqual(t, ttl, time.Minute+2*time.Second)
+		}
+	})
+
+	t.Run("seed", func(t *testing.T) {
+		first := newOptions([]Option{WithRandSeed(42), WithTTLJitter(0.5)}).jitter
+		second := newOptions([]Option{WithTTLJitter(0.5), WithRandSeed(42)}).jitter
+		for i := 0; i < 10; i++ {
+			assert.Equal(t, first.apply(time.Minute), second.apply(time.Minute))
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		assert.Nil(t, newOptions(nil).jitter)
+		assert.Equal(t, time.Minute, newOptions(nil).jitter.apply(time.Minute))
+	})
+}
+
+func TestTTLJitterBackends(t *testing.T) {
+	ctx := context.Background()
+	opts := []Option{WithTTLJitter(0.5), WithRandSeed(1)}
+
+	disk, err := NewDiskSimpleCache(filepath.Join(t.TempDir(), "cache.db"), nil, time.Hour, opts...)
+	require.NoError(t, err)
+	defer disk.Close()
+
+	sharded, err := NewShardedCache[string, int](1, 0, time.Hour, opts...)
+	require.NoError(t, err)
+
+	caches := map[string]TTLCache{
+		"TypedLibCache":   NewTypedLibCache[string, int](libcache.LRU.New(0), time.Hour, opts...),
+		"ShardedCache":    sharded,
+		"DiskSimpleCache": disk,
+	}
+	for name, cache := range caches {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 10; i++ {
+				require.NoError(t, cache.Set(ctx, strconv.Itoa(i), i))
+			}
+		})
+	}
+
+	expiries := make(map[time.Time]bool)
+	typed := caches["TypedLibCache"].(*TypedLibCache[string, int])
+	for i := 0; i < 10; i++ {
+		expiry, _ := typed.cache.Expiry(strconv.Itoa(i))
+		assert.WithinRange(t, expiry, time.Now().Add(time.Hour-time.Second), time.Now().Add(90*time.Minute))
+		expiries[expiry.Truncate(time.Second)] = true
+	}
+	assert.Greater(t, len(expiries), 5)
+
+	expiresAt := make(map[int64]bool)
+	for _, e := range sharded.shards[0].entries {
+		expiresAt[e.expiresAt/int64(time.Second)] = true
+	}
+	assert.Greater(t, len(expiresAt), 5)
+}
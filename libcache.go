@@ -2,6 +2,10 @@ package cache
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/shaj13/libcache"
@@ -9,43 +13,136 @@ import (
 
 var _ TTLCache = (*TypedLibCache[string, string])(nil)
 
+// libcacheEventsBuffer is the initial number of removal events kept between two cache operations.
+// libcache drops the events once the buffer is full, so it grows with the cache: a GC may expire every entry at once.
+// It stops growing at libcacheMaxEventsBuffer, beyond which the dropped events are reconciled from the cache keys
+// but the expirations they carry aren't reported.
+const (
+	libcacheEventsBuffer    = 1024
+	libcacheMaxEventsBuffer = 1 << 16
+)
+
 type TypedLibCache[K comparable, T any] struct {
 	// caveat:
-	// libcache won't evict upon timeout, eviction only happens when it's expired + the cache key is read
+	// libcache won't evict upon timeout, eviction only happens when it's expired + the cache key is read,
+	// unless a janitor is configured
 	cache libcache.Cache
+	opts  options
+
+	// mu serializes the cache writes once serialized is set, so the removal events can be drained right after
+	// the operation emitting them. Until then only the operations making several libcache calls are serialized.
+	// The reads stay shared unless they extend a sliding expiration, the events they emit are drained after them.
+	mu         sync.RWMutex
+	serialized atomic.Bool
+	events     chan libcache.Event
+	// expired are the drained expiration events, reported once the lock is released
+	expired []libcache.Event
+	// sizes and used track the entries size when the cache is bounded by bytes
+	sizes map[any]int64
+	used  int64
+	// tags and keyTags are the reverse index of the tagged entries, created on the first SetWithTags
+	tags    map[string]map[any]struct{}
+	keyTags map[any][]string
+	// lifetimes are the ttl and the birth of the entries with sliding expiration
+	lifetimes map[any]lifetime
+
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
 }
 
-func NewTypedLibCache[K comparable, T any](cache libcache.Cache, ttl time.Duration) *TypedLibCache[K, T] {
+func NewTypedLibCache[K comparable, T any](cache libcache.Cache, ttl time.Duration, opts ...Option) *TypedLibCache[K, T] {
 	cache.SetTTL(ttl)
-	return &TypedLibCache[K, T]{
-		cache: cache,
+	l := &TypedLibCache[K, T]{
+		cache:   cache,
+		opts:    newOptions(opts),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	if l.opts.maxBytes > 0 {
+		l.sizes = make(map[any]int64)
+	}
+	if l.opts.sliding {
+		l.lifetimes = make(map[any]lifetime)
+	}
+	if l.opts.onExpire != nil || l.sizes != nil || l.lifetimes != nil {
+		l.notify()
+	}
+
+	if l.opts.janitorInterval > 0 {
+		go l.janitor(l.opts.janitorInterval)
+	} else {
+		close(l.stopped)
+	}
+	return l
+}
+
+// NewTypedLibCacheWithPolicy creates a TypedLibCache of capacity entries backed by the libcache implementation of policy,
+// without the caller importing the libcache packages. PolicyWTinyLFU and unknown policies return ErrUnsupportedPolicy.
+func NewTypedLibCacheWithPolicy[K comparable, T any](policy EvictionPolicy, capacity int, ttl time.Duration, opts ...Option) (*TypedLibCache[K, T], error) {
+	replacement, ok := policy.libcachePolicy()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedPolicy, policy)
 	}
+	return NewTypedLibCache[K, T](replacement.New(capacity), ttl, opts...), nil
 }
 
 func (l *TypedLibCache[K, T]) SetWithTTL(_ context.Context, key any, value any, ttl time.Duration) (err error) {
+	defer wrapCacheError(&err, backendLibcache, "set", key)
+	if _, ok := key.(K); !ok {
+		return ErrInvalidKey
+	}
 	if _, ok := value.(T); !ok {
 		return ErrInvalidValue
 	}
-	l.cache.StoreWithTTL(key, value, ttl)
-	return nil
+	defer l.lockSingle()()
+	return l.set(key, value, ttl)
 }
 
 func (l *TypedLibCache[K, T]) Set(_ context.Context, key any, value any) (err error) {
+	defer wrapCacheError(&err, backendLibcache, "set", key)
 	if _, ok := key.(K); !ok {
 		return ErrInvalidKey
 	}
 	if _, ok := value.(T); !ok {
 		return ErrInvalidValue
 	}
-	l.cache.Store(key, value)
+	defer l.lockSingle()()
+	return l.set(key, value, l.cache.TTL())
+}
+
+// BatchSet sets several key values with the default ttl, under a single lock.
+func (l *TypedLibCache[K, T]) BatchSet(_ context.Context, keyvalues ...any) (err error) {
+	defer wrapCacheError(&err, backendLibcache, "batch set", nil)
+	if len(keyvalues)%2 != 0 {
+		return oddKeyValues(len(keyvalues))
+	}
+	for i := 0; i < len(keyvalues); i += 2 {
+		if _, ok := keyvalues[i].(K); !ok {
+			return fmt.Errorf("%w at index %d: unexpected %T", ErrInvalidKey, i, keyvalues[i])
+		}
+		if _, ok := keyvalues[i+1].(T); !ok {
+			return fmt.Errorf("%w at index %d: unexpected %T", ErrInvalidValue, i+1, keyvalues[i+1])
+		}
+	}
+	l.lock()
+	defer l.unlock()
+	ttl := l.cache.TTL()
+	for i := 0; i < len(keyvalues); i += 2 {
+		if err = l.set(keyvalues[i], keyvalues[i+1], ttl); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 func (l *TypedLibCache[K, T]) Get(_ context.Context, key any, value any) (err error) {
+	defer wrapCacheError(&err, backendLibcache, "get", key)
 	if _, ok := key.(K); !ok {
 		return ErrInvalidKey
 	}
-	v, exist := l.cache.Load(key)
+	v, exist := l.load(key)
 	if !exist {
 		return ErrCacheMiss
 	}
@@ -57,6 +154,8 @@ func (l *TypedLibCache[K, T]) Get(_ context.Context, key any, value any) (err er
 }
 
 func (l *TypedLibCache[K, T]) Del(_ context.Context, keys ...any) (err error) {
+	defer wrapCacheError(&err, backendLibcache, "del", singleKey(keys))
+	defer l.lockSingle()()
 	for _, key := range keys {
 		if _, ok := key.(K); !ok {
 			return ErrInvalidKey
@@ -67,6 +166,264 @@ func (l *TypedLibCache[K, T]) Del(_ context.Context, keys ...any) (err error) {
 }
 
 func (l *TypedLibCache[K, T]) Clear(_ context.Context) (err error) {
+	defer wrapCacheError(&err, backendLibcache, "clear", nil)
+	l.lock()
+	defer l.unlock()
+	// collect the expired entries first so they are reported as such
+	l.cache.GC()
+	l.drain()
 	l.cache.Purge()
+	l.discardEvents()
+	if l.sizes != nil {
+		l.sizes = make(map[any]int64)
+		l.used = 0
+	}
+	if l.keyTags != nil {
+		l.tags = make(map[string]map[any]struct{})
+		l.keyTags = make(map[any][]string)
+	}
+	if l.lifetimes != nil {
+		l.lifetimes = make(map[any]lifetime)
+	}
 	return nil
 }
+
+// Close stops the janitor, the entries are kept.
+func (l *TypedLibCache[K, T]) Close() error {
+	l.once.Do(func() {
+		close(l.stop)
+	})
+	<-l.stopped
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.events != nil {
+		l.cache.Ignore(l.events)
+	}
+	return nil
+}
+
+func (l *TypedLibCache[K, T]) janitor(interval time.Duration) {
+	defer close(l.stopped)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			l.lock()
+			l.cache.GC()
+			l.unlock()
+		}
+	}
+}
+
+// load reads key, extending its sliding expiration if enabled.
+func (l *TypedLibCache[K, T]) load(key any) (any, bool) {
+	if l.opts.sliding {
+		l.lock()
+		defer l.unlock()
+		v, exist := l.cache.Load(key)
+		return v, exist && l.slide(key, v)
+	}
+
+	l.mu.RLock()
+	v, exist := l.cache.Load(key)
+	// the read may have expired entries, reserve sized the buffer for them
+	pending := l.events != nil && len(l.events) > 0
+	l.mu.RUnlock()
+	if pending {
+		// unlock drains and reports them
+		l.lock()
+		l.unlock()
+	}
+	return v, exist
+}
+
+// lock acquires the cache exclusively, for the operations making several libcache calls.
+func (l *TypedLibCache[K, T]) lock() {
+	l.mu.Lock()
+	l.reserve()
+}
+
+// lockSingle acquires the cache for an operation making a single libcache call, shared with the other ones
+// until the cache is serialized. It returns the func releasing the cache.
+func (l *TypedLibCache[K, T]) lockSingle() func() {
+	if !l.serialized.Load() {
+		l.mu.RLock()
+		// the cache may have been serialized meanwhile
+		if !l.serialized.Load() {
+			return l.mu.RUnlock
+		}
+		l.mu.RUnlock()
+	}
+	l.lock()
+	return l.unlock
+}
+
+// notify subscribes to the removal events and serializes the operations, it must be called with the lock held
+// or before the cache is used.
+func (l *TypedLibCache[K, T]) notify() {
+	l.events = make(chan libcache.Event, libcacheEventsBuffer)
+	l.cache.Notify(l.events, libcache.Remove)
+	l.serialized.Store(true)
+}
+
+// reserve grows the events buffer so it can hold the removal of every entry and of the entry an operation adds,
+// up to libcacheMaxEventsBuffer, libcache dropping the events beyond. It must be called with the lock held.
+func (l *TypedLibCache[K, T]) reserve() {
+	if l.events == nil {
+		return
+	}
+	needed := l.cache.Len() + 2
+	if needed > libcacheMaxEventsBuffer {
+		needed = libcacheMaxEventsBuffer
+	}
+	if cap(l.events)-len(l.events) >= needed {
+		return
+	}
+	// the pending events are consumed before switching to a larger buffer
+	l.drain()
+	if cap(l.events) >= needed {
+		return
+	}
+	size := 2 * needed
+	if size > libcacheMaxEventsBuffer {
+		size = libcacheMaxEventsBuffer
+	}
+	events := make(chan libcache.Event, size)
+	l.cache.Notify(events, libcache.Remove)
+	l.cache.Ignore(l.events)
+	l.events = events
+}
+
+// unlock releases the cache acquired by lock and reports the entries that expired during the operation.
+func (l *TypedLibCache[K, T]) unlock() {
+	l.drain()
+	expired := l.expired
+	l.expired = nil
+	l.mu.Unlock()
+
+	for _, e := range expired {
+		l.opts.onExpire(e.Key, e.Value)
+	}
+}
+
+// store sets the key value, evicting entries until the cache fits in its byte budget if any.
+// It must be called with the lock held.
+func (l *TypedLibCache[K, T]) store(key any, value any, ttl time.Duration) error {
+	var size int64
+	if l.sizes != nil {
+		size = l.opts.sizer(key, value)
+		if size > l.opts.maxBytes {
+			return fmt.Errorf("%w: size %d exceeds the cache capacity of %d bytes", ErrInvalidValue, size, l.opts.maxBytes)
+		}
+	}
+
+	l.cache.StoreWithTTL(key, value, ttl)
+	// account the removals done by the store before the new entry: the expired entries
+	// and the capacity eviction. An existing entry for the key is replaced without event.
+	l.drain()
+	l.untag(key)
+	if l.sizes == nil {
+		return nil
+	}
+	l.used += size - l.sizes[key]
+	l.sizes[key] = size
+
+	capacity := l.cache.Cap()
+	if capacity == 0 {
+		// Resize(0) would remove every entry
+		capacity = math.MaxInt
+	}
+	for l.used > l.opts.maxBytes && l.cache.Len() > 1 {
+		// shrinking by one evicts the next entry according to the cache policy
+		l.cache.Resize(l.cache.Len() - 1)
+		l.cache.Resize(capacity)
+		l.drain()
+	}
+	return nil
+}
+
+// drain consumes the pending removal events, updates the size accounting,
+// and keeps the events caused by an expiration to report them.
+func (l *TypedLibCache[K, T]) drain() {
+	if l.events == nil {
+		return
+	}
+	// a full buffer means events may have been dropped
+	overflow := len(l.events) == cap(l.events)
+	now := time.Now()
+	for {
+		select {
+		case e := <-l.events:
+			if l.sizes != nil {
+				l.used -= l.sizes[e.Key]
+				delete(l.sizes, e.Key)
+			}
+			l.untag(e.Key)
+			if l.lifetimes != nil {
+				delete(l.lifetimes, e.Key)
+			}
+			if l.opts.onExpire != nil && !e.Expiry.IsZero() && !e.Expiry.After(now) {
+				l.expired = append(l.expired, e)
+			}
+		default:
+			if overflow {
+				l.reconcile()
+			}
+			return
+		}
+	}
+}
+
+// reconcile rebuilds the size accounting and the tags index from the keys in the cache.
+func (l *TypedLibCache[K, T]) reconcile() {
+	keys := l.cache.Keys()
+	if l.sizes != nil {
+		sizes := make(map[any]int64, len(l.sizes))
+		l.used = 0
+		for _, key := range keys {
+			if size, found := l.sizes[key]; found {
+				sizes[key] = size
+				l.used += size
+			}
+		}
+		l.sizes = sizes
+	}
+	if l.lifetimes != nil {
+		lifetimes := make(map[any]lifetime, len(l.lifetimes))
+		for _, key := range keys {
+			if lt, found := l.lifetimes[key]; found {
+				lifetimes[key] = lt
+			}
+		}
+		l.lifetimes = lifetimes
+	}
+	if l.keyTags != nil {
+		keyTags := l.keyTags
+		l.tags = make(map[string]map[any]struct{})
+		l.keyTags = make(map[any][]string)
+		for _, key := range keys {
+			if tags, found := keyTags[key]; found {
+				l.tag(key, tags)
+			}
+		}
+	}
+}
+
+func (l *TypedLibCache[K, T]) discardEvents() {
+	if l.events == nil {
+		return
+	}
+	for {
+		select {
+		case <-l.events:
+		default:
+			return
+		}
+	}
+}
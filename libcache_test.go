@@ -2,6 +2,8 @@ package cache
 
 import (
 	"context"
+	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -125,3 +127,126 @@ func TestLRULibCacheStruct(t *testing.T) {
 		require.ErrorIs(t, err, ErrInvalidValue)
 	})
 }
+
+func TestTypedLibCacheJanitor(t *testing.T) {
+	ctx := context.Background()
+
+	expired := make(chan any, 10)
+	lru := libcache.LRU.New(10)
+	cache := NewTypedLibCache[string, string](lru, 10*time.Millisecond,
+		WithJanitor(5*time.Millisecond),
+		WithExpiryCallback(func(key, value any) {
+			expired <- key
+		}),
+	)
+	defer cache.Close()
+
+	require.NoError(t, cache.Set(ctx, "key1", "value1"))
+	require.NoError(t, cache.SetWithTTL(ctx, "key2", "value2", time.Minute))
+	require.NoError(t, cache.Set(ctx, "deleted", "value"))
+	require.NoError(t, cache.Del(ctx, "deleted"))
+
+	select {
+	case key := <-expired:
+		assert.Equal(t, "key1", key)
+	case <-time.After(time.Second):
+		t.Fatal("expiry callback not called")
+	}
+	// the entry is gone without being read
+	assert.Equal(t, 1, lru.Len())
+
+	require.NoError(t, cache.Close())
+	assert.Empty(t, expired, "deleted keys are not reported as expired")
+}
+
+func TestTypedLibCacheMaxBytes(t *testing.T) {
+	ctx := context.Background()
+
+	type valueStruct struct {
+		Payload []byte
+	}
+	sizer := func(key, value any) int64 {
+		return int64(len(key.(string)) + len(value.(*valueStruct).Payload))
+	}
+	lru := libcache.LRU.New(0)
+	cache := NewTypedLibCache[string, *valueStruct](lru, 10*time.Millisecond, WithMaxBytes(100), WithSizer(sizer))
+	defer cache.Close()
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, cache.SetWithTTL(ctx, fmt.Sprintf("key%d", i), &valueStruct{Payload: make([]byte, 16)}, time.Minute))
+	}
+	// each entry costs 20 bytes
+	assert.Equal(t, 5, lru.Len())
+	assert.EqualValues(t, 100, cache.used)
+
+	// expired entries release their budget
+	require.NoError(t, cache.Set(ctx, "short", &valueStruct{Payload: make([]byte, 15)}))
+	assert.Equal(t, 5, lru.Len())
+	time.Sleep(20 * time.Millisecond)
+	require.ErrorIs(t, cache.Get(ctx, "short", new(*valueStruct)), ErrCacheMiss)
+	assert.EqualValues(t, 80, cache.used)
+
+	require.NoError(t, cache.Clear(ctx))
+	assert.Zero(t, cache.used)
+}
+
+func TestLibCacheExpiryCallbacks(t *testing.T) {
+	ctx := context.Background()
+
+	var expired atomic.Int64
+	lru := libcache.LRU.New(0)
+	cache := NewTypedLibCache[string, int](lru, 10*time.Millisecond,
+		WithJanitor(5*time.Millisecond),
+		WithExpiryCallback(func(key, value any) {
+			expired.Add(1)
+		}),
+	)
+	defer cache.Close()
+
+	// more entries expire at once than the initial events buffer holds
+	const n = 2000
+	for i := 0; i < n; i++ {
+		require.NoError(t, cache.Set(ctx, fmt.Sprintf("key%d", i), i))
+	}
+	assert.Eventually(t, func() bool {
+		return expired.Load() == n
+	}, time.Second, 5*time.Millisecond, "every expiration is reported")
+	assert.Zero(t, lru.Len())
+}
+
+func TestTypedLibCacheEventsBuffer(t *testing.T) {
+	ctx := context.Background()
+
+	sizer := func(key, value any) int64 { return 1 }
+	cache := NewTypedLibCache[int, int](libcache.LRU.New(0), time.Minute, WithMaxBytes(1<<20), WithSizer(sizer))
+	defer cache.Close()
+
+	// more entries expire at once than the largest events buffer holds
+	const n = libcacheMaxEventsBuffer + 1000
+	for i := 0; i < n; i++ {
+		require.NoError(t, cache.SetWithTTL(ctx, i, i, 50*time.Millisecond))
+	}
+	assert.LessOrEqual(t, cap(cache.events), libcacheMaxEventsBuffer)
+
+	time.Sleep(60 * time.Millisecond)
+	require.NoError(t, cache.Set(ctx, -1, -1))
+	assert.Equal(t, 1, cache.cache.Len())
+	assert.EqualValues(t, 1, cache.used, "the dropped events are reconciled")
+	assert.Len(t, cache.sizes, 1)
+
+	t.Run("shared reads", func(t *testing.T) {
+		// a read doesn't wait for another one holding the cache
+		cache.mu.RLock()
+		defer cache.mu.RUnlock()
+		done := make(chan error, 1)
+		go func() {
+			done <- cache.Get(ctx, -1, new(int))
+		}()
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("the read waited for the exclusive lock")
+		}
+	})
+}
@@ -0,0 +1,344 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	rediscache "github.com/go-redis/redis/v8"
+)
+
+var (
+	_ Locker = (*RedisLocker)(nil)
+	_ Locker = (*MemoryLocker)(nil)
+)
+
+const (
+	defaultLockRetryInterval = 50 * time.Millisecond
+	// minLockTTL is the shortest ttl of a lock, redis expires the keys with a millisecond precision
+	minLockTTL = time.Millisecond
+
+	// redisLockPrefix prefixes the keys of the locks
+	redisLockPrefix = "lock:"
+	// redisFencePrefix prefixes the counters of the fencing tokens, they are kept forever: a counter expiring
+	// would start over and hand out the fences already seen by the resources.
+	redisFencePrefix = "fence:"
+)
+
+// Locker provides mutual exclusion on a key across the processes sharing the locker backend.
+type Locker interface {
+	// Lock waits until the key is locked for ttl or ctx is done.
+	Lock(ctx context.Context, key string, ttl time.Duration) (*Lock, error)
+	// TryLock locks the key for ttl, or returns ErrLockNotAcquired if it's already locked.
+	// A ttl under a millisecond is rounded up to a millisecond, a ttl <= 0 is an ErrInvalidValue.
+	TryLock(ctx context.Context, key string, ttl time.Duration) (*Lock, error)
+	// Unlock releases the lock, or returns ErrLockNotHeld if it expired.
+	Unlock(ctx context.Context, lock *Lock) error
+	// Refresh extends the lock to ttl from now, or returns ErrLockNotHeld if it expired.
+	Refresh(ctx context.Context, lock *Lock, ttl time.Duration) error
+}
+
+// LockerOptions configures a Locker, zero values fall back to the defaults.
+type LockerOptions struct {
+	// RetryInterval is how often Lock tries to take a locked key, 50ms by default.
+	RetryInterval time.Duration
+	// AutoRenew refreshes the locks every third of their ttl until they are unlocked.
+	AutoRenew bool
+	// OnErr is called when an automatic renewal fails
+	OnErr func(error)
+	// InternalPrefix is the namespace of the redis keys of the locks and of their fences, "\x00icache:" by default
+	// like the one set by WithInternalPrefix.
+	InternalPrefix string
+}
+
+func (o LockerOptions) withDefaults() LockerOptions {
+	if o.RetryInterval <= 0 {
+		o.RetryInterval = defaultLockRetryInterval
+	}
+	if o.InternalPrefix == "" {
+		o.InternalPrefix = defaultInternalPrefix
+	}
+	return o
+}
+
+// Lock is a held lock.
+type Lock struct {
+	// Key is the locked key
+	Key string
+	// Token identifies the holder of the lock
+	Token string
+	// Fence increases every time the key is locked, a resource can reject the writes carrying
+	// a lower fence than the last one seen, as they come from a holder which lost the lock since.
+	Fence int64
+
+	stop chan struct{}
+	lost chan struct{}
+	once sync.Once
+}
+
+func newLock(key, token string, fence int64) *Lock {
+	return &Lock{
+		Key:   key,
+		Token: token,
+		Fence: fence,
+		stop:  make(chan struct{}),
+		lost:  make(chan struct{}),
+	}
+}
+
+// Lost is closed when the automatic renewal finds that the lock is no longer held.
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *Lock) stopRenewal() {
+	l.once.Do(func() {
+		close(l.stop)
+	})
+}
+
+// lockLoop retries tryLock every interval until the key is locked or ctx is done.
+func lockLoop(ctx context.Context, interval time.Duration, tryLock func() (*Lock, error)) (*Lock, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		lock, err := tryLock()
+		if !errors.Is(err, ErrLockNotAcquired) {
+			return lock, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// lockTTL validates the ttl of a lock and rounds it up to minLockTTL.
+func lockTTL(ttl time.Duration) (time.Duration, error) {
+	if ttl <= 0 {
+		return 0, fmt.Errorf("%w: lock ttl %s", ErrInvalidValue, ttl)
+	}
+	if ttl < minLockTTL {
+		return minLockTTL, nil
+	}
+	return ttl, nil
+}
+
+// renew refreshes lock every third of ttl until it's unlocked or lost.
+func renew(lock *Lock, ttl time.Duration, opts LockerOptions, refresh func(ctx context.Context, lock *Lock, ttl time.Duration) error) {
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-lock.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), ttl/3)
+			err := refresh(ctx, lock, ttl)
+			cancel()
+			if err == nil {
+				continue
+			}
+			if opts.OnErr != nil {
+				opts.OnErr(fmt.Errorf("renewing lock %s: %w", lock.Key, err))
+			}
+			if errors.Is(err, ErrLockNotHeld) {
+				close(lock.lost)
+				return
+			}
+		}
+	}
+}
+
+// acquireLockScript locks KEYS[1] with the token ARGV[1] for ARGV[2] milliseconds and returns
+// the next fencing token from the counter KEYS[2], or 0 if the key is already locked.
+var acquireLockScript = rediscache.NewScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return redis.call('INCR', KEYS[2])
+end
+return 0
+`)
+
+// refreshLockScript extends the lock KEYS[1] to ARGV[2] milliseconds if it still holds the token ARGV[1].
+var refreshLockScript = rediscache.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// RedisLocker is a Locker backed by redis, the locks are shared by the processes using the same redis.
+type RedisLocker struct {
+	client *rediscache.Client
+	opts   LockerOptions
+}
+
+// NewRedisLocker creates a new RedisLocker, it can share the client of a redis cache.
+func NewRedisLocker(client *rediscache.Client, opts LockerOptions) *RedisLocker {
+	return &RedisLocker{
+		client: client,
+		opts:   opts.withDefaults(),
+	}
+}
+
+// key returns the redis key of kind kept for the locked key.
+func (r *RedisLocker) key(kind, key string) string {
+	return r.opts.InternalPrefix + kind + key
+}
+
+func (r *RedisLocker) Lock(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	return lockLoop(ctx, r.opts.RetryInterval, func() (*Lock, error) {
+		return r.TryLock(ctx, key, ttl)
+	})
+}
+
+func (r *RedisLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	ttl, err := lockTTL(ttl)
+	if err != nil {
+		return nil, err
+	}
+	token, err := newLockToken()
+	if err != nil {
+		return nil, err
+	}
+	fence, err := acquireLockScript.Run(ctx, r.client, []string{r.key(redisLockPrefix, key), r.key(redisFencePrefix, key)}, token, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return nil, fmt.Errorf("locking key %s: %w", key, err)
+	}
+	if fence == 0 {
+		return nil, ErrLockNotAcquired
+	}
+
+	lock := newLock(key, token, fence)
+	if r.opts.AutoRenew {
+		go renew(lock, ttl, r.opts, r.Refresh)
+	}
+	return lock, nil
+}
+
+func (r *RedisLocker) Unlock(ctx context.Context, lock *Lock) error {
+	lock.stopRenewal()
+	released, err := releaseLockScript.Run(ctx, r.client, []string{r.key(redisLockPrefix, lock.Key)}, lock.Token).Int64()
+	if err != nil {
+		return fmt.Errorf("unlocking key %s: %w", lock.Key, err)
+	}
+	if released == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+func (r *RedisLocker) Refresh(ctx context.Context, lock *Lock, ttl time.Duration) error {
+	ttl, err := lockTTL(ttl)
+	if err != nil {
+		return err
+	}
+	refreshed, err := refreshLockScript.Run(ctx, r.client, []string{r.key(redisLockPrefix, lock.Key)}, lock.Token, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return fmt.Errorf("refreshing lock %s: %w", lock.Key, err)
+	}
+	if refreshed == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// MemoryLocker is an in-process Locker, to use in tests or in place of RedisLocker in a single process.
+type MemoryLocker struct {
+	opts  LockerOptions
+	table *memoryLockTable
+}
+
+// memoryLockTable holds the locks of a MemoryLocker.
+type memoryLockTable struct {
+	mu     sync.Mutex
+	locks  map[string]memoryLock
+	fences map[string]int64
+}
+
+type memoryLock struct {
+	token     string
+	expiresAt time.Time
+}
+
+// NewMemoryLocker creates a new MemoryLocker.
+func NewMemoryLocker(opts LockerOptions) *MemoryLocker {
+	return &MemoryLocker{
+		opts: opts.withDefaults(),
+		table: &memoryLockTable{
+			locks:  make(map[string]memoryLock),
+			fences: make(map[string]int64),
+		},
+	}
+}
+
+func (m *MemoryLocker) Lock(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	return lockLoop(ctx, m.opts.RetryInterval, func() (*Lock, error) {
+		return m.TryLock(ctx, key, ttl)
+	})
+}
+
+func (m *MemoryLocker) TryLock(_ context.Context, key string, ttl time.Duration) (*Lock, error) {
+	ttl, err := lockTTL(ttl)
+	if err != nil {
+		return nil, err
+	}
+	token, err := newLockToken()
+	if err != nil {
+		return nil, err
+	}
+
+	m.table.mu.Lock()
+	now := time.Now()
+	if held, found := m.table.locks[key]; found && held.expiresAt.After(now) {
+		m.table.mu.Unlock()
+		return nil, ErrLockNotAcquired
+	}
+	m.table.locks[key] = memoryLock{token: token, expiresAt: now.Add(ttl)}
+	m.table.fences[key]++
+	lock := newLock(key, token, m.table.fences[key])
+	m.table.mu.Unlock()
+
+	if m.opts.AutoRenew {
+		go renew(lock, ttl, m.opts, m.Refresh)
+	}
+	return lock, nil
+}
+
+func (m *MemoryLocker) Unlock(_ context.Context, lock *Lock) error {
+	lock.stopRenewal()
+
+	m.table.mu.Lock()
+	defer m.table.mu.Unlock()
+	if !m.holds(lock, time.Now()) {
+		return ErrLockNotHeld
+	}
+	delete(m.table.locks, lock.Key)
+	return nil
+}
+
+func (m *MemoryLocker) Refresh(_ context.Context, lock *Lock, ttl time.Duration) error {
+	ttl, err := lockTTL(ttl)
+	if err != nil {
+		return err
+	}
+	m.table.mu.Lock()
+	defer m.table.mu.Unlock()
+	now := time.Now()
+	if !m.holds(lock, now) {
+		return ErrLockNotHeld
+	}
+	m.table.locks[lock.Key] = memoryLock{token: lock.Token, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+// holds reports whether lock is still held, it must be called with the mutex held.
+func (m *MemoryLocker) holds(lock *Lock, now time.Time) bool {
+	held, found := m.table.locks[lock.Key]
+	return found && held.token == lock.Token && held.expiresAt.After(now)
+}
@@ -0,0 +1,168 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testLocker runs the Locker behaviors shared by the implementations, newLocker must return lockers
+// sharing their locks, like the replicas of a service. sleep lets the time elapse for the locks ttl.
+func testLocker(t *testing.T, newLocker func(opts LockerOptions) Locker, sleep func(d time.Duration)) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	t.Run("try lock", func(t *testing.T) {
+		first, second := newLocker(LockerOptions{}), newLocker(LockerOptions{})
+
+		lock, err := first.TryLock(ctx, "try", time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, "try", lock.Key)
+
+		_, err = second.TryLock(ctx, "try", time.Minute)
+		assert.ErrorIs(t, err, ErrLockNotAcquired)
+
+		require.NoError(t, first.Unlock(ctx, lock))
+		assert.ErrorIs(t, first.Unlock(ctx, lock), ErrLockNotHeld)
+
+		next, err := second.TryLock(ctx, "try", time.Minute)
+		require.NoError(t, err)
+		assert.Greater(t, next.Fence, lock.Fence, "the fence increases with every holder")
+		require.NoError(t, second.Unlock(ctx, next))
+	})
+
+	t.Run("expired lock", func(t *testing.T) {
+		first, second := newLocker(LockerOptions{}), newLocker(LockerOptions{})
+
+		lock, err := first.TryLock(ctx, "expired", 50*time.Millisecond)
+		require.NoError(t, err)
+		sleep(100 * time.Millisecond)
+
+		next, err := second.TryLock(ctx, "expired", time.Minute)
+		require.NoError(t, err)
+		assert.ErrorIs(t, first.Refresh(ctx, lock, time.Minute), ErrLockNotHeld)
+		assert.ErrorIs(t, first.Unlock(ctx, lock), ErrLockNotHeld, "a lock taken by someone else is not released")
+		require.NoError(t, second.Unlock(ctx, next))
+	})
+
+	t.Run("refresh", func(t *testing.T) {
+		first, second := newLocker(LockerOptions{}), newLocker(LockerOptions{})
+
+		lock, err := first.TryLock(ctx, "refresh", 100*time.Millisecond)
+		require.NoError(t, err)
+		require.NoError(t, first.Refresh(ctx, lock, time.Minute))
+		sleep(150 * time.Millisecond)
+
+		_, err = second.TryLock(ctx, "refresh", time.Minute)
+		assert.ErrorIs(t, err, ErrLockNotAcquired)
+		require.NoError(t, first.Unlock(ctx, lock))
+	})
+
+	t.Run("auto renew", func(t *testing.T) {
+		first, second := newLocker(LockerOptions{AutoRenew: true}), newLocker(LockerOptions{})
+
+		lock, err := first.TryLock(ctx, "renew", 150*time.Millisecond)
+		require.NoError(t, err)
+		time.Sleep(400 * time.Millisecond)
+
+		_, err = second.TryLock(ctx, "renew", time.Minute)
+		assert.ErrorIs(t, err, ErrLockNotAcquired)
+		require.NoError(t, first.Unlock(ctx, lock))
+		select {
+		case <-lock.Lost():
+			t.Fatal("an unlocked lock is not lost")
+		default:
+		}
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		locker := newLocker(LockerOptions{AutoRenew: true})
+
+		_, err := locker.TryLock(ctx, "ttl", 0)
+		assert.ErrorIs(t, err, ErrInvalidValue)
+		_, err = locker.Lock(ctx, "ttl", -time.Second)
+		assert.ErrorIs(t, err, ErrInvalidValue)
+
+		// a sub-millisecond ttl is rounded up rather than sent as 0ms or ticking every nanosecond
+		lock, err := locker.TryLock(ctx, "ttl", time.Nanosecond)
+		require.NoError(t, err)
+		assert.ErrorIs(t, locker.Refresh(ctx, lock, 0), ErrInvalidValue)
+		_ = locker.Unlock(ctx, lock)
+	})
+
+	t.Run("mutual exclusion", func(t *testing.T) {
+		var (
+			wg      sync.WaitGroup
+			mu      sync.Mutex
+			holders atomic.Int64
+			fences  []int64
+		)
+		for i := 0; i < 5; i++ {
+			locker := newLocker(LockerOptions{RetryInterval: time.Millisecond})
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				lock, err := locker.Lock(ctx, "mutex", time.Minute)
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.EqualValues(t, 1, holders.Add(1), "only one holder at a time")
+				mu.Lock()
+				fences = append(fences, lock.Fence)
+				mu.Unlock()
+				time.Sleep(5 * time.Millisecond)
+				holders.Add(-1)
+				assert.NoError(t, locker.Unlock(ctx, lock))
+			}()
+		}
+		wg.Wait()
+
+		require.Len(t, fences, 5)
+		assert.IsIncreasing(t, fences)
+	})
+
+	t.Run("lock waits for the context", func(t *testing.T) {
+		first, second := newLocker(LockerOptions{}), newLocker(LockerOptions{})
+
+		lock, err := first.TryLock(ctx, "wait", time.Minute)
+		require.NoError(t, err)
+
+		waitCtx, waitCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer waitCancel()
+		_, err = second.Lock(waitCtx, "wait", time.Minute)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		require.NoError(t, first.Unlock(ctx, lock))
+	})
+}
+
+func TestMemoryLocker(t *testing.T) {
+	shared := NewMemoryLocker(LockerOptions{})
+	testLocker(t, func(opts LockerOptions) Locker {
+		// the lockers share their locks, with their own options
+		locker := NewMemoryLocker(opts)
+		locker.table = shared.table
+		return locker
+	}, time.Sleep)
+
+	t.Run("lost", func(t *testing.T) {
+		locker := NewMemoryLocker(LockerOptions{AutoRenew: true})
+		lock, err := locker.TryLock(context.Background(), "lost", 30*time.Millisecond)
+		require.NoError(t, err)
+
+		// the lock is taken over while its holder is paused
+		locker.table.mu.Lock()
+		locker.table.locks["lost"] = memoryLock{token: "other", expiresAt: time.Now().Add(time.Minute)}
+		locker.table.mu.Unlock()
+
+		select {
+		case <-lock.Lost():
+		case <-time.After(time.Second):
+			t.Fatal("the renewal should report the lost lock")
+		}
+	})
+}
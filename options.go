@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"reflect"
+	"time"
+)
+
+// Option configures the optional behaviour of a cache backend,
+// options a backend does not support are ignored by it.
+type Option func(*options)
+
+type options struct {
+	janitorInterval time.Duration
+	onExpire        func(key, value any)
+	maxBytes        int64
+	sizer           Sizer
+	policy          EvictionPolicy
+	codec           Codec
+	sliding         bool
+	maxLifetime     time.Duration
+	jitterFraction  float64
+	jitterMin       time.Duration
+	jitterMax       time.Duration
+	seed            int64
+	seeded          bool
+	jitter          *ttlJitter
+	retryPolicy     *RetryPolicy
+	retry           *retrier
+	timeouts        Timeouts
+	internalPrefix  string
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.sizer == nil {
+		o.sizer = defaultSizer
+	}
+	if o.codec == nil {
+		o.codec = &JsonCodec{}
+	}
+	if o.internalPrefix == "" {
+		o.internalPrefix = defaultInternalPrefix
+	}
+	o.jitter = newTTLJitter(o)
+	o.retry = newRetrier(o)
+	return o
+}
+
+// WithJanitor removes the expired entries every interval instead of waiting for them to be read,
+// the janitor is stopped on Close. It applies to the in-process caches, and sets the compaction interval
+// of the disk caches.
+func WithJanitor(interval time.Duration) Option {
+	return func(o *options) {
+		o.janitorInterval = interval
+	}
+}
+
+// WithExpiryCallback calls fn with every entry removed from the cache because its ttl elapsed,
+// combine it with WithJanitor to be notified close to the expiration. It applies to the in-process caches.
+func WithExpiryCallback(fn func(key, value any)) Option {
+	return func(o *options) {
+		o.onExpire = fn
+	}
+}
+
+// Sizer returns the cost in bytes of an entry.
+type Sizer func(key, value any) int64
+
+// defaultSizer measures byte slices and strings by their length,
+// any other value by the shallow size of its type.
+func defaultSizer(_, value any) int64 {
+	switch v := value.(type) {
+	case []byte:
+		return int64(len(v))
+	case string:
+		return int64(len(v))
+	case nil:
+		return 0
+	default:
+		return int64(reflect.TypeOf(v).Size())
+	}
+}
+
+// WithMaxBytes bounds the cache by the total size of its entries instead of their count,
+// the entries are evicted following the cache policy until the total fits into maxBytes.
+// It applies to the in-process caches.
+func WithMaxBytes(maxBytes int64) Option {
+	return func(o *options) {
+		o.maxBytes = maxBytes
+	}
+}
+
+// WithSizer sets how the size of the entries is computed for WithMaxBytes,
+// byte slices and strings are measured by their length by default.
+func WithSizer(sizer Sizer) Option {
+	return func(o *options) {
+		o.sizer = sizer
+	}
+}
+
+// WithCodec sets the codec used to serialize the entries of an in-process cache snapshot, json by default.
+func WithCodec(codec Codec) Option {
+	return func(o *options) {
+		o.codec = codec
+	}
+}
+
+// WithSlidingExpiration extends the ttl of an entry every time it's read, so it lives as long as it's used.
+// The ttl is reset to the ttl the entry was set with, an entry without expiration keeps none, and never beyond
+// maxLifetime after the entry was set, 0 means no limit.
+// It applies to RedisSimpleCache and the in-process caches.
+func WithSlidingExpiration(maxLifetime time.Duration) Option {
+	return func(o *options) {
+		o.sliding = true
+		o.maxLifetime = maxLifetime
+	}
+}
+
+// defaultInternalPrefix starts with a NUL byte so the internal keys can't collide with the keys of the entries.
+const defaultInternalPrefix = "\x00icache:"
+
+// WithInternalPrefix sets the namespace of the keys the redis backends keep next to the entries, "\x00icache:" by default.
+// The keys of the entries must not start with it.
+func WithInternalPrefix(prefix string) Option {
+	return func(o *options) {
+		o.internalPrefix = prefix
+	}
+}
+
+// internalKey returns the internal key of kind kept for key.
+func (o *options) internalKey(kind, key string) string {
+	return o.internalPrefix + kind + key
+}
@@ -0,0 +1,365 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	rediscache "github.com/go-redis/redis/v8"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	_ PatternDeleter = (*redisCache)(nil)
+	_ PatternDeleter = (*RedisSimpleCache)(nil)
+	_ PatternDeleter = (*memLibCache)(nil)
+	_ PatternDeleter = (*TypedLibCache[string, string])(nil)
+	_ PatternDeleter = (*shardedMemCache)(nil)
+	_ PatternDeleter = (*ShardedCache[string, string])(nil)
+	_ PatternDeleter = (*diskCache)(nil)
+	_ PatternDeleter = (*DiskSimpleCache)(nil)
+)
+
+// PatternDeleter is implemented by the caches able to delete keys without knowing them exactly.
+// The keys are compared by their string representation, as redis stores them.
+type PatternDeleter interface {
+	// DelPrefix deletes the keys starting with prefix and returns how many were deleted.
+	DelPrefix(ctx context.Context, prefix string) (n int, err error)
+	// DelPattern deletes the keys matching the redis glob pattern and returns how many were deleted.
+	// The pattern supports *, ?, [abc], [^abc], [a-z] and \ to escape a special character.
+	DelPattern(ctx context.Context, pattern string) (n int, err error)
+}
+
+// patternBatch is the number of keys deleted at once: per SCAN page on redis,
+// per lock or transaction on the local caches. ctx is checked between two batches.
+const patternBatch = 1000
+
+// matchGlob reports whether s matches the redis glob pattern, a malformed pattern matches nothing.
+func matchGlob(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchGlob(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		case '[':
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 || len(s) == 0 || !matchClass(pattern[1:end+1], s[0]) {
+				return false
+			}
+			pattern = pattern[end+1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		s = s[1:]
+	}
+	return len(s) == 0
+}
+
+// matchClass reports whether c belongs to a [class], given without its brackets.
+func matchClass(class string, c byte) bool {
+	negate := len(class) > 0 && class[0] == '^'
+	if negate {
+		class = class[1:]
+	}
+	for i := 0; i < len(class); i++ {
+		switch {
+		case class[i] == '\\' && i+1 < len(class):
+			i++
+			if class[i] == c {
+				return !negate
+			}
+		case i+2 < len(class) && class[i+1] == '-':
+			lo, hi := class[i], class[i+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if lo <= c && c <= hi {
+				return !negate
+			}
+			i += 2
+		case class[i] == c:
+			return !negate
+		}
+	}
+	return negate
+}
+
+// escapeGlob escapes the glob special characters of s, so it's matched literally.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// redisDelPattern deletes the keys matching pattern with SCAN, so redis is never blocked by a large keyspace,
+// and del, which returns how many keys it deleted. The internal keys of the caches, under the internal prefix, are skipped.
+func redisDelPattern(ctx context.Context, client *rediscache.Client, opts *options, pattern string,
+	del func(ctx context.Context, keys []string) (int, error)) (n int, err error) {
+	var cursor uint64
+	for {
+		if err = ctx.Err(); err != nil {
+			return n, err
+		}
+		var keys []string
+		err = opts.do(ctx, opRead, func(ctx context.Context) (err error) {
+			keys, cursor, err = client.Scan(ctx, cursor, pattern, patternBatch).Result()
+			return err
+		})
+		if err != nil {
+			return n, fmt.Errorf("scanning %s: %w", pattern, err)
+		}
+		entries := keys[:0]
+		for _, key := range keys {
+			if !strings.HasPrefix(key, opts.internalPrefix) {
+				entries = append(entries, key)
+			}
+		}
+		if len(entries) > 0 {
+			deleted, err := del(ctx, entries)
+			n += deleted
+			if err != nil {
+				return n, fmt.Errorf("deleting keys: %w", err)
+			}
+		}
+		if cursor == 0 {
+			return n, nil
+		}
+	}
+}
+
+// unlink deletes keys with UNLINK, which frees the values in the background.
+func (r *redisCache) unlink(ctx context.Context, keys []string) (n int, err error) {
+	err = r.opts.do(ctx, opWrite, func(ctx context.Context) error {
+		deleted, err := r.client.Unlink(ctx, keys...).Result()
+		n = int(deleted)
+		return err
+	})
+	return n, err
+}
+
+func (r *redisCache) DelPrefix(ctx context.Context, prefix string) (n int, err error) {
+	defer wrapCacheError(&err, backendRedis, "del prefix", prefix)
+	return redisDelPattern(ctx, r.client, &r.opts, escapeGlob(prefix)+"*", r.unlink)
+}
+
+func (r *redisCache) DelPattern(ctx context.Context, pattern string) (n int, err error) {
+	defer wrapCacheError(&err, backendRedis, "del pattern", pattern)
+	return redisDelPattern(ctx, r.client, &r.opts, pattern, r.unlink)
+}
+
+// delKeys deletes keys along with their tags and sliding expiration, see del.
+func (r *RedisSimpleCache) delKeys(ctx context.Context, keys []string) (n int, err error) {
+	return r.del(ctx, keys...)
+}
+
+func (r *RedisSimpleCache) DelPrefix(ctx context.Context, prefix string) (n int, err error) {
+	defer wrapCacheError(&err, backendRedis, "del prefix", prefix)
+	return redisDelPattern(ctx, r.client, &r.opts, escapeGlob(prefix)+"*", r.delKeys)
+}
+
+func (r *RedisSimpleCache) DelPattern(ctx context.Context, pattern string) (n int, err error) {
+	defer wrapCacheError(&err, backendRedis, "del pattern", pattern)
+	return redisDelPattern(ctx, r.client, &r.opts, pattern, r.delKeys)
+}
+
+func (l *TypedLibCache[K, T]) DelPrefix(ctx context.Context, prefix string) (n int, err error) {
+	defer wrapCacheError(&err, backendLibcache, "del prefix", prefix)
+	return l.delMatching(ctx, func(key string) bool {
+		return strings.HasPrefix(key, prefix)
+	})
+}
+
+func (l *TypedLibCache[K, T]) DelPattern(ctx context.Context, pattern string) (n int, err error) {
+	defer wrapCacheError(&err, backendLibcache, "del pattern", pattern)
+	return l.delMatching(ctx, func(key string) bool {
+		return matchGlob(pattern, key)
+	})
+}
+
+// delMatching deletes the keys matched by match, taking the lock once per batch
+// so the other operations can go on while a large cache is iterated.
+func (l *TypedLibCache[K, T]) delMatching(ctx context.Context, match func(key string) bool) (n int, err error) {
+	l.lock()
+	keys := l.cache.Keys()
+	l.unlock()
+
+	for len(keys) > 0 {
+		if err = ctx.Err(); err != nil {
+			return n, err
+		}
+		batch := keys
+		if len(batch) > patternBatch {
+			batch = batch[:patternBatch]
+		}
+		keys = keys[len(batch):]
+
+		l.lock()
+		for _, key := range batch {
+			if k, err := keyToString(key); err != nil || !match(k) {
+				continue
+			}
+			// the key may have been removed since it was listed
+			if _, found := l.cache.Peek(key); found {
+				l.cache.Delete(key)
+				n++
+			}
+		}
+		l.unlock()
+	}
+	return n, nil
+}
+
+func (l *memLibCache) DelPrefix(ctx context.Context, prefix string) (n int, err error) {
+	return l.cache.DelPrefix(ctx, prefix)
+}
+
+func (l *memLibCache) DelPattern(ctx context.Context, pattern string) (n int, err error) {
+	return l.cache.DelPattern(ctx, pattern)
+}
+
+func (c *ShardedCache[K, V]) DelPrefix(ctx context.Context, prefix string) (n int, err error) {
+	defer wrapCacheError(&err, backendSharded, "del prefix", prefix)
+	return c.delMatching(ctx, func(key string) bool {
+		return strings.HasPrefix(key, prefix)
+	})
+}
+
+func (c *ShardedCache[K, V]) DelPattern(ctx context.Context, pattern string) (n int, err error) {
+	defer wrapCacheError(&err, backendSharded, "del pattern", pattern)
+	return c.delMatching(ctx, func(key string) bool {
+		return matchGlob(pattern, key)
+	})
+}
+
+// delMatching deletes the keys matched by match, one shard at a time. The expired entries are deleted as well,
+// not counted but reported to the expiry callback.
+func (c *ShardedCache[K, V]) delMatching(ctx context.Context, match func(key string) bool) (n int, err error) {
+	now := time.Now().UnixNano()
+	for _, s := range c.shards {
+		if err = ctx.Err(); err != nil {
+			return n, err
+		}
+		var expired []expiredEntry[K, V]
+		s.mu.Lock()
+		for key, e := range s.entries {
+			if k, err := keyToString(key); err != nil || !match(k) {
+				continue
+			}
+			if e.expired(now) {
+				expired = append(expired, expiredEntry[K, V]{key: key, value: e.value})
+			} else {
+				n++
+			}
+			s.remove(key, e)
+		}
+		s.mu.Unlock()
+		c.notifyExpired(expired)
+	}
+	return n, nil
+}
+
+func (s *shardedMemCache) DelPrefix(ctx context.Context, prefix string) (n int, err error) {
+	return s.cache.DelPrefix(ctx, prefix)
+}
+
+func (s *shardedMemCache) DelPattern(ctx context.Context, pattern string) (n int, err error) {
+	return s.cache.DelPattern(ctx, pattern)
+}
+
+// delMatching deletes the keys starting with prefix and matched by match, in one transaction per batch.
+// The expired entries are deleted as well, but not counted.
+func (s *diskStore) delMatching(ctx context.Context, prefix []byte, match func(key string) bool) (n int, err error) {
+	start := prefix
+	for {
+		if err = ctx.Err(); err != nil {
+			return n, err
+		}
+		var next [][]byte
+		now := time.Now().UnixNano()
+		err = s.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket(diskBucket)
+			var matched [][]byte
+			c := b.Cursor()
+			scanned := 0
+			for k, v := c.Seek(start); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+				if scanned == patternBatch {
+					next = append(next, append([]byte(nil), k...))
+					break
+				}
+				scanned++
+				if !match(string(k)) {
+					continue
+				}
+				if _, found := decodeDiskValue(v, now); found {
+					n++
+				}
+				matched = append(matched, append([]byte(nil), k...))
+			}
+			// the keys are deleted once the iteration is done, deleting under a cursor skips keys
+			for _, k := range matched {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil || len(next) == 0 {
+			return n, err
+		}
+		start = next[0]
+	}
+}
+
+func (d *diskCache) DelPrefix(ctx context.Context, prefix string) (n int, err error) {
+	return d.store.delMatching(ctx, []byte(prefix), func(string) bool {
+		return true
+	})
+}
+
+func (d *diskCache) DelPattern(ctx context.Context, pattern string) (n int, err error) {
+	return d.store.delMatching(ctx, nil, func(key string) bool {
+		return matchGlob(pattern, key)
+	})
+}
+
+func (d *DiskSimpleCache) DelPrefix(ctx context.Context, prefix string) (n int, err error) {
+	return d.store.delMatching(ctx, []byte(prefix), func(string) bool {
+		return true
+	})
+}
+
+func (d *DiskSimpleCache) DelPattern(ctx context.Context, pattern string) (n int, err error) {
+	return d.store.delMatching(ctx, nil, func(key string) bool {
+		return matchGlob(pattern, key)
+	})
+}
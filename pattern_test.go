@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shaj13/libcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern, s string
+		match      bool
+	}{
+		{"*", "", true},
+		{"market:*", "market:INJ/USDT", true},
+		{"market:*", "markets", false},
+		{"*:USDT", "market:INJ:USDT", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"h[ello", "hello", false},
+		{escapeGlob("a*[b]?") + "*", "a*[b]?c", true},
+		{escapeGlob("a*[b]?") + "*", "ab", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.match, matchGlob(c.pattern, c.s), "%q %q", c.pattern, c.s)
+	}
+}
+
+func TestPatternDeleter(t *testing.T) {
+	ctx := context.Background()
+
+	caches := map[string]func(t *testing.T) (PatternDeleter, TTLCache){
+		"TypedLibCache": func(t *testing.T) (PatternDeleter, TTLCache) {
+			cache := NewTypedLibCache[string, int](libcache.LRU.New(0), time.Minute)
+			return cache, cache
+		},
+		"ShardedCache": func(t *testing.T) (PatternDeleter, TTLCache) {
+			cache, err := NewShardedCache[string, int](4, 0, time.Minute)
+			require.NoError(t, err)
+			return cache, cache
+		},
+		"DiskSimpleCache": func(t *testing.T) (PatternDeleter, TTLCache) {
+			cache, err := NewDiskSimpleCache(filepath.Join(t.TempDir(), "cache.db"), nil, time.Minute)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				_ = cache.Close()
+			})
+			return cache, cache
+		},
+	}
+
+	for name, newCache := range caches {
+		t.Run(name, func(t *testing.T) {
+			deleter, cache := newCache(t)
+			for i := 0; i < 2*patternBatch+10; i++ {
+				require.NoError(t, cache.Set(ctx, fmt.Sprintf("market:%d", i), i))
+			}
+			require.NoError(t, cache.Set(ctx, "subaccount:1:orders", 1))
+			require.NoError(t, cache.Set(ctx, "subaccount:2:orders", 2))
+			require.NoError(t, cache.Set(ctx, "subaccount:2:trades", 3))
+			require.NoError(t, cache.SetWithTTL(ctx, "subaccount:3:orders", 4, time.Millisecond))
+			time.Sleep(2 * time.Millisecond)
+
+			n, err := deleter.DelPrefix(ctx, "market:")
+			require.NoError(t, err)
+			assert.Equal(t, 2*patternBatch+10, n)
+			assert.ErrorIs(t, cache.Get(ctx, "market:1", new(int)), ErrCacheMiss)
+
+			n, err = deleter.DelPattern(ctx, "subaccount:*:orders")
+			require.NoError(t, err)
+			assert.Equal(t, 2, n)
+			assert.ErrorIs(t, cache.Get(ctx, "subaccount:1:orders", new(int)), ErrCacheMiss)
+			assert.NoError(t, cache.Get(ctx, "subaccount:2:trades", new(int)))
+
+			canceled, cancel := context.WithCancel(ctx)
+			cancel()
+			_, err = deleter.DelPattern(canceled, "*")
+			assert.ErrorIs(t, err, context.Canceled)
+		})
+	}
+}
+
+func TestShardedCacheDelPatternExpiryCallback(t *testing.T) {
+	ctx := context.Background()
+
+	var expired []any
+	cache, err := NewShardedCache[string, int](1, 0, time.Minute, WithExpiryCallback(func(key, value any) {
+		expired = append(expired, key)
+	}))
+	require.NoError(t, err)
+	require.NoError(t, cache.Set(ctx, "live", 1))
+	require.NoError(t, cache.SetWithTTL(ctx, "expired", 2, time.Millisecond))
+	time.Sleep(2 * time.Millisecond)
+
+	n, err := cache.DelPattern(ctx, "*")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []any{"expired"}, expired, "the expired entries dropped are reported")
+}
+
+func TestPatternDeleterCache(t *testing.T) {
+	ctx := context.Background()
+
+	libcache, err := NewLibcache(0, time.Minute)
+	require.NoError(t, err)
+	sharded, err := NewShardedMemCache(0, 0, time.Minute)
+	require.NoError(t, err)
+	disk, err := NewDiskCache(filepath.Join(t.TempDir(), "cache.db"), time.Minute)
+	require.NoError(t, err)
+	defer disk.Close()
+
+	for name, cache := range map[string]Cache{"Libcache": libcache, "ShardedMemCache": sharded, "DiskCache": disk} {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, cache.BatchSet(ctx, "key1", []byte("value1"), "key2", []byte("value2"), "other", []byte("value")))
+
+			n, err := cache.(PatternDeleter).DelPrefix(ctx, "key")
+			require.NoError(t, err)
+			assert.Equal(t, 2, n)
+
+			values, err := cache.BatchGet(ctx, "key1", "key2", "other")
+			require.NoError(t, err)
+			assert.Equal(t, [][]byte{nil, nil, []byte("value")}, values)
+		})
+	}
+}
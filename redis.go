@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	rediscache "github.com/go-redis/redis/v8"
@@ -16,16 +18,18 @@ var (
 type redisCache struct {
 	client *rediscache.Client
 	ttl    time.Duration
+	opts   options
 }
 
-func NewRedisCacheWithClient(ctx context.Context, client *rediscache.Client, ttl time.Duration) *redisCache {
+func NewRedisCacheWithClient(ctx context.Context, client *rediscache.Client, ttl time.Duration, opts ...Option) *redisCache {
 	return &redisCache{
 		client: client,
 		ttl:    ttl,
+		opts:   newOptions(opts),
 	}
 }
 
-func NewRedisCache(ctx context.Context, cacheURL string, ttl time.Duration) (*redisCache, error) {
+func NewRedisCache(ctx context.Context, cacheURL string, ttl time.Duration, opts ...Option) (*redisCache, error) {
 	// only 1 cache for now, no need for ring
 	client := rediscache.NewClient(&rediscache.Options{
 		Addr: cacheURL,
@@ -37,7 +41,7 @@ func NewRedisCache(ctx context.Context, cacheURL string, ttl time.Duration) (*re
 		return nil, fmt.Errorf("redis cache err: %w", err)
 	}
 
-	c := NewRedisCacheWithClient(ctx, client, ttl)
+	c := NewRedisCacheWithClient(ctx, client, ttl, opts...)
 
 	return c, nil
 }
@@ -46,21 +50,25 @@ func (r *redisCache) Set(ctx context.Context, key string, value []byte) error {
 	return r.SetCtx(ctx, key, value)
 }
 
-func (r *redisCache) SetCtx(ctx context.Context, key string, value []byte) error {
-	status := r.client.Set(ctx, key, value, r.ttl)
-	if err := status.Err(); err != nil {
-		return err
-	}
-	return nil
+func (r *redisCache) SetCtx(ctx context.Context, key string, value []byte) (err error) {
+	defer wrapCacheError(&err, backendRedis, "set", key)
+	return r.opts.do(ctx, opWrite, func(ctx context.Context) error {
+		return r.client.Set(ctx, key, value, r.opts.jitter.apply(r.ttl)).Err()
+	})
 }
 
 func (r *redisCache) Get(ctx context.Context, key string) ([]byte, error) {
 	return r.GetCtx(ctx, key)
 }
 
-func (r *redisCache) GetCtx(ctx context.Context, key string) ([]byte, error) {
-	result := r.client.Get(ctx, key)
-	if err := result.Err(); err != nil {
+func (r *redisCache) GetCtx(ctx context.Context, key string) (_ []byte, err error) {
+	defer wrapCacheError(&err, backendRedis, "get", key)
+	var result *rediscache.StringCmd
+	err = r.opts.do(ctx, opRead, func(ctx context.Context) error {
+		result = r.client.Get(ctx, key)
+		return result.Err()
+	})
+	if err != nil {
 		if err == rediscache.Nil {
 			return nil, ErrCacheMiss
 		}
@@ -73,12 +81,11 @@ func (r *redisCache) Del(ctx context.Context, key string) error {
 	return r.DelCtx(ctx, key)
 }
 
-func (r *redisCache) DelCtx(ctx context.Context, key string) error {
-	status := r.client.Del(ctx, key)
-	if err := status.Err(); err != nil {
-		return err
-	}
-	return nil
+func (r *redisCache) DelCtx(ctx context.Context, key string) (err error) {
+	defer wrapCacheError(&err, backendRedis, "del", key)
+	return r.opts.do(ctx, opWrite, func(ctx context.Context) error {
+		return r.client.Del(ctx, key).Err()
+	})
 }
 
 func (r *redisCache) BatchGet(ctx context.Context, keys ...string) (cachedValues [][]byte, err error) {
@@ -86,8 +93,17 @@ func (r *redisCache) BatchGet(ctx context.Context, keys ...string) (cachedValues
 }
 
 func (r *redisCache) BatchGetCtx(ctx context.Context, keys ...string) (cachedValues [][]byte, err error) {
-	slice := r.client.MGet(ctx, keys...)
-	if err := slice.Err(); err != nil {
+	defer wrapCacheError(&err, backendRedis, "batch get", nil)
+	if len(keys) == 0 {
+		// MGET needs a key at least
+		return nil, nil
+	}
+	var slice *rediscache.SliceCmd
+	err = r.opts.do(ctx, opBatch, func(ctx context.Context) error {
+		slice = r.client.MGet(ctx, keys...)
+		return slice.Err()
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -117,42 +133,46 @@ func (r *redisCache) BatchSet(ctx context.Context, keyvalues ...any) error {
 	return r.BatchSetCtx(ctx, keyvalues...)
 }
 
-func (r *redisCache) BatchSetCtx(ctx context.Context, keyvalues ...any) error {
+func (r *redisCache) BatchSetCtx(ctx context.Context, keyvalues ...any) (err error) {
+	defer wrapCacheError(&err, backendRedis, "batch set", nil)
 	if len(keyvalues)%2 != 0 {
-		return errors.New("keyvalues len must be even")
+		return oddKeyValues(len(keyvalues))
 	}
 
-	// since atm redis MSET does not support set value with ttl
-	// => use TxPipeline instead, it's atomic on redis server
-	// however the pipeline should be short to make sure it does not block server so long
-	pipeline := r.client.TxPipeline()
 	for i := 0; i < len(keyvalues); i += 2 {
-		key, ok := keyvalues[i].(string)
-		if !ok {
+		if _, ok := keyvalues[i].(string); !ok {
 			return fmt.Errorf("%w at index %d: expected string, got %T", ErrInvalidKey, i, keyvalues[i])
 		}
 
-		value, ok := keyvalues[i+1].([]byte)
-		if !ok {
-			return fmt.Errorf("%w at index %d: expected []byte, got %T", ErrInvalidValue, i, keyvalues[i])
+		if _, ok := keyvalues[i+1].([]byte); !ok {
+			return fmt.Errorf("%w at index %d: expected []byte, got %T", ErrInvalidValue, i+1, keyvalues[i+1])
 		}
-
-		pipeline.Set(ctx, key, value, r.ttl)
 	}
 
-	// exec the command
-	statuses, err := pipeline.Exec(ctx)
-	if err != nil {
-		return err
-	}
+	// the transaction is built again for every attempt
+	return r.opts.do(ctx, opBatch, func(ctx context.Context) error {
+		// since atm redis MSET does not support set value with ttl
+		// => use TxPipeline instead, it's atomic on redis server
+		// however the pipeline should be short to make sure it does not block server so long
+		pipeline := r.client.TxPipeline()
+		for i := 0; i < len(keyvalues); i += 2 {
+			pipeline.Set(ctx, keyvalues[i].(string), keyvalues[i+1].([]byte), r.opts.jitter.apply(r.ttl))
+		}
 
-	for _, s := range statuses {
-		if err = s.Err(); err != nil {
+		// exec the command
+		statuses, err := pipeline.Exec(ctx)
+		if err != nil {
 			return err
 		}
-	}
 
-	return nil
+		for _, s := range statuses {
+			if err = s.Err(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 }
 
 func (r *redisCache) Close() error {
@@ -181,10 +201,13 @@ type RedisSimpleCache struct {
 	// codec allows to specify a custom codec for encoding/decoding values
 	// json is used by default
 	codec Codec
+	opts  options
+	// tagged is set by the first SetWithTags, from then on Del removes the keys from their tags
+	tagged atomic.Bool
 }
 
 // NewRedisSimpleCache creates a new RedisSimpleCache instance
-func NewRedisSimpleCache(client *rediscache.Client, codec Codec, ttl time.Duration) *RedisSimpleCache {
+func NewRedisSimpleCache(client *rediscache.Client, codec Codec, ttl time.Duration, opts ...Option) *RedisSimpleCache {
 	if codec == nil {
 		codec = &JsonCodec{}
 	}
@@ -192,6 +215,7 @@ func NewRedisSimpleCache(client *rediscache.Client, codec Codec, ttl time.Durati
 		client: client,
 		ttl:    ttl,
 		codec:  codec,
+		opts:   newOptions(opts),
 	}
 }
 
@@ -200,59 +224,114 @@ func (r *RedisSimpleCache) Set(ctx context.Context, key any, value any) (err err
 }
 
 func (r *RedisSimpleCache) SetWithTTL(ctx context.Context, key any, value any, ttl time.Duration) (err error) {
+	defer wrapCacheError(&err, backendRedis, "set", key)
 	k, err := keyToString(key)
 	if err != nil {
 		return err
 	}
 	data, err := r.codec.Encode(value)
 	if err != nil {
-		return ErrInvalidValue
+		return &codecError{sentinel: ErrEncode, err: err}
 	}
-	status := r.client.Set(ctx, k, data, ttl)
-	if err = status.Err(); err != nil {
-		return fmt.Errorf("setting key %s: %w", k, err)
-	}
-	return nil
+	return r.set(ctx, k, data, ttl)
 }
 
 func (r *RedisSimpleCache) Get(ctx context.Context, key any, value any) (err error) {
+	defer wrapCacheError(&err, backendRedis, "get", key)
 	k, err := keyToString(key)
 	if err != nil {
 		return err
 	}
-	data, err := r.client.Get(ctx, k).Bytes()
+	data, err := r.get(ctx, k)
 	if errors.Is(err, rediscache.Nil) {
 		return ErrCacheMiss
 	}
 	if err != nil {
-		return fmt.Errorf("getting key %s: %w", k, err)
+		return err
 	}
 
 	err = r.codec.Decode(data, value)
 	if err != nil {
-		return fmt.Errorf("decoding %s value: %w", k, err)
+		return &codecError{sentinel: ErrDecode, err: err}
 	}
 	return nil
 }
 
 func (r *RedisSimpleCache) Del(ctx context.Context, keys ...any) (err error) {
+	defer wrapCacheError(&err, backendRedis, "del", singleKey(keys))
 	ks, err := keysToString(keys...)
 	if err != nil {
 		return err
 	}
-	status := r.client.Del(ctx, ks...)
-	if err = status.Err(); err != nil {
-		return fmt.Errorf("deleting keys: %w", err)
+	_, err = r.del(ctx, ks...)
+	return err
+}
+
+// BatchSet sets several key values with the default ttl, in a single transaction.
+func (r *RedisSimpleCache) BatchSet(ctx context.Context, keyvalues ...any) (err error) {
+	defer wrapCacheError(&err, backendRedis, "batch set", nil)
+	if len(keyvalues)%2 != 0 {
+		return oddKeyValues(len(keyvalues))
 	}
-	return nil
+	keys := make([]string, 0, len(keyvalues)/2)
+	values := make([][]byte, 0, len(keyvalues)/2)
+	for i := 0; i < len(keyvalues); i += 2 {
+		k, err := keyToString(keyvalues[i])
+		if err != nil {
+			return fmt.Errorf("%w at index %d", err, i)
+		}
+		data, err := r.codec.Encode(keyvalues[i+1])
+		if err != nil {
+			return &codecError{sentinel: ErrEncode, err: err}
+		}
+		keys = append(keys, k)
+		values = append(values, data)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return r.opts.do(ctx, opBatch, func(ctx context.Context) error {
+		err := r.batchSetOnce(ctx, keys, values)
+		if err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT ") {
+			// the script isn't cached by redis yet, it can't be loaded from within the transaction
+			if err = writeScript.Load(ctx, r.client).Err(); err != nil {
+				return err
+			}
+			err = r.batchSetOnce(ctx, keys, values)
+		}
+		return err
+	})
+}
+
+func (r *RedisSimpleCache) batchSetOnce(ctx context.Context, keys []string, values [][]byte) error {
+	now := time.Now()
+	pipeline := r.client.TxPipeline()
+	for i, key := range keys {
+		ttl := r.opts.jitter.apply(r.ttl)
+		if !r.opts.sliding {
+			pipeline.Set(ctx, key, values[i], ttl)
+			continue
+		}
+		writeScript.EvalSha(ctx, pipeline, r.writeKeys(key, nil)[:2], r.writeArgs(values[i], ttl, now)...)
+	}
+	_, err := pipeline.Exec(ctx)
+	return err
 }
 
 func (r *RedisSimpleCache) Clear(ctx context.Context) (err error) {
-	status := r.client.FlushDB(ctx)
-	if err = status.Err(); err != nil {
-		return fmt.Errorf("clearing cache: %w", err)
+	defer wrapCacheError(&err, backendRedis, "clear", nil)
+	return r.opts.do(ctx, opBatch, func(ctx context.Context) error {
+		return r.client.FlushDB(ctx).Err()
+	})
+}
+
+// IsRunning reports whether redis answers a ping.
+func (r *RedisSimpleCache) IsRunning(ctx context.Context) bool {
+	if r.client == nil {
+		return false
 	}
-	return nil
+	return r.client.Ping(ctx).Err() == nil
 }
 
 // keyToString converts a key to a string
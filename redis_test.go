@@ -1,32 +1,36 @@
-//go:build integration
-
 package cache
 
 import (
 	"context"
-	"os"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/InjectiveLabs/injective-cache/internal/redistest"
 	"github.com/go-redis/redis/v8"
+	"github.com/shaj13/libcache"
+	_ "github.com/shaj13/libcache/lru"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-var defaultRedisURL = "localhost:6379"
+// newRedisClient returns a client of the redis server of the test, see redistest.
+func newRedisClient(t *testing.T) (*redis.Client, *redistest.Server) {
+	server := redistest.Start(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr, DB: server.DB})
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return client, server
+}
 
 func TestRedisSimpleCache(t *testing.T) {
 	ctx := context.Background()
 
-	redisURL := os.Getenv("REDIS_URL")
-	if redisURL == "" {
-		redisURL = defaultRedisURL
-	}
-
-	redisClient := redis.NewClient(&redis.Options{Addr: redisURL})
-	_, err := redisClient.Ping(ctx).Result()
-	require.NoError(t, err)
-	redisClient.FlushAll(ctx)
+	redisClient, server := newRedisClient(t)
 
 	ttl := time.Minute
 	simpleRedisCache := NewRedisSimpleCache(redisClient, nil, ttl)
@@ -58,7 +62,7 @@ func TestRedisSimpleCache(t *testing.T) {
 		assert.Equal(t, value.Value, retrievedValue.Value)
 		assert.IsType(t, &valueStruct{}, retrievedValue)
 
-		time.Sleep(time.Millisecond * 300)
+		server.FastForward(time.Millisecond * 300)
 
 		retrievedValue, err = Get[*valueStruct](ctx, simpleRedisCache, key)
 		require.ErrorIs(t, err, ErrCacheMiss)
@@ -105,9 +109,569 @@ func TestRedisSimpleCache(t *testing.T) {
 		err := simpleRedisCache.SetWithTTL(ctx, key, value, ttl)
 		require.NoError(t, err)
 
-		time.Sleep(ttl * 2)
+		server.FastForward(ttl * 2)
 
 		err = simpleRedisCache.Get(ctx, key, nil)
 		assert.ErrorIs(t, err, ErrCacheMiss)
 	})
 }
+
+func TestRedisSimpleCacheBatchSet(t *testing.T) {
+	ctx := context.Background()
+
+	redisClient, _ := newRedisClient(t)
+	cache := NewRedisSimpleCache(redisClient, nil, time.Minute)
+
+	require.NoError(t, cache.BatchSet(ctx, "key1", "value1", 2, "value2"))
+	for key, expected := range map[string]string{"key1": "value1", "2": "value2"} {
+		value, err := Get[string](ctx, cache, key)
+		require.NoError(t, err)
+		assert.Equal(t, expected, value)
+		assert.InDelta(t, time.Minute, redisClient.PTTL(ctx, key).Val(), float64(time.Second))
+	}
+
+	// the batch loads the script when redis doesn't have it
+	sliding := NewRedisSimpleCache(redisClient, nil, time.Minute, WithSlidingExpiration(0))
+	require.NoError(t, redisClient.ScriptFlush(ctx).Err())
+	require.NoError(t, sliding.BatchSet(ctx, "key3", "value3"))
+	assert.NoError(t, sliding.Get(ctx, "key3", new(string)))
+
+	require.NoError(t, cache.BatchSet(ctx))
+	assert.ErrorIs(t, cache.BatchSet(ctx, "key1"), ErrOddKeyValues)
+	assert.ErrorIs(t, cache.BatchSet(ctx, "key1", make(chan int)), ErrEncode)
+}
+
+func TestWarmFromRedis(t *testing.T) {
+	ctx := context.Background()
+
+	redisClient, _ := newRedisClient(t)
+
+	src := NewRedisSimpleCache(redisClient, nil, time.Minute)
+	for i := 0; i < 250; i++ {
+		require.NoError(t, src.Set(ctx, fmt.Sprintf("warm:%d", i), i))
+	}
+	require.NoError(t, src.SetWithTTL(ctx, "warm:persistent", -1, 0))
+	require.NoError(t, src.Set(ctx, "other", 0))
+
+	dst := NewTypedLibCache[string, int](libcache.LRU.New(0), time.Hour)
+	n, err := WarmFromRedis[int](ctx, redisClient, nil, "warm:*", dst)
+	require.NoError(t, err)
+	assert.Equal(t, 251, n)
+
+	value, err := Get[int](ctx, dst, "warm:42")
+	require.NoError(t, err)
+	assert.Equal(t, 42, value)
+	expiry, _ := dst.cache.Expiry("warm:42")
+	assert.WithinDuration(t, time.Now().Add(time.Minute), expiry, time.Second)
+
+	// without expiration in redis the default ttl applies
+	expiry, _ = dst.cache.Expiry("warm:persistent")
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiry, time.Second)
+
+	assert.ErrorIs(t, dst.Get(ctx, "other", new(int)), ErrCacheMiss)
+}
+
+func TestRedisSimpleCacheTags(t *testing.T) {
+	ctx := context.Background()
+
+	redisClient, _ := newRedisClient(t)
+
+	cache := NewRedisSimpleCache(redisClient, nil, time.Minute)
+	require.NoError(t, cache.SetWithTags(ctx, "key1", "value1", time.Minute, "market:1", "subaccount:1"))
+	require.NoError(t, cache.SetWithTags(ctx, "key2", "value2", time.Hour, "market:1"))
+	require.NoError(t, cache.SetWithTags(ctx, "key3", "value3", 0, "market:2"))
+
+	// the tag sets expire with their longest living key
+	ttl, err := redisClient.PTTL(ctx, tagKey("market:1")).Result()
+	require.NoError(t, err)
+	assert.InDelta(t, time.Hour, ttl, float64(time.Second))
+	ttl, err = redisClient.PTTL(ctx, tagKey("market:2")).Result()
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(-1), ttl)
+
+	require.NoError(t, cache.InvalidateTags(ctx, "market:1"))
+	assert.ErrorIs(t, cache.Get(ctx, "key1", new(string)), ErrCacheMiss)
+	assert.ErrorIs(t, cache.Get(ctx, "key2", new(string)), ErrCacheMiss)
+	assert.NoError(t, cache.Get(ctx, "key3", new(string)))
+	assert.Zero(t, redisClient.Exists(ctx, tagKey("market:1")).Val())
+	assert.Empty(t, redisClient.SMembers(ctx, tagKey("subaccount:1")).Val(), "key1 left its other tags")
+
+	t.Run("set again without the tag", func(t *testing.T) {
+		require.NoError(t, cache.SetWithTags(ctx, "key4", "value4", time.Minute, "market:3", "market:4"))
+		require.NoError(t, cache.SetWithTags(ctx, "key4", "value4", time.Minute, "market:4"))
+		require.NoError(t, cache.SetWithTags(ctx, "key5", "value5", time.Minute, "market:3"))
+		require.NoError(t, cache.SetWithTags(ctx, "key5", "value5", time.Minute))
+		assert.Empty(t, redisClient.SMembers(ctx, tagKey("market:3")).Val(), "the keys left the tag")
+
+		require.NoError(t, cache.InvalidateTags(ctx, "market:3"))
+		assert.NoError(t, cache.Get(ctx, "key4", new(string)), "key4 is no longer tagged market:3")
+		assert.NoError(t, cache.Get(ctx, "key5", new(string)), "key5 is no longer tagged market:3")
+
+		require.NoError(t, cache.Del(ctx, "key4"))
+		assert.Zero(t, redisClient.Exists(ctx, tagKey("market:4"), defaultInternalPrefix+redisKeyTagsPrefix+"key4").Val())
+	})
+
+	t.Run("set keeps the tags", func(t *testing.T) {
+		require.NoError(t, cache.SetWithTags(ctx, "key6", "value6", time.Minute, "market:5"))
+		require.NoError(t, cache.Set(ctx, "key6", "value6"))
+		require.NoError(t, cache.InvalidateTags(ctx, "market:5"))
+		assert.ErrorIs(t, cache.Get(ctx, "key6", new(string)), ErrCacheMiss)
+	})
+
+	t.Run("user keys named like the tags", func(t *testing.T) {
+		require.NoError(t, cache.Set(ctx, "tags:key7", "user value"))
+		require.NoError(t, cache.Set(ctx, "tag:market:6", "user value"))
+		require.NoError(t, cache.Set(ctx, "key7", "value7"))
+		require.NoError(t, cache.SetWithTags(ctx, "key7", "value7", time.Minute, "market:6"))
+		require.NoError(t, cache.InvalidateTags(ctx, "market:6"))
+		assert.ErrorIs(t, cache.Get(ctx, "key7", new(string)), ErrCacheMiss)
+		for _, key := range []string{"tags:key7", "tag:market:6"} {
+			value, err := Get[string](ctx, cache, key)
+			require.NoError(t, err)
+			assert.Equal(t, "user value", value)
+		}
+
+		prefixed := NewRedisSimpleCache(redisClient, nil, time.Minute, WithInternalPrefix("internal:"))
+		require.NoError(t, prefixed.SetWithTags(ctx, "key8", "value8", time.Minute, "market:7"))
+		assert.Equal(t, []string{"key8"}, redisClient.SMembers(ctx, "internal:tag:market:7").Val())
+	})
+}
+
+// tagKey returns the redis set of tag under the default internal prefix.
+func tagKey(tag string) string {
+	return defaultInternalPrefix + redisTagPrefix + tag
+}
+
+func TestRedisPatternDeleter(t *testing.T) {
+	ctx := context.Background()
+
+	redisClient, _ := newRedisClient(t)
+
+	cache := NewRedisSimpleCache(redisClient, nil, time.Minute)
+	for i := 0; i < 2500; i++ {
+		require.NoError(t, cache.Set(ctx, fmt.Sprintf("market:%d", i), i))
+	}
+	require.NoError(t, cache.Set(ctx, "subaccount:1:orders", 1))
+	require.NoError(t, cache.Set(ctx, "subaccount:1:trades", 2))
+	require.NoError(t, cache.Set(ctx, "sub*", 3))
+
+	n, err := cache.DelPrefix(ctx, "market:")
+	require.NoError(t, err)
+	assert.Equal(t, 2500, n)
+
+	n, err = cache.DelPattern(ctx, "subaccount:*:orders")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = cache.DelPrefix(ctx, "sub*")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.NoError(t, cache.Get(ctx, "subaccount:1:trades", new(int)))
+
+	require.NoError(t, cache.SetWithTags(ctx, "tagged", 4, time.Minute, "market"))
+	// the keys of the entries are deleted whatever their name, the internal keys are kept
+	require.NoError(t, cache.Set(ctx, "lock:job1", 5))
+	require.NoError(t, cache.Set(ctx, "tag:market", 6))
+	require.NoError(t, redisClient.Set(ctx, defaultInternalPrefix+"key", "internal", 0).Err())
+	n, err = cache.DelPattern(ctx, "*")
+	require.NoError(t, err)
+	assert.Equal(t, 4, n, "subaccount:1:trades, tagged, lock:job1 and tag:market")
+	assert.Zero(t, redisClient.Exists(ctx, tagKey("market"), defaultInternalPrefix+redisKeyTagsPrefix+"tagged").Val(), "the tags of the deleted keys are removed")
+	assert.EqualValues(t, 1, redisClient.Exists(ctx, defaultInternalPrefix+"key").Val(), "the internal keys are kept")
+
+	byteCache := NewRedisCacheWithClient(ctx, redisClient, time.Minute)
+	require.NoError(t, byteCache.Set(ctx, "key", []byte("value")))
+	require.NoError(t, byteCache.Set(ctx, "lock:job1", []byte("value")))
+	n, err = byteCache.DelPattern(ctx, "*")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.EqualValues(t, 1, redisClient.Exists(ctx, defaultInternalPrefix+"key").Val(), "the internal keys are kept")
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = cache.DelPrefix(canceled, "market:")
+	var cacheErr *CacheError
+	require.ErrorAs(t, err, &cacheErr)
+	assert.Equal(t, "del prefix", cacheErr.Op)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestRedisCacheTTL(t *testing.T) {
+	ctx := context.Background()
+
+	redisClient, _ := newRedisClient(t)
+
+	cache := NewRedisCacheWithClient(ctx, redisClient, time.Minute)
+	require.NoError(t, cache.SetWithTTL(ctx, "key1", []byte("value1"), time.Hour))
+	require.NoError(t, cache.BatchSetWithTTL(ctx,
+		BatchItem{Key: "key2", Value: []byte("value2"), TTL: time.Minute},
+		BatchItem{Key: "key3", Value: []byte("value3")},
+	))
+
+	ttl, err := cache.TTL(ctx, "key1")
+	require.NoError(t, err)
+	assert.InDelta(t, time.Hour, ttl, float64(time.Second))
+	ttl, err = cache.TTL(ctx, "key2")
+	require.NoError(t, err)
+	assert.InDelta(t, time.Minute, ttl, float64(time.Second))
+	ttl, err = cache.TTL(ctx, "key3")
+	require.NoError(t, err)
+	assert.Equal(t, NoTTL, ttl)
+	_, err = cache.TTL(ctx, "missing")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+
+	require.NoError(t, cache.Touch(ctx, "key3", time.Hour))
+	ttl, err = cache.TTL(ctx, "key3")
+	require.NoError(t, err)
+	assert.InDelta(t, time.Hour, ttl, float64(time.Second))
+
+	require.NoError(t, cache.Touch(ctx, "key1", 0))
+	ttl, err = cache.TTL(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, NoTTL, ttl)
+
+	assert.ErrorIs(t, cache.Touch(ctx, "missing", time.Hour), ErrCacheMiss)
+	assert.ErrorIs(t, cache.Touch(ctx, "missing", 0), ErrCacheMiss)
+
+	require.NoError(t, cache.Touch(ctx, "key2", NoTTL))
+	require.NoError(t, cache.SetWithTTL(ctx, "key3", []byte("value3"), NoTTL))
+	for _, key := range []string{"key2", "key3"} {
+		ttl, err = cache.TTL(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, NoTTL, ttl, key)
+	}
+	assert.ErrorIs(t, cache.Touch(ctx, "key2", -time.Second), ErrInvalidValue)
+	assert.ErrorIs(t, cache.SetWithTTL(ctx, "key2", []byte("value2"), -time.Second), ErrInvalidValue)
+	assert.ErrorIs(t, cache.BatchSetWithTTL(ctx, BatchItem{Key: "key2", TTL: -time.Second}), ErrInvalidValue)
+	ttl, err = cache.TTL(ctx, "key2")
+	require.NoError(t, err)
+	assert.Equal(t, NoTTL, ttl)
+}
+
+func TestRedisSimpleCacheTTL(t *testing.T) {
+	ctx := context.Background()
+
+	redisClient, _ := newRedisClient(t)
+	cache := NewRedisSimpleCache(redisClient, nil, time.Minute)
+	require.NoError(t, cache.Set(ctx, 1, "value1"))
+	require.NoError(t, cache.SetWithTTL(ctx, "key2", "value2", 0))
+
+	ttl, err := cache.TTL(ctx, 1)
+	require.NoError(t, err)
+	assert.InDelta(t, time.Minute, ttl, float64(time.Second))
+	ttl, err = cache.TTL(ctx, "key2")
+	require.NoError(t, err)
+	assert.Equal(t, NoTTL, ttl)
+	_, err = cache.TTL(ctx, "missing")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+}
+
+func TestRedisSimpleCacheSlidingExpiration(t *testing.T) {
+	ctx := context.Background()
+
+	redisClient, server := newRedisClient(t)
+
+	t.Run("reads extend the ttl", func(t *testing.T) {
+		cache := NewRedisSimpleCache(redisClient, nil, time.Minute, WithSlidingExpiration(0))
+		require.NoError(t, cache.SetWithTTL(ctx, "key1", "value1", 10*time.Second))
+		server.FastForward(5 * time.Second)
+		require.NoError(t, cache.Get(ctx, "key1", new(string)))
+
+		ttl := redisClient.PTTL(ctx, "key1").Val()
+		assert.InDelta(t, 10*time.Second, ttl, float64(time.Second))
+	})
+
+	t.Run("own ttl", func(t *testing.T) {
+		cache := NewRedisSimpleCache(redisClient, nil, time.Minute, WithSlidingExpiration(0))
+		require.NoError(t, cache.SetWithTTL(ctx, "hour", "value", time.Hour))
+		require.NoError(t, cache.SetWithTTL(ctx, "forever", "value", 0))
+		require.NoError(t, cache.Get(ctx, "hour", new(string)))
+		require.NoError(t, cache.Get(ctx, "forever", new(string)))
+
+		assert.InDelta(t, time.Hour, redisClient.PTTL(ctx, "hour").Val(), float64(time.Second), "a read doesn't shrink the ttl to the default")
+		assert.Equal(t, time.Duration(-1), redisClient.PTTL(ctx, "forever").Val(), "a read doesn't give an expiration")
+	})
+
+	t.Run("max lifetime", func(t *testing.T) {
+		cache := NewRedisSimpleCache(redisClient, nil, time.Minute, WithSlidingExpiration(time.Hour))
+		require.NoError(t, cache.SetWithTTL(ctx, "key2", "value2", 2*time.Hour))
+		assert.InDelta(t, time.Hour, redisClient.PTTL(ctx, "key2").Val(), float64(time.Second))
+
+		require.NoError(t, cache.Get(ctx, "key2", new(string)))
+		assert.InDelta(t, time.Hour, redisClient.PTTL(ctx, "key2").Val(), float64(time.Second))
+
+		// the deadline is reached within the next hour
+		redisClient.HSet(ctx, slidingKey("key2"), "deadline", time.Now().Add(time.Second).UnixMilli())
+		require.NoError(t, cache.Get(ctx, "key2", new(string)))
+		assert.InDelta(t, time.Second, redisClient.PTTL(ctx, "key2").Val(), float64(100*time.Millisecond))
+
+		redisClient.HSet(ctx, slidingKey("key2"), "deadline", time.Now().UnixMilli())
+		assert.ErrorIs(t, cache.Get(ctx, "key2", new(string)), ErrCacheMiss)
+		assert.Zero(t, redisClient.Exists(ctx, "key2", slidingKey("key2")).Val())
+
+		require.NoError(t, cache.Set(ctx, "key3", "value3"))
+		require.NoError(t, cache.Del(ctx, "key3"))
+		assert.Zero(t, redisClient.Exists(ctx, slidingKey("key3")).Val())
+	})
+
+	t.Run("tagged key", func(t *testing.T) {
+		cache := NewRedisSimpleCache(redisClient, nil, time.Minute, WithSlidingExpiration(time.Hour))
+		// a deadline left by a previous value doesn't apply to the new one
+		redisClient.HSet(ctx, slidingKey("key4"), "ttl", 0, "deadline", time.Now().UnixMilli())
+		require.NoError(t, cache.SetWithTags(ctx, "key4", "value4", time.Minute, "tag"))
+		deadline, err := redisClient.HGet(ctx, slidingKey("key4"), "deadline").Int64()
+		require.NoError(t, err)
+		assert.InDelta(t, time.Now().Add(time.Hour).UnixMilli(), deadline, float64(time.Second.Milliseconds()))
+		require.NoError(t, cache.Get(ctx, "key4", new(string)))
+	})
+
+	t.Run("user keys named like the sliding state", func(t *testing.T) {
+		cache := NewRedisSimpleCache(redisClient, nil, time.Minute)
+		require.NoError(t, cache.Set(ctx, "sliding:key5", "user value"))
+		require.NoError(t, cache.Set(ctx, "key5", "value5"))
+		require.NoError(t, cache.SetWithTags(ctx, "key5", "value5", time.Minute, "tag"))
+		require.NoError(t, cache.Del(ctx, "key5"))
+		require.NoError(t, cache.SetWithTags(ctx, "key5", "value5", time.Minute, "tag"))
+		require.NoError(t, cache.InvalidateTags(ctx, "tag"))
+
+		value, err := Get[string](ctx, cache, "sliding:key5")
+		require.NoError(t, err)
+		assert.Equal(t, "user value", value)
+	})
+}
+
+// slidingKey returns the sliding expiration hash of key under the default internal prefix.
+func slidingKey(key string) string {
+	return defaultInternalPrefix + redisSlidingPrefix + key
+}
+
+func TestRedisTTLJitter(t *testing.T) {
+	ctx := context.Background()
+
+	redisClient, _ := newRedisClient(t)
+
+	byteCache := NewRedisCacheWithClient(ctx, redisClient, time.Hour, WithTTLJitterRange(0, time.Minute))
+	keyvalues := make([]any, 0, 20)
+	for i := 0; i < 10; i++ {
+		keyvalues = append(keyvalues, fmt.Sprintf("bytes:%d", i), []byte("value"))
+	}
+	require.NoError(t, byteCache.BatchSet(ctx, keyvalues...))
+
+	cache := NewRedisSimpleCache(redisClient, nil, time.Hour, WithTTLJitterRange(0, time.Minute))
+	for i := 0; i < 10; i++ {
+		require.NoError(t, cache.Set(ctx, fmt.Sprintf("simple:%d", i), i))
+	}
+
+	for _, prefix := range []string{"bytes", "simple"} {
+		ttls := make(map[time.Duration]bool)
+		for i := 0; i < 10; i++ {
+			ttl := redisClient.PTTL(ctx, fmt.Sprintf("%s:%d", prefix, i)).Val()
+			assert.GreaterOrEqual(t, ttl, time.Hour-time.Second)
+			assert.LessOrEqual(t, ttl, time.Hour+time.Minute)
+			ttls[ttl.Truncate(time.Second)] = true
+		}
+		assert.Greater(t, len(ttls), 5, prefix)
+	}
+}
+
+func TestRedisDistributedCoalescingCache(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	redisClient, server := newRedisClient(t)
+
+	t.Run("coalesce across replicas", func(t *testing.T) {
+		var executed atomic.Int64
+		fetch := func() (int, error) {
+			executed.Add(1)
+			time.Sleep(100 * time.Millisecond)
+			return 42, nil
+		}
+
+		var wg sync.WaitGroup
+		for replica := 0; replica < 3; replica++ {
+			// every replica has its own client, like separate processes
+			client := redis.NewClient(&redis.Options{Addr: server.Addr, DB: server.DB})
+			defer client.Close()
+			dcc := NewDistributedCoalescingCache[string, int](NewRedisSimpleCache(client, nil, time.Minute), DistributedCoalescingOptions{})
+			for i := 0; i < 5; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					res, err := dcc.Get(ctx, "key", fetch)
+					assert.NoError(t, err)
+					assert.Equal(t, 42, res)
+				}()
+			}
+		}
+		wg.Wait()
+
+		assert.EqualValues(t, 1, executed.Load(), "only one replica should execute the function")
+		assert.Zero(t, redisClient.Exists(ctx, defaultInternalPrefix+redisCoalesceLockPrefix+"key").Val(), "the lock should be released")
+	})
+
+	t.Run("wait for the lock holder", func(t *testing.T) {
+		require.NoError(t, redisClient.Set(ctx, defaultInternalPrefix+redisCoalesceLockPrefix+"key2", "other", time.Minute).Err())
+		dcc := NewDistributedCoalescingCache[string, int](NewRedisSimpleCache(redisClient, nil, time.Minute), DistributedCoalescingOptions{
+			PollInterval: time.Minute,
+		})
+
+		done := make(chan int)
+		go func() {
+			res, err := dcc.Get(ctx, "key2", func() (int, error) {
+				return 0, errors.New("should not be called")
+			})
+			assert.NoError(t, err)
+			done <- res
+		}()
+
+		// the other replica stores the value and notifies
+		time.Sleep(100 * time.Millisecond)
+		require.NoError(t, NewRedisSimpleCache(redisClient, nil, time.Minute).Set(ctx, "key2", 7))
+		require.NoError(t, redisClient.Publish(ctx, redisCoalesceChannelPrefix+"key2", "other").Err())
+		assert.Equal(t, 7, <-done)
+		assert.Equal(t, "other", redisClient.Get(ctx, defaultInternalPrefix+redisCoalesceLockPrefix+"key2").Val(), "the lock of another holder is kept")
+	})
+
+	t.Run("take over when the holder failed", func(t *testing.T) {
+		require.NoError(t, redisClient.Set(ctx, defaultInternalPrefix+redisCoalesceLockPrefix+"key3", "other", time.Minute).Err())
+		dcc := NewDistributedCoalescingCache[string, int](NewRedisSimpleCache(redisClient, nil, time.Minute), DistributedCoalescingOptions{
+			PollInterval: 10 * time.Millisecond,
+		})
+
+		done := make(chan int)
+		go func() {
+			res, err := dcc.Get(ctx, "key3", func() (int, error) {
+				return 3, nil
+			})
+			assert.NoError(t, err)
+			done <- res
+		}()
+
+		// the other replica releases the lock without a value
+		time.Sleep(50 * time.Millisecond)
+		require.NoError(t, redisClient.Del(ctx, defaultInternalPrefix+redisCoalesceLockPrefix+"key3").Err())
+		assert.Equal(t, 3, <-done)
+
+		var cached int
+		require.NoError(t, NewRedisSimpleCache(redisClient, nil, time.Minute).Get(ctx, "key3", &cached))
+		assert.Equal(t, 3, cached)
+	})
+
+	t.Run("store and release once the request is canceled", func(t *testing.T) {
+		dcc := NewDistributedCoalescingCache[string, int](NewRedisSimpleCache(redisClient, nil, time.Minute), DistributedCoalescingOptions{})
+
+		reqCtx, reqCancel := context.WithCancel(ctx)
+		res, err := dcc.Get(reqCtx, "key4", func() (int, error) {
+			// the request is canceled once the value is fetched
+			reqCancel()
+			return 4, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 4, res)
+
+		var cached int
+		require.NoError(t, NewRedisSimpleCache(redisClient, nil, time.Minute).Get(ctx, "key4", &cached))
+		assert.Equal(t, 4, cached)
+		assert.Zero(t, redisClient.Exists(ctx, defaultInternalPrefix+redisCoalesceLockPrefix+"key4").Val(), "the lock should be released")
+	})
+
+	t.Run("share the pub/sub connection", func(t *testing.T) {
+		dcc := NewDistributedCoalescingCache[string, int](NewRedisSimpleCache(redisClient, nil, time.Minute), DistributedCoalescingOptions{
+			PollInterval: time.Minute,
+		})
+		keys := []string{"key5", "key6", "key7"}
+		channels := make([]string, len(keys))
+		for i, key := range keys {
+			channels[i] = redisCoalesceChannelPrefix + key
+			require.NoError(t, redisClient.Set(ctx, defaultInternalPrefix+redisCoalesceLockPrefix+key, "other", time.Minute).Err())
+		}
+
+		var wg sync.WaitGroup
+		for i, key := range keys {
+			i, key := i, key
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				res, err := dcc.Get(ctx, key, func() (int, error) {
+					return 0, errors.New("should not be called")
+				})
+				assert.NoError(t, err)
+				assert.Equal(t, i, res)
+			}()
+		}
+
+		require.Eventually(t, func() bool {
+			subscribers, err := redisClient.PubSubNumSub(ctx, channels...).Result()
+			require.NoError(t, err)
+			for _, channel := range channels {
+				if subscribers[channel] != 1 {
+					return false
+				}
+			}
+			return true
+		}, time.Second, 10*time.Millisecond, "every channel is subscribed")
+		dcc.notifier.mu.Lock()
+		assert.Len(t, dcc.notifier.channels, len(keys), "on the shared connection")
+		dcc.notifier.mu.Unlock()
+
+		for i, key := range keys {
+			require.NoError(t, NewRedisSimpleCache(redisClient, nil, time.Minute).Set(ctx, key, i))
+			require.NoError(t, redisClient.Publish(ctx, redisCoalesceChannelPrefix+key, "other").Err())
+		}
+		wg.Wait()
+
+		dcc.notifier.mu.Lock()
+		defer dcc.notifier.mu.Unlock()
+		assert.Nil(t, dcc.notifier.sub, "the connection is closed once no request waits")
+	})
+}
+
+func TestRedisLocker(t *testing.T) {
+	ctx := context.Background()
+
+	redisClient, server := newRedisClient(t)
+
+	testLocker(t, func(opts LockerOptions) Locker {
+		return NewRedisLocker(redisClient, opts)
+	}, server.FastForward)
+
+	t.Run("keys", func(t *testing.T) {
+		locker := NewRedisLocker(redisClient, LockerOptions{})
+		lockKey, fenceKey := defaultInternalPrefix+redisLockPrefix+"keys", defaultInternalPrefix+redisFencePrefix+"keys"
+		lock, err := locker.TryLock(ctx, "keys", time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, lock.Token, redisClient.Get(ctx, lockKey).Val())
+		assert.InDelta(t, time.Minute, redisClient.PTTL(ctx, lockKey).Val(), float64(time.Second))
+		assert.Equal(t, fmt.Sprint(lock.Fence), redisClient.Get(ctx, fenceKey).Val())
+
+		require.NoError(t, locker.Unlock(ctx, lock))
+		assert.Zero(t, redisClient.Exists(ctx, lockKey).Val())
+	})
+
+	t.Run("user keys", func(t *testing.T) {
+		cache := NewRedisSimpleCache(redisClient, nil, time.Minute)
+		require.NoError(t, cache.Set(ctx, "fence:shared", 7))
+		require.NoError(t, cache.Set(ctx, "lock:shared", 8))
+
+		locker := NewRedisLocker(redisClient, LockerOptions{})
+		lock, err := locker.TryLock(ctx, "shared", time.Minute)
+		require.NoError(t, err, "the entries don't hold the lock")
+		assert.EqualValues(t, 1, lock.Fence)
+		require.NoError(t, locker.Unlock(ctx, lock))
+
+		var value int
+		require.NoError(t, cache.Get(ctx, "fence:shared", &value))
+		assert.Equal(t, 7, value)
+		require.NoError(t, cache.Get(ctx, "lock:shared", &value))
+		assert.Equal(t, 8, value)
+	})
+
+	t.Run("internal prefix", func(t *testing.T) {
+		locker := NewRedisLocker(redisClient, LockerOptions{InternalPrefix: "internal:"})
+		lock, err := locker.TryLock(ctx, "prefixed", time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, lock.Token, redisClient.Get(ctx, "internal:"+redisLockPrefix+"prefixed").Val())
+		require.NoError(t, locker.Unlock(ctx, lock))
+	})
+}
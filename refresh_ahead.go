@@ -0,0 +1,284 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultRefreshFraction = 0.2
+	defaultHotThreshold    = 2
+	defaultRefreshWorkers  = 4
+)
+
+// RefreshAheadOptions configures a RefreshAheadCache, zero values fall back to the defaults.
+type RefreshAheadOptions struct {
+	// TTL is the time-to-live the wrapped cache applies to the values, it must match its default ttl.
+	// It is only used when the wrapped cache doesn't report the ttl of its keys, like TypedLibCache.TTL does.
+	TTL time.Duration
+	// RefreshFraction is the fraction of its ttl left at which a hot key gets refreshed, 0.2 by default.
+	RefreshFraction float64
+	// HotThreshold is the number of reads within CheckInterval that make a key hot, 2 by default.
+	HotThreshold int64
+	// CheckInterval is how often keys are inspected, TTL/10 by default, 1 second without TTL.
+	CheckInterval time.Duration
+	// Workers is the maximum number of concurrent refreshes, 4 by default.
+	Workers int
+	// MaxRefreshRate is the maximum number of refreshes started per second, 0 means unlimited.
+	MaxRefreshRate float64
+}
+
+func (o RefreshAheadOptions) withDefaults() RefreshAheadOptions {
+	if o.RefreshFraction <= 0 || o.RefreshFraction > 1 {
+		o.RefreshFraction = defaultRefreshFraction
+	}
+	if o.HotThreshold <= 0 {
+		o.HotThreshold = defaultHotThreshold
+	}
+	if o.CheckInterval <= 0 {
+		o.CheckInterval = o.TTL / 10
+	}
+	if o.CheckInterval <= 0 {
+		o.CheckInterval = time.Second
+	}
+	if o.Workers <= 0 {
+		o.Workers = defaultRefreshWorkers
+	}
+	return o
+}
+
+// RefreshAheadCache refreshes frequently read keys in the background before they expire,
+// so hot keys are not subject to a cache miss. Keys are fetched through a ResourceCoalescingCache,
+// a background refresh and a concurrent miss for the same key result in a single fetch.
+// The remaining ttl of a hot key is read from the wrapped cache when it reports it (TypedLibCache,
+// ShardedCache and RedisSimpleCache do), otherwise it is derived from RefreshAheadOptions.TTL and the time
+// the key was fetched, and a hot key only read from the cache is refreshed right away to learn it.
+type RefreshAheadCache[K comparable, T any] struct {
+	// OnErr is called when a background refresh fails
+	OnErr func(error)
+	rcc   *ResourceCoalescingCache[K, T]
+	opts  RefreshAheadOptions
+
+	keysMX sync.Mutex
+	keys   map[K]*hotKey[T]
+
+	jobs    chan K
+	stop    chan struct{}
+	stopped sync.WaitGroup
+	once    sync.Once
+}
+
+// hotKey is the access tracking of a key.
+type hotKey[T any] struct {
+	fetch func() (T, error)
+	// hits is the number of reads since the last check
+	hits atomic.Int64
+	// storedAt is when the value was last fetched, zero when it was only read from the cache
+	storedAt time.Time
+	// ttl is the longest remaining ttl the wrapped cache reported since the value was last fetched
+	ttl        time.Duration
+	refreshing bool
+}
+
+// NewRefreshAheadCache creates a new RefreshAheadCache on top of rcc, Close must be called to stop the refreshes.
+func NewRefreshAheadCache[K comparable, T any](rcc *ResourceCoalescingCache[K, T], opts RefreshAheadOptions) *RefreshAheadCache[K, T] {
+	opts = opts.withDefaults()
+	ra := &RefreshAheadCache[K, T]{
+		rcc:  rcc,
+		opts: opts,
+		keys: make(map[K]*hotKey[T]),
+		jobs: make(chan K, opts.Workers),
+		stop: make(chan struct{}),
+	}
+
+	ra.stopped.Add(opts.Workers + 1)
+	for i := 0; i < opts.Workers; i++ {
+		go ra.worker()
+	}
+	go ra.schedule()
+	return ra
+}
+
+// Get returns the value for key, fetching it on a miss. fetch is kept to refresh the key while it is hot.
+func (ra *RefreshAheadCache[K, T]) Get(ctx context.Context, key K, fetch func() (T, error)) (T, error) {
+	ra.keysMX.Lock()
+	hk, found := ra.keys[key]
+	if !found {
+		hk = &hotKey[T]{}
+		ra.keys[key] = hk
+	}
+	hk.fetch = fetch
+	ra.keysMX.Unlock()
+	hk.hits.Add(1)
+
+	return ra.rcc.Get(ctx, key, ra.tracked(hk, fetch))
+}
+
+// tracked wraps fetch to record when the value was stored.
+func (ra *RefreshAheadCache[K, T]) tracked(hk *hotKey[T], fetch func() (T, error)) func() (T, error) {
+	return func() (T, error) {
+		value, err := fetch()
+		if err == nil {
+			ra.keysMX.Lock()
+			hk.storedAt = time.Now()
+			hk.ttl = 0
+			ra.keysMX.Unlock()
+		}
+		return value, err
+	}
+}
+
+func (ra *RefreshAheadCache[K, T]) schedule() {
+	defer ra.stopped.Done()
+	defer close(ra.jobs)
+
+	ticker := time.NewTicker(ra.opts.CheckInterval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	tokens := 1.0
+	for {
+		select {
+		case <-ra.stop:
+			return
+		case now := <-ticker.C:
+			if ra.opts.MaxRefreshRate > 0 {
+				burst := ra.opts.MaxRefreshRate
+				if burst < 1 {
+					burst = 1
+				}
+				tokens += now.Sub(last).Seconds() * ra.opts.MaxRefreshRate
+				if tokens > burst {
+					tokens = burst
+				}
+			}
+			last = now
+			ra.check(now, &tokens)
+		}
+	}
+}
+
+// check dispatches the refresh of the hot keys close to their expiry and forgets the cold ones.
+func (ra *RefreshAheadCache[K, T]) check(now time.Time, tokens *float64) {
+	reader, _ := ra.rcc.cache.(ttlReader)
+	hot := ra.hotKeys(now, reader != nil)
+
+	// the wrapped cache is queried without holding the lock, Get keeps tracking the reads meanwhile
+	var remainings map[K]time.Duration
+	if reader != nil {
+		remainings = make(map[K]time.Duration, len(hot))
+		for key := range hot {
+			remaining, err := reader.TTL(context.Background(), key)
+			if err != nil {
+				// a missing value is fetched by the next read
+				if !errors.Is(err, ErrCacheMiss) && ra.OnErr != nil {
+					ra.OnErr(err)
+				}
+				continue
+			}
+			if remaining != NoTTL {
+				remainings[key] = remaining
+			}
+		}
+	}
+
+	ra.keysMX.Lock()
+	defer ra.keysMX.Unlock()
+	for key, hits := range hot {
+		hk := ra.keys[key]
+		var remaining, ttl time.Duration
+		switch {
+		case reader != nil:
+			var found bool
+			if remaining, found = remainings[key]; !found {
+				continue
+			}
+			if remaining > hk.ttl {
+				hk.ttl = remaining
+			}
+			ttl = hk.ttl
+		case !hk.storedAt.IsZero():
+			remaining, ttl = hk.storedAt.Add(ra.opts.TTL).Sub(now), ra.opts.TTL
+		}
+		// a key only read from the cache without a reported ttl has both at 0 and is refreshed
+		if remaining > time.Duration(float64(ttl)*ra.opts.RefreshFraction) {
+			continue
+		}
+		if ra.opts.MaxRefreshRate > 0 && *tokens < 1 {
+			// keep the key hot, it will be refreshed on the next check
+			hk.hits.Add(hits)
+			continue
+		}
+
+		select {
+		case ra.jobs <- key:
+			hk.refreshing = true
+			if ra.opts.MaxRefreshRate > 0 {
+				*tokens--
+			}
+		default:
+			// all workers are busy
+			hk.hits.Add(hits)
+		}
+	}
+}
+
+// hotKeys returns the hits of the keys read at least HotThreshold times since the last check, the keys being
+// refreshed excepted. It forgets the keys not read since the last check, unless their expiry is only known
+// from their fetch and not reached yet.
+func (ra *RefreshAheadCache[K, T]) hotKeys(now time.Time, reported bool) map[K]int64 {
+	ra.keysMX.Lock()
+	defer ra.keysMX.Unlock()
+	hot := make(map[K]int64)
+	for key, hk := range ra.keys {
+		hits := hk.hits.Swap(0)
+		if hk.refreshing {
+			continue
+		}
+		if hits >= ra.opts.HotThreshold {
+			hot[key] = hits
+			continue
+		}
+		if reported || hk.storedAt.IsZero() {
+			if hits == 0 {
+				delete(ra.keys, key)
+			}
+			continue
+		}
+		if !now.Before(hk.storedAt.Add(ra.opts.TTL)) {
+			delete(ra.keys, key)
+		}
+	}
+	return hot
+}
+
+func (ra *RefreshAheadCache[K, T]) worker() {
+	defer ra.stopped.Done()
+	for key := range ra.jobs {
+		ra.keysMX.Lock()
+		hk := ra.keys[key]
+		fetch := hk.fetch
+		ra.keysMX.Unlock()
+
+		_, err := ra.rcc.Refresh(context.Background(), key, ra.tracked(hk, fetch))
+		if err != nil && ra.OnErr != nil {
+			ra.OnErr(err)
+		}
+
+		ra.keysMX.Lock()
+		hk.refreshing = false
+		ra.keysMX.Unlock()
+	}
+}
+
+// Close stops the background refreshes and waits for the running ones to finish.
+func (ra *RefreshAheadCache[K, T]) Close() error {
+	ra.once.Do(func() {
+		close(ra.stop)
+	})
+	ra.stopped.Wait()
+	return nil
+}
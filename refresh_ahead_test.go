@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shaj13/libcache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshAheadCache(t *testing.T) {
+	ctx := context.Background()
+	ttl := 200 * time.Millisecond
+
+	newRefreshAhead := func(opts RefreshAheadOptions) (*RefreshAheadCache[string, int], *missCountingCache) {
+		cache := &missCountingCache{TTLCache: NewTypedLibCache[string, int](libcache.LRU.New(10), ttl)}
+		opts.TTL = ttl
+		opts.CheckInterval = 10 * time.Millisecond
+		ra := NewRefreshAheadCache(NewResourceCoalescingCache[string, int](cache), opts)
+		t.Cleanup(func() {
+			require.NoError(t, ra.Close())
+		})
+		return ra, cache
+	}
+
+	t.Run("refresh hot key", func(t *testing.T) {
+		ra, cache := newRefreshAhead(RefreshAheadOptions{RefreshFraction: 0.5, HotThreshold: 1})
+
+		var fetched atomic.Int64
+		fetch := func() (int, error) {
+			return int(fetched.Add(1)), nil
+		}
+
+		deadline := time.Now().Add(3 * ttl)
+		for time.Now().Before(deadline) {
+			value, err := ra.Get(ctx, "hot", fetch)
+			require.NoError(t, err)
+			require.Positive(t, value)
+			time.Sleep(5 * time.Millisecond)
+		}
+		require.GreaterOrEqual(t, fetched.Load(), int64(3), "the key should be refreshed every ttl/2")
+		require.EqualValues(t, 1, cache.misses.Load(), "only the first read should miss")
+	})
+
+	t.Run("only read key with the ttl of the cache", func(t *testing.T) {
+		cache := NewTypedLibCache[string, int](libcache.LRU.New(10), time.Hour)
+		require.NoError(t, cache.SetWithTTL(ctx, "hot", 0, ttl))
+		// the ttl of the options doesn't match the one of the key, the one the cache reports is used
+		ra := NewRefreshAheadCache(NewResourceCoalescingCache[string, int](cache), RefreshAheadOptions{
+			TTL:             time.Hour,
+			RefreshFraction: 0.5,
+			HotThreshold:    1,
+			CheckInterval:   10 * time.Millisecond,
+		})
+		defer ra.Close()
+
+		var fetched atomic.Int64
+		fetch := func() (int, error) {
+			return int(fetched.Add(1)), nil
+		}
+		deadline := time.Now().Add(ttl * 8 / 10)
+		for time.Now().Before(deadline) {
+			_, err := ra.Get(ctx, "hot", fetch)
+			require.NoError(t, err)
+			time.Sleep(5 * time.Millisecond)
+		}
+		require.EqualValues(t, 1, fetched.Load(), "the key should be refreshed before it expires")
+
+		remaining, err := cache.TTL(ctx, "hot")
+		require.NoError(t, err)
+		require.Greater(t, remaining, ttl)
+	})
+
+	t.Run("only read key without the ttl of the cache", func(t *testing.T) {
+		ra, cache := newRefreshAhead(RefreshAheadOptions{HotThreshold: 2})
+		require.NoError(t, cache.Set(ctx, "hot", 0))
+
+		var fetched atomic.Int64
+		fetch := func() (int, error) {
+			return int(fetched.Add(1)), nil
+		}
+		for i := 0; i < 2; i++ {
+			value, err := ra.Get(ctx, "hot", fetch)
+			require.NoError(t, err)
+			require.Zero(t, value)
+		}
+		require.Eventually(t, func() bool {
+			return fetched.Load() == 1
+		}, ttl/2, 5*time.Millisecond, "a hot key without known expiry should be refreshed to learn it")
+		require.Zero(t, cache.misses.Load())
+	})
+
+	t.Run("cold key is not refreshed", func(t *testing.T) {
+		ra, _ := newRefreshAhead(RefreshAheadOptions{HotThreshold: 2})
+
+		var fetched atomic.Int64
+		_, err := ra.Get(ctx, "cold", func() (int, error) {
+			return int(fetched.Add(1)), nil
+		})
+		require.NoError(t, err)
+
+		time.Sleep(2 * ttl)
+		require.EqualValues(t, 1, fetched.Load())
+
+		ra.keysMX.Lock()
+		defer ra.keysMX.Unlock()
+		require.Empty(t, ra.keys, "expired cold keys should not be tracked")
+	})
+
+	t.Run("report refresh errors", func(t *testing.T) {
+		ra, _ := newRefreshAhead(RefreshAheadOptions{RefreshFraction: 1, HotThreshold: 1, MaxRefreshRate: 1})
+
+		gotErr := make(chan error, 10)
+		ra.OnErr = func(err error) {
+			gotErr <- err
+		}
+
+		var fetched atomic.Int64
+		fetchErr := errors.New("fetch failed")
+		fetch := func() (int, error) {
+			if fetched.Add(1) > 1 {
+				return 0, fetchErr
+			}
+			return 1, nil
+		}
+		_, err := ra.Get(ctx, "key", fetch)
+		require.NoError(t, err)
+		_, err = ra.Get(ctx, "key", fetch)
+		require.NoError(t, err)
+
+		select {
+		case err := <-gotErr:
+			require.ErrorIs(t, err, fetchErr)
+		case <-time.After(time.Second):
+			t.Fatal("refresh error not reported")
+		}
+	})
+}
+
+type missCountingCache struct {
+	TTLCache
+	misses atomic.Int64
+}
+
+func (c *missCountingCache) Get(ctx context.Context, key any, value any) error {
+	err := c.TTLCache.Get(ctx, key, value)
+	if errors.Is(err, ErrCacheMiss) {
+		c.misses.Add(1)
+	}
+	return err
+}
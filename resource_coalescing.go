@@ -4,6 +4,7 @@ import (
 	"context"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // ResourceCoalescingCache is a cache that coalesces multiple requests for the same resource into a single request
@@ -14,6 +15,8 @@ type ResourceCoalescingCache[K comparable, T any] struct {
 	cacheMX  sync.RWMutex
 	inFlight map[K]*resource[T]
 	once     sync.Once
+	// xfetch enables the probabilistic early expiration when set
+	xfetch *XFetchOptions
 }
 
 // NewResourceCoalescingCache creates a new ResourceCoalescingCache
@@ -32,12 +35,44 @@ type resource[T any] struct {
 }
 
 func (crc *ResourceCoalescingCache[K, T]) Get(ctx context.Context, key K, fetch func() (T, error)) (result T, err error) {
+	if crc.xfetch != nil {
+		return crc.getXFetch(ctx, key, fetch)
+	}
+
 	var cachedRes T
 	cacheErr := crc.cache.Get(ctx, key, &cachedRes)
 	if cacheErr == nil {
 		return cachedRes, nil
 	}
 
+	return crc.coalesce(ctx, key, fetch)
+}
+
+// Refresh executes fetch and stores the result in the cache without looking at the cached value first,
+// concurrent calls for the same key are still coalesced.
+func (crc *ResourceCoalescingCache[K, T]) Refresh(ctx context.Context, key K, fetch func() (T, error)) (result T, err error) {
+	return crc.coalesce(ctx, key, fetch)
+}
+
+func (crc *ResourceCoalescingCache[K, T]) coalesce(ctx context.Context, key K, fetch func() (T, error)) (result T, err error) {
+	return crc.flight(ctx, key, func() (T, error) {
+		// execute the function
+		start := time.Now()
+		result, err := fetch()
+		if err != nil {
+			return result, err
+		}
+
+		// store the result in the cache
+		if setErr := crc.store(ctx, key, result, time.Since(start)); setErr != nil && crc.OnErr != nil {
+			crc.OnErr(setErr)
+		}
+		return result, nil
+	})
+}
+
+// flight executes fn once for the concurrent calls with the same key, the other calls wait for its result.
+func (crc *ResourceCoalescingCache[K, T]) flight(ctx context.Context, key K, fn func() (T, error)) (result T, err error) {
 	crc.cacheMX.Lock()
 	res, found := crc.inFlight[key]
 	if found {
@@ -59,19 +94,11 @@ func (crc *ResourceCoalescingCache[K, T]) Get(ctx context.Context, key K, fetch
 	crc.inFlight[key] = res
 	crc.cacheMX.Unlock()
 
-	// execute the function
-	result, err = fetch()
+	result, err = fn()
 	res.value = result
 	res.err = err
 	close(res.done)
 
-	// store the result in the cache if needed
-	if err == nil {
-		if setErr := crc.cache.Set(ctx, key, result); setErr != nil && crc.OnErr != nil {
-			crc.OnErr(setErr)
-		}
-	}
-
 	// remove the promise from the in-flight map
 	crc.cacheMX.Lock()
 	delete(crc.inFlight, key)
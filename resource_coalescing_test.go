@@ -138,4 +138,20 @@ func TestResourceCoalescingCache(t *testing.T) {
 		require.Equal(t, 42, res, "should return the value from the function")
 		require.ErrorIs(t, gotErr, ErrInvalidValue, "should return the error when storing the cache")
 	})
+
+	t.Run("refresh", func(t *testing.T) {
+		cache := NewTypedLibCache[string, int](libcache.LRU.New(10), time.Minute)
+		rcc := NewResourceCoalescingCache[string, int](cache)
+
+		require.NoError(t, cache.Set(ctx, "key", 1))
+		res, err := rcc.Refresh(ctx, "key", func() (int, error) {
+			return 2, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 2, res, "should not return the cached value")
+
+		res, err = Get[int](ctx, cache, "key")
+		require.NoError(t, err)
+		require.Equal(t, 2, res, "should store the refreshed value")
+	})
 }
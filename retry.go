@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	rediscache "github.com/go-redis/redis/v8"
+)
+
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryMinBackoff  = 8 * time.Millisecond
+	defaultRetryMaxBackoff  = 512 * time.Millisecond
+)
+
+// RetryPolicy configures how the redis operations failing with a transient error are retried,
+// zero values fall back to the defaults.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts of an operation, the first one included, 3 by default.
+	MaxAttempts int
+	// MinBackoff is the wait before the first retry, doubled at every retry, 8ms by default.
+	MinBackoff time.Duration
+	// MaxBackoff caps the wait between two attempts, 512ms by default.
+	MaxBackoff time.Duration
+	// IsRetryable reports whether an operation failing with err can be retried, IsRetryableRedisError by default.
+	IsRetryable func(err error) bool
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if p.MinBackoff <= 0 {
+		p.MinBackoff = defaultRetryMinBackoff
+	}
+	if p.MaxBackoff < p.MinBackoff {
+		p.MaxBackoff = maxDuration(defaultRetryMaxBackoff, p.MinBackoff)
+	}
+	if p.IsRetryable == nil {
+		p.IsRetryable = IsRetryableRedisError
+	}
+	return p
+}
+
+// WithRetryPolicy retries the operations failing with a transient error, waiting an exponential backoff with jitter
+// between the attempts. A retry is never started past the ctx deadline. It applies to the single and batch operations
+// of the redis caches, on top of the retries of the go-redis client configured by its MaxRetries option.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *options) {
+		o.retryPolicy = &policy
+	}
+}
+
+// IsRetryableRedisError reports whether err is a transient redis error: a connection or timeout error,
+// or a redis reply asking to try again later or elsewhere (MOVED, ASK, READONLY, LOADING, TRYAGAIN, CLUSTERDOWN,
+// MASTERDOWN). A miss (rediscache.Nil), a canceled context and any other redis reply are not retryable.
+func IsRetryableRedisError(err error) bool {
+	switch {
+	case err == nil, errors.Is(err, rediscache.Nil), errors.Is(err, context.Canceled):
+		return false
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.EPIPE):
+		return true
+	}
+
+	var redisErr rediscache.Error
+	if errors.As(err, &redisErr) {
+		msg := redisErr.Error()
+		for _, prefix := range []string{"MOVED ", "ASK ", "READONLY ", "LOADING ", "TRYAGAIN ", "CLUSTERDOWN ", "MASTERDOWN "} {
+			if strings.HasPrefix(msg, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// retrier runs the operations with a RetryPolicy, it's safe for concurrent use.
+type retrier struct {
+	policy RetryPolicy
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func newRetrier(o options) *retrier {
+	if o.retryPolicy == nil {
+		return nil
+	}
+	seed := o.seed
+	if !o.seeded {
+		seed = time.Now().UnixNano()
+	}
+	return &retrier{
+		policy: o.retryPolicy.withDefaults(),
+		rand:   rand.New(rand.NewSource(seed)),
+	}
+}
+
+// do runs fn until it succeeds, fails with an error which isn't retryable, or the attempts are exhausted,
+// and returns its last error. Without a policy fn is run once.
+func (r *retrier) do(ctx context.Context, fn func() error) error {
+	if r == nil {
+		return fn()
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= r.policy.MaxAttempts || !r.policy.IsRetryable(err) || ctx.Err() != nil {
+			return err
+		}
+
+		wait := r.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			// the retry couldn't complete in time
+			return err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the wait before the retry following attempt: the exponential backoff capped to MaxBackoff,
+// of which the second half is random so the clients retrying together spread out.
+func (r *retrier) backoff(attempt int) time.Duration {
+	wait := r.policy.MaxBackoff
+	if shift := attempt - 1; shift < 32 && r.policy.MinBackoff<<shift < r.policy.MaxBackoff {
+		wait = r.policy.MinBackoff << shift
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return wait/2 + time.Duration(r.rand.Int63n(int64(wait/2)+1))
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
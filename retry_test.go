@@ -0,0 +1,221 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	rediscache "github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// redisReplyError is an error replied by redis.
+type redisReplyError string
+
+func (e redisReplyError) Error() string { return string(e) }
+
+func (redisReplyError) RedisError() {}
+
+func TestIsRetryableRedisError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: nil, want: false},
+		{err: rediscache.Nil, want: false},
+		{err: ErrCacheMiss, want: false},
+		{err: ErrInvalidKey, want: false},
+		{err: context.Canceled, want: false},
+		{err: context.DeadlineExceeded, want: true},
+		{err: io.EOF, want: true},
+		{err: fmt.Errorf("reading reply: %w", io.ErrUnexpectedEOF), want: true},
+		{err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, want: true},
+		{err: &net.OpError{Op: "read", Net: "tcp", Err: errors.New("i/o timeout")}, want: true},
+		{err: redisReplyError("MOVED 3999 127.0.0.1:6381"), want: true},
+		{err: redisReplyError("ASK 3999 127.0.0.1:6381"), want: true},
+		{err: redisReplyError("READONLY You can't write against a read only replica."), want: true},
+		{err: redisReplyError("LOADING Redis is loading the dataset in memory"), want: true},
+		{err: redisReplyError("WRONGTYPE Operation against a key holding the wrong kind of value"), want: false},
+		{err: redisReplyError("ERR syntax error"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.err), func(t *testing.T) {
+			assert.Equal(t, tt.want, IsRetryableRedisError(tt.err))
+		})
+	}
+}
+
+func TestRetrier(t *testing.T) {
+	ctx := context.Background()
+	errTransient := io.EOF
+
+	newRetrierWith := func(policy RetryPolicy) *retrier {
+		return newOptions([]Option{WithRetryPolicy(policy), WithRandSeed(1)}).retry
+	}
+
+	t.Run("no policy", func(t *testing.T) {
+		var attempts int
+		err := newOptions(nil).retry.do(ctx, func() error {
+			attempts++
+			return errTransient
+		})
+		assert.ErrorIs(t, err, errTransient)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("retries until success", func(t *testing.T) {
+		r := newRetrierWith(RetryPolicy{MaxAttempts: 5, MinBackoff: time.Millisecond})
+		var attempts int
+		err := r.do(ctx, func() error {
+			attempts++
+			if attempts < 3 {
+				return errTransient
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("max attempts", func(t *testing.T) {
+		r := newRetrierWith(RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond})
+		var attempts int
+		err := r.do(ctx, func() error {
+			attempts++
+			return errTransient
+		})
+		assert.ErrorIs(t, err, errTransient)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("not retryable", func(t *testing.T) {
+		r := newRetrierWith(RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond})
+		var attempts int
+		err := r.do(ctx, func() error {
+			attempts++
+			return rediscache.Nil
+		})
+		assert.ErrorIs(t, err, rediscache.Nil)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("custom classifier", func(t *testing.T) {
+		r := newRetrierWith(RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, IsRetryable: func(err error) bool {
+			return errors.Is(err, ErrCacheMiss)
+		}})
+		var attempts int
+		_ = r.do(ctx, func() error {
+			attempts++
+			return ErrCacheMiss
+		})
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("respects the deadline", func(t *testing.T) {
+		r := newRetrierWith(RetryPolicy{MaxAttempts: 10, MinBackoff: 100 * time.Millisecond})
+		deadlineCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+
+		var attempts int
+		start := time.Now()
+		err := r.do(deadlineCtx, func() error {
+			attempts++
+			return errTransient
+		})
+		assert.ErrorIs(t, err, errTransient)
+		assert.Equal(t, 1, attempts, "the retry wouldn't complete before the deadline")
+		assert.Less(t, time.Since(start), 20*time.Millisecond)
+	})
+
+	t.Run("backoff", func(t *testing.T) {
+		r := newRetrierWith(RetryPolicy{MinBackoff: 10 * time.Millisecond, MaxBackoff: 40 * time.Millisecond})
+		for attempt, max := range []time.Duration{10, 20, 40, 40, 40} {
+			max *= time.Millisecond
+			for i := 0; i < 100; i++ {
+				wait := r.backoff(attempt + 1)
+				assert.GreaterOrEqual(t, wait, max/2)
+				assert.LessOrEqual(t, wait, max)
+			}
+		}
+		assert.LessOrEqual(t, r.backoff(1000), 40*time.Millisecond)
+	})
+}
+
+// countingHook counts the commands sent by a redis client.
+type countingHook struct {
+	processed atomic.Int64
+}
+
+func (h *countingHook) BeforeProcess(ctx context.Context, _ rediscache.Cmder) (context.Context, error) {
+	h.processed.Add(1)
+	return ctx, nil
+}
+
+func (h *countingHook) AfterProcess(context.Context, rediscache.Cmder) error { return nil }
+
+func (h *countingHook) BeforeProcessPipeline(ctx context.Context, _ []rediscache.Cmder) (context.Context, error) {
+	h.processed.Add(1)
+	return ctx, nil
+}
+
+func (h *countingHook) AfterProcessPipeline(context.Context, []rediscache.Cmder) error { return nil }
+
+func TestRedisRetryPolicy(t *testing.T) {
+	ctx := context.Background()
+
+	// nothing listens on the port, every attempt fails with a connection error
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	hook := &countingHook{}
+	client := rediscache.NewClient(&rediscache.Options{Addr: addr, MaxRetries: -1})
+	client.AddHook(hook)
+	defer client.Close()
+
+	policy := WithRetryPolicy(RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond})
+	byteCache := NewRedisCacheWithClient(ctx, client, time.Minute, policy)
+	simpleCache := NewRedisSimpleCache(client, nil, time.Minute, policy)
+
+	operations := map[string]func() error{
+		"Get": func() error {
+			_, err := byteCache.Get(ctx, "key")
+			return err
+		},
+		"BatchSet": func() error {
+			return byteCache.BatchSet(ctx, "key1", []byte("1"), "key2", []byte("2"))
+		},
+		"BatchGet": func() error {
+			_, err := byteCache.BatchGet(ctx, "key1", "key2")
+			return err
+		},
+		"SimpleSet": func() error {
+			return simpleCache.Set(ctx, "key", 1)
+		},
+		"SimpleDel": func() error {
+			return simpleCache.Del(ctx, "key")
+		},
+	}
+	for name, operation := range operations {
+		t.Run(name, func(t *testing.T) {
+			hook.processed.Store(0)
+			err := operation()
+			assert.True(t, IsRetryableRedisError(err), err)
+			assert.EqualValues(t, 3, hook.processed.Load())
+		})
+	}
+
+	t.Run("invalid batch isn't retried", func(t *testing.T) {
+		hook.processed.Store(0)
+		assert.ErrorIs(t, byteCache.BatchSet(ctx, "key", "not bytes"), ErrInvalidValue)
+		assert.Zero(t, hook.processed.Load())
+	})
+}
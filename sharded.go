@@ -0,0 +1,461 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"runtime"
+	"sync"
+	"time"
+)
+
+var _ TTLCache = (*ShardedCache[string, string])(nil)
+
+// ShardedCache is an in-process cache splitting the keys over several shards, each one with its own lock,
+// to reduce the contention under parallel load. Entries have their own ttl and expired entries are evicted
+// when read, or by the janitor if configured.
+type ShardedCache[K comparable, V any] struct {
+	shards []*shard[K, V]
+	ttl    time.Duration
+	opts   options
+
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+type shard[K comparable, V any] struct {
+	mu       sync.Mutex
+	entries  map[K]*shardEntry[V]
+	evictor  Evictor[K]
+	capacity int
+	// maxBytes is the shard byte budget, 0 when the cache is bounded by count only
+	maxBytes int64
+	used     int64
+}
+
+type shardEntry[V any] struct {
+	value V
+	// expiresAt is the expiration in unix nanoseconds, 0 means no expiration
+	expiresAt int64
+	// ttl is the ttl the value was set with, which a read extends it by with sliding expiration
+	ttl time.Duration
+	// bornAt is when the value was set in unix nanoseconds, to bound its lifetime with sliding expiration
+	bornAt int64
+	size   int64
+}
+
+// remove deletes an entry the evictor still tracks.
+func (s *shard[K, V]) remove(key K, e *shardEntry[V]) {
+	delete(s.entries, key)
+	s.evictor.Remove(key)
+	s.used -= e.size
+}
+
+func (e *shardEntry[V]) expired(now int64) bool {
+	return e.expiresAt != 0 && e.expiresAt <= now
+}
+
+// expiredEntry is an entry removed because of its ttl, reported once the shard lock is released.
+type expiredEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// NewShardedCache creates a new ShardedCache evicting the least recently used keys, unless another policy
+// is selected by WithEvictionPolicy. capacity is the maximum number of entries, split evenly between the shards,
+// 0 means unbounded. shards defaults to 4 times GOMAXPROCS when it's not positive, and is reduced to capacity
+// when it's larger. With WithMaxBytes the byte budget is split evenly between the shards as well.
+// An unknown policy returns ErrUnsupportedPolicy.
+func NewShardedCache[K comparable, V any](shards, capacity int, ttl time.Duration, opts ...Option) (*ShardedCache[K, V], error) {
+	newEvictor, err := newEvictorFunc[K](newOptions(opts).policy)
+	if err != nil {
+		return nil, err
+	}
+	return newShardedCache[K, V](shards, capacity, ttl, newEvictor, opts), nil
+}
+
+// shardCapacity returns the capacity of the shard i out of shards, spreading the remainder
+// over the first shards so the capacities add up to capacity.
+func shardCapacity(capacity, shards, i int) int {
+	if capacity <= 0 {
+		return 0
+	}
+	perShard := capacity / shards
+	if i < capacity%shards {
+		perShard++
+	}
+	return perShard
+}
+
+// NewShardedCacheWithEvictor creates a new ShardedCache where each shard uses an Evictor created by newEvictor.
+func NewShardedCacheWithEvictor[K comparable, V any](shards, capacity int, ttl time.Duration, newEvictor func() Evictor[K], opts ...Option) *ShardedCache[K, V] {
+	return newShardedCache[K, V](shards, capacity, ttl, func(int) Evictor[K] {
+		return newEvictor()
+	}, opts)
+}
+
+// newShardedCache creates a new ShardedCache where each shard uses an Evictor created by newEvictor for its capacity.
+func newShardedCache[K comparable, V any](shards, capacity int, ttl time.Duration, newEvictor func(capacity int) Evictor[K], opts []Option) *ShardedCache[K, V] {
+	if shards <= 0 {
+		shards = 4 * runtime.GOMAXPROCS(0)
+	}
+	if capacity > 0 && shards > capacity {
+		// a shard of capacity 0 would be unbounded
+		shards = capacity
+	}
+
+	c := &ShardedCache[K, V]{
+		shards:  make([]*shard[K, V], shards),
+		ttl:     ttl,
+		opts:    newOptions(opts),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	var bytesPerShard int64
+	if c.opts.maxBytes > 0 {
+		bytesPerShard = (c.opts.maxBytes + int64(shards) - 1) / int64(shards)
+	}
+	for i := range c.shards {
+		perShard := shardCapacity(capacity, shards, i)
+		c.shards[i] = &shard[K, V]{
+			entries:  make(map[K]*shardEntry[V]),
+			evictor:  newEvictor(perShard),
+			capacity: perShard,
+			maxBytes: bytesPerShard,
+		}
+	}
+
+	if c.opts.janitorInterval > 0 {
+		go c.janitor(c.opts.janitorInterval)
+	} else {
+		close(c.stopped)
+	}
+	return c
+}
+
+func (c *ShardedCache[K, V]) Set(ctx context.Context, key any, value any) (err error) {
+	return c.SetWithTTL(ctx, key, value, c.ttl)
+}
+
+func (c *ShardedCache[K, V]) SetWithTTL(_ context.Context, key any, value any, ttl time.Duration) (err error) {
+	defer wrapCacheError(&err, backendSharded, "set", key)
+	k, ok := key.(K)
+	if !ok {
+		return ErrInvalidKey
+	}
+	v, ok := value.(V)
+	if !ok {
+		return ErrInvalidValue
+	}
+	return c.store(k, v, ttl)
+}
+
+func (c *ShardedCache[K, V]) Get(_ context.Context, key any, value any) (err error) {
+	defer wrapCacheError(&err, backendSharded, "get", key)
+	k, ok := key.(K)
+	if !ok {
+		return ErrInvalidKey
+	}
+	v, found := c.load(k)
+	if !found {
+		return ErrCacheMiss
+	}
+	dst, ok := value.(*V)
+	if !ok {
+		return ErrInvalidValue
+	}
+	*dst = v
+	return nil
+}
+
+func (c *ShardedCache[K, V]) Del(_ context.Context, keys ...any) (err error) {
+	defer wrapCacheError(&err, backendSharded, "del", singleKey(keys))
+	for _, key := range keys {
+		k, ok := key.(K)
+		if !ok {
+			return ErrInvalidKey
+		}
+		s := c.shard(k)
+		s.mu.Lock()
+		if e, found := s.entries[k]; found {
+			s.remove(k, e)
+		}
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+func (c *ShardedCache[K, V]) Clear(_ context.Context) (err error) {
+	defer wrapCacheError(&err, backendSharded, "clear", nil)
+	for _, s := range c.shards {
+		s.mu.Lock()
+		for k := range s.entries {
+			s.evictor.Remove(k)
+		}
+		s.entries = make(map[K]*shardEntry[V])
+		s.used = 0
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// Len returns the number of entries, including the expired ones not evicted yet.
+func (c *ShardedCache[K, V]) Len() (n int) {
+	for _, s := range c.shards {
+		s.mu.Lock()
+		n += len(s.entries)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// Close stops the janitor, the entries are kept.
+func (c *ShardedCache[K, V]) Close() error {
+	c.once.Do(func() {
+		close(c.stop)
+	})
+	<-c.stopped
+	return nil
+}
+
+func (c *ShardedCache[K, V]) store(key K, value V, ttl time.Duration) error {
+	now := time.Now()
+	ttl = c.opts.jitter.apply(ttl)
+	bounded := ttl
+	if c.opts.sliding {
+		bounded, _ = slidingTTL(ttl, now, c.opts.maxLifetime, now)
+	}
+	var expiresAt int64
+	if bounded > 0 {
+		expiresAt = now.Add(bounded).UnixNano()
+	}
+
+	s := c.shard(key)
+	var size int64
+	if s.maxBytes > 0 {
+		size = c.opts.sizer(key, value)
+		if size > s.maxBytes {
+			return fmt.Errorf("%w: size %d exceeds the shard capacity of %d bytes", ErrInvalidValue, size, s.maxBytes)
+		}
+	}
+
+	s.mu.Lock()
+	if e, found := s.entries[key]; found {
+		s.used += size - e.size
+		e.value = value
+		e.expiresAt = expiresAt
+		e.ttl = ttl
+		e.bornAt = now.UnixNano()
+		e.size = size
+		s.evictor.Access(key)
+	} else {
+		s.entries[key] = &shardEntry[V]{value: value, expiresAt: expiresAt, ttl: ttl, bornAt: now.UnixNano(), size: size}
+		s.used += size
+		s.evictor.Add(key)
+	}
+	for (s.capacity > 0 && len(s.entries) > s.capacity) || (s.maxBytes > 0 && s.used > s.maxBytes) {
+		victim, ok := s.evictor.Evict()
+		if !ok {
+			break
+		}
+		if e, found := s.entries[victim]; found {
+			delete(s.entries, victim)
+			s.used -= e.size
+		}
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+func (c *ShardedCache[K, V]) load(key K) (value V, found bool) {
+	s := c.shard(key)
+	s.mu.Lock()
+	e, found := s.entries[key]
+	if !found {
+		s.mu.Unlock()
+		return value, false
+	}
+	now := time.Now()
+	if e.expired(now.UnixNano()) || (c.opts.sliding && !c.slide(e, now)) {
+		s.remove(key, e)
+		s.mu.Unlock()
+		c.notifyExpired([]expiredEntry[K, V]{{key: key, value: e.value}})
+		return value, false
+	}
+	s.evictor.Access(key)
+	value = e.value
+	s.mu.Unlock()
+	return value, true
+}
+
+func (c *ShardedCache[K, V]) janitor(interval time.Duration) {
+	defer close(c.stopped)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.sweep()
+		}
+	}
+}
+
+// sweep evicts the expired entries of every shard.
+func (c *ShardedCache[K, V]) sweep() {
+	for _, s := range c.shards {
+		var expired []expiredEntry[K, V]
+		now := time.Now().UnixNano()
+		s.mu.Lock()
+		for k, e := range s.entries {
+			if e.expired(now) {
+				s.remove(k, e)
+				expired = append(expired, expiredEntry[K, V]{key: k, value: e.value})
+			}
+		}
+		s.mu.Unlock()
+		c.notifyExpired(expired)
+	}
+}
+
+func (c *ShardedCache[K, V]) notifyExpired(expired []expiredEntry[K, V]) {
+	if c.opts.onExpire == nil {
+		return
+	}
+	for _, e := range expired {
+		c.opts.onExpire(e.key, e.value)
+	}
+}
+
+func (c *ShardedCache[K, V]) shard(key K) *shard[K, V] {
+	return c.shards[hashKey(key)%uint64(len(c.shards))]
+}
+
+// hashKey hashes the common key types without allocating and falls back to their string representation.
+func hashKey(key any) uint64 {
+	switch k := key.(type) {
+	case string:
+		return fnv1a(k)
+	case int:
+		return mix64(uint64(k))
+	case int64:
+		return mix64(uint64(k))
+	case int32:
+		return mix64(uint64(k))
+	case uint:
+		return mix64(uint64(k))
+	case uint64:
+		return mix64(k)
+	case uint32:
+		return mix64(uint64(k))
+	default:
+		h := fnv.New64a()
+		_, _ = fmt.Fprint(h, key)
+		return h.Sum64()
+	}
+}
+
+func fnv1a(s string) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= prime64
+	}
+	return h
+}
+
+// mix64 is the splitmix64 finalizer, it spreads sequential integers over the shards.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+var _ Cache = (*shardedMemCache)(nil)
+
+// shardedMemCache is the Cache implementation backed by a ShardedCache.
+type shardedMemCache struct {
+	cache *ShardedCache[string, []byte]
+}
+
+// NewShardedMemCache creates an in-process Cache backed by a ShardedCache,
+// see NewShardedCache for the meaning of the parameters.
+func NewShardedMemCache(shards, capacity int, ttl time.Duration, opts ...Option) (*shardedMemCache, error) {
+	cache, err := NewShardedCache[string, []byte](shards, capacity, ttl, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &shardedMemCache{
+		cache: cache,
+	}, nil
+}
+
+func (s *shardedMemCache) Set(_ context.Context, key string, value []byte) (err error) {
+	defer wrapCacheError(&err, backendSharded, "set", key)
+	return s.cache.store(key, value, s.cache.ttl)
+}
+
+func (s *shardedMemCache) Get(_ context.Context, key string) ([]byte, error) {
+	value, found := s.cache.load(key)
+	if !found {
+		return nil, ErrCacheMiss
+	}
+	return value, nil
+}
+
+func (s *shardedMemCache) Del(ctx context.Context, key string) error {
+	return s.cache.Del(ctx, key)
+}
+
+func (s *shardedMemCache) BatchGet(_ context.Context, keys ...string) (result [][]byte, err error) {
+	result = make([][]byte, 0, len(keys))
+	for _, k := range keys {
+		value, _ := s.cache.load(k)
+		result = append(result, value)
+	}
+	return result, nil
+}
+
+func (s *shardedMemCache) BatchSet(_ context.Context, keyvalues ...interface{}) (err error) {
+	defer wrapCacheError(&err, backendSharded, "batch set", nil)
+	if len(keyvalues)%2 != 0 {
+		return oddKeyValues(len(keyvalues))
+	}
+
+	for i := 0; i < len(keyvalues); i += 2 {
+		key, ok := keyvalues[i].(string)
+		if !ok {
+			return fmt.Errorf("%w at index %d: expected string, got %T", ErrInvalidKey, i, keyvalues[i])
+		}
+
+		value, ok := keyvalues[i+1].([]byte)
+		if !ok {
+			return fmt.Errorf("%w at index %d: expected []byte, got %T", ErrInvalidValue, i+1, keyvalues[i+1])
+		}
+
+		if err := s.cache.store(key, value, s.cache.ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *shardedMemCache) IsRunning(_ context.Context) bool {
+	return true
+}
+
+func (s *shardedMemCache) Close() error {
+	_ = s.cache.Clear(context.Background())
+	return s.cache.Close()
+}
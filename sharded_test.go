@@ -0,0 +1,235 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/shaj13/libcache"
+	_ "github.com/shaj13/libcache/lru"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardedCache(t *testing.T) {
+	ctx := context.Background()
+	cache, err := NewShardedCache[string, string](4, 0, time.Minute)
+	require.NoError(t, err)
+	defer cache.Close()
+
+	t.Run("Set and Get", func(t *testing.T) {
+		require.NoError(t, cache.Set(ctx, "key1", "value1"))
+
+		value, err := Get[string](ctx, cache, "key1")
+		require.NoError(t, err)
+		assert.Equal(t, "value1", value)
+	})
+
+	t.Run("invalid key and value", func(t *testing.T) {
+		require.ErrorIs(t, cache.Set(ctx, 1, "value"), ErrInvalidKey)
+		require.ErrorIs(t, cache.Set(ctx, "key2", 2), ErrInvalidValue)
+		require.ErrorIs(t, cache.SetWithTTL(ctx, 1, "value", time.Minute), ErrInvalidKey)
+
+		require.NoError(t, cache.Set(ctx, "key2", "value2"))
+		var value int
+		require.ErrorIs(t, cache.Get(ctx, "key2", &value), ErrInvalidValue)
+	})
+
+	t.Run("Del and Clear", func(t *testing.T) {
+		require.NoError(t, cache.Set(ctx, "key3", "value3"))
+		require.NoError(t, cache.Set(ctx, "key4", "value4"))
+
+		require.NoError(t, cache.Del(ctx, "key3"))
+		assert.ErrorIs(t, cache.Get(ctx, "key3", new(string)), ErrCacheMiss)
+
+		require.NoError(t, cache.Clear(ctx))
+		assert.ErrorIs(t, cache.Get(ctx, "key4", new(string)), ErrCacheMiss)
+		assert.Zero(t, cache.Len())
+	})
+
+	t.Run("SetWithTTL expiration", func(t *testing.T) {
+		require.NoError(t, cache.SetWithTTL(ctx, "key5", "value5", time.Millisecond))
+		time.Sleep(2 * time.Millisecond)
+		assert.ErrorIs(t, cache.Get(ctx, "key5", new(string)), ErrCacheMiss)
+	})
+}
+
+func TestShardedCacheEviction(t *testing.T) {
+	ctx := context.Background()
+	cache, err := NewShardedCache[int, int](1, 3, time.Minute)
+	require.NoError(t, err)
+
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, cache.Set(ctx, i, i))
+	}
+	// key 1 becomes the most recently used
+	require.NoError(t, cache.Get(ctx, 1, new(int)))
+	require.NoError(t, cache.Set(ctx, 4, 4))
+
+	assert.Equal(t, 3, cache.Len())
+	assert.ErrorIs(t, cache.Get(ctx, 2, new(int)), ErrCacheMiss)
+	for _, key := range []int{1, 3, 4} {
+		assert.NoError(t, cache.Get(ctx, key, new(int)), "key %d", key)
+	}
+}
+
+func TestShardedCacheCapacity(t *testing.T) {
+	ctx := context.Background()
+
+	for _, policy := range []EvictionPolicy{PolicyLRU, PolicyARC, PolicyWTinyLFU} {
+		t.Run(policy.String(), func(t *testing.T) {
+			cache, err := NewShardedCache[int, int](64, 100, time.Minute, WithEvictionPolicy(policy))
+			require.NoError(t, err)
+			for i := 0; i < 1000; i++ {
+				require.NoError(t, cache.Set(ctx, i, i))
+			}
+			assert.LessOrEqual(t, cache.Len(), 100)
+
+			total := 0
+			for _, s := range cache.shards {
+				total += s.capacity
+			}
+			assert.Equal(t, 100, total, "the shard capacities add up to the capacity")
+		})
+	}
+
+	t.Run("more shards than entries", func(t *testing.T) {
+		cache, err := NewShardedCache[int, int](8, 3, time.Minute)
+		require.NoError(t, err)
+		assert.Len(t, cache.shards, 3)
+		for i := 0; i < 10; i++ {
+			require.NoError(t, cache.Set(ctx, i, i))
+		}
+		assert.Equal(t, 3, cache.Len())
+	})
+}
+
+func TestShardedCacheJanitor(t *testing.T) {
+	ctx := context.Background()
+
+	expired := make(chan any, 10)
+	cache, err := NewShardedCache[string, string](4, 0, 10*time.Millisecond,
+		WithJanitor(5*time.Millisecond),
+		WithExpiryCallback(func(key, value any) {
+			expired <- key
+		}),
+	)
+	require.NoError(t, err)
+	defer cache.Close()
+
+	require.NoError(t, cache.Set(ctx, "key1", "value1"))
+	require.NoError(t, cache.SetWithTTL(ctx, "key2", "value2", 0))
+
+	select {
+	case key := <-expired:
+		assert.Equal(t, "key1", key)
+	case <-time.After(time.Second):
+		t.Fatal("expiry callback not called")
+	}
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestShardedMemCache(t *testing.T) {
+	ctx := context.Background()
+	cache, err := NewShardedMemCache(0, 0, time.Minute)
+	require.NoError(t, err)
+	defer cache.Close()
+
+	require.NoError(t, cache.BatchSet(ctx, "key1", []byte("value1"), "key2", []byte("value2")))
+	require.ErrorIs(t, cache.BatchSet(ctx, 1, []byte("value")), ErrInvalidKey)
+	require.ErrorIs(t, cache.BatchSet(ctx, "key3", "value"), ErrInvalidValue)
+
+	values, err := cache.BatchGet(ctx, "key2", "missing", "key1")
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("value2"), nil, []byte("value1")}, values)
+
+	require.NoError(t, cache.Del(ctx, "key1"))
+	_, err = cache.Get(ctx, "key1")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+}
+
+func TestShardedCacheMaxBytes(t *testing.T) {
+	ctx := context.Background()
+	cache, err := NewShardedCache[string, string](1, 0, time.Minute, WithMaxBytes(10))
+	require.NoError(t, err)
+
+	require.NoError(t, cache.Set(ctx, "key1", "1234"))
+	require.NoError(t, cache.Set(ctx, "key2", "1234"))
+	require.NoError(t, cache.Set(ctx, "key3", "1234"))
+	assert.ErrorIs(t, cache.Get(ctx, "key1", new(string)), ErrCacheMiss)
+	assert.Equal(t, 2, cache.Len())
+
+	require.ErrorIs(t, cache.Set(ctx, "key4", "12345678901"), ErrInvalidValue)
+	require.NoError(t, cache.Set(ctx, "key5", "1234567890"))
+	assert.Equal(t, 1, cache.Len())
+}
+
+func BenchmarkParallelCache(b *testing.B) {
+	ctx := context.Background()
+	const keys = 1 << 14
+	names := make([]string, keys)
+	for i := range names {
+		names[i] = "key" + strconv.Itoa(i)
+	}
+
+	run := func(b *testing.B, set func(key string, value []byte), get func(key string)) {
+		for _, name := range names {
+			set(name, []byte(name))
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			i := 0
+			for pb.Next() {
+				name := names[i%keys]
+				// 90% reads, 10% writes
+				if i%10 == 0 {
+					set(name, []byte(name))
+				} else {
+					get(name)
+				}
+				i++
+			}
+		})
+	}
+
+	b.Run("Libcache", func(b *testing.B) {
+		cache, _ := NewLibcache(keys, time.Minute)
+		run(b, func(key string, value []byte) {
+			_ = cache.Set(ctx, key, value)
+		}, func(key string) {
+			_, _ = cache.Get(ctx, key)
+		})
+	})
+
+	b.Run("TypedLibCache", func(b *testing.B) {
+		cache := NewTypedLibCache[string, []byte](libcache.LRU.New(keys), time.Minute)
+		run(b, func(key string, value []byte) {
+			_ = cache.Set(ctx, key, value)
+		}, func(key string) {
+			var value []byte
+			_ = cache.Get(ctx, key, &value)
+		})
+	})
+
+	b.Run("ShardedMemCache", func(b *testing.B) {
+		cache, _ := NewShardedMemCache(0, keys, time.Minute)
+		run(b, func(key string, value []byte) {
+			_ = cache.Set(ctx, key, value)
+		}, func(key string) {
+			_, _ = cache.Get(ctx, key)
+		})
+	})
+
+	b.Run("ShardedCache", func(b *testing.B) {
+		cache, err := NewShardedCache[string, []byte](0, keys, time.Minute)
+		require.NoError(b, err)
+		run(b, func(key string, value []byte) {
+			_ = cache.Set(ctx, key, value)
+		}, func(key string) {
+			var value []byte
+			_ = cache.Get(ctx, key, &value)
+		})
+	})
+}
@@ -0,0 +1,227 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	rediscache "github.com/go-redis/redis/v8"
+)
+
+// slidingTTL bounds ttl so the entry born at birth doesn't outlive maxLifetime, 0 meaning no limit.
+// It returns false once the lifetime is over.
+func slidingTTL(ttl time.Duration, birth time.Time, maxLifetime time.Duration, now time.Time) (time.Duration, bool) {
+	if maxLifetime <= 0 {
+		return ttl, true
+	}
+	remaining := birth.Add(maxLifetime).Sub(now)
+	if remaining <= 0 {
+		return 0, false
+	}
+	if ttl <= 0 || remaining < ttl {
+		return remaining, true
+	}
+	return ttl, true
+}
+
+// lifetime is the sliding expiration of an entry: the ttl a read extends it by, and when it was set.
+type lifetime struct {
+	ttl   time.Duration
+	birth time.Time
+}
+
+// set stores a new value for key, it must be called with the lock held.
+// With sliding expiration the entry lifetime starts over.
+func (l *TypedLibCache[K, T]) set(key any, value any, ttl time.Duration) error {
+	ttl = l.opts.jitter.apply(ttl)
+	if l.lifetimes == nil {
+		return l.store(key, value, ttl)
+	}
+	now := time.Now()
+	bounded, _ := slidingTTL(ttl, now, l.opts.maxLifetime, now)
+	if err := l.store(key, value, bounded); err != nil {
+		return err
+	}
+	l.lifetimes[key] = lifetime{ttl: ttl, birth: now}
+	return nil
+}
+
+// slide resets the ttl of the entry just read to the ttl it was set with, within its max lifetime.
+// It returns false when the entry outlived it, it must be called with the lock held.
+func (l *TypedLibCache[K, T]) slide(key any, value any) bool {
+	lt, found := l.lifetimes[key]
+	if !found {
+		return true
+	}
+	ttl, alive := slidingTTL(lt.ttl, lt.birth, l.opts.maxLifetime, time.Now())
+	if !alive {
+		l.cache.Delete(key)
+		return false
+	}
+	if ttl <= 0 {
+		return true
+	}
+	// storing the entry again resets its ttl, its tags have to be restored
+	tags := l.keyTags[key]
+	if err := l.store(key, value, ttl); err != nil {
+		return false
+	}
+	l.tag(key, tags)
+	return true
+}
+
+// slide resets the expiration of the entry just read to the ttl it was set with, within its max lifetime.
+// It returns false when the entry outlived it, it must be called with the shard lock held.
+func (c *ShardedCache[K, V]) slide(e *shardEntry[V], now time.Time) bool {
+	ttl, alive := slidingTTL(e.ttl, time.Unix(0, e.bornAt), c.opts.maxLifetime, now)
+	if !alive {
+		return false
+	}
+	if ttl > 0 {
+		e.expiresAt = now.Add(ttl).UnixNano()
+	}
+	return true
+}
+
+// redisSlidingPrefix prefixes the hashes holding the sliding expiration of a key under the internal prefix: the ttl
+// in milliseconds a read extends it by, 0 for no expiration, and its deadline in unix milliseconds, 0 when its lifetime
+// isn't bounded.
+const redisSlidingPrefix = "sliding:"
+
+// slidingPrefix returns the prefix of the sliding expiration hashes, empty when sliding expiration is disabled.
+func (r *RedisSimpleCache) slidingPrefix() string {
+	if !r.opts.sliding {
+		return ""
+	}
+	return r.opts.internalKey(redisSlidingPrefix, "")
+}
+
+// getSlidingScript reads KEYS[1] and extends its ttl to the one it was set with, stored in KEYS[2], without going
+// beyond its deadline compared to the time ARGV[1] in unix milliseconds. Its tag index KEYS[3] and tag sets are
+// extended along. A key without sliding expiration keeps its ttl.
+var getSlidingScript = rediscache.NewScript(`
+local value = redis.call('GET', KEYS[1])
+if not value then
+	return false
+end
+local state = redis.call('HMGET', KEYS[2], 'ttl', 'deadline')
+local ttl = tonumber(state[1])
+if not ttl then
+	return value
+end
+local deadline = tonumber(state[2]) or 0
+if deadline > 0 then
+	local remaining = deadline - tonumber(ARGV[1])
+	if remaining <= 0 then
+		redis.call('DEL', KEYS[1], KEYS[2])
+		return false
+	end
+	if ttl <= 0 or remaining < ttl then
+		ttl = remaining
+	end
+end
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+	redis.call('PEXPIRE', KEYS[2], ttl)
+	if redis.call('PEXPIRE', KEYS[3], ttl) == 1 then
+		for _, tag in ipairs(redis.call('SMEMBERS', KEYS[3])) do
+			local current = redis.call('PTTL', tag)
+			if current >= 0 and current < ttl then
+				redis.call('PEXPIRE', tag, ttl)
+			end
+		end
+	end
+end
+return value
+`)
+
+// get reads key, extending its ttl with sliding expiration.
+func (r *RedisSimpleCache) get(ctx context.Context, key string) (data []byte, err error) {
+	err = r.opts.do(ctx, opRead, func(ctx context.Context) (err error) {
+		data, err = r.getOnce(ctx, key)
+		return err
+	})
+	return data, err
+}
+
+func (r *RedisSimpleCache) getOnce(ctx context.Context, key string) ([]byte, error) {
+	if !r.opts.sliding {
+		return r.client.Get(ctx, key).Bytes()
+	}
+	keys := []string{key, r.opts.internalKey(redisSlidingPrefix, key), r.opts.internalKey(redisKeyTagsPrefix, key)}
+	value, err := getSlidingScript.Run(ctx, r.client, keys, time.Now().UnixMilli()).Text()
+	return []byte(value), err
+}
+
+// set writes key, along with its sliding expiration if enabled.
+func (r *RedisSimpleCache) set(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	ttl = r.opts.jitter.apply(ttl)
+	return r.opts.do(ctx, opWrite, func(ctx context.Context) error {
+		if !r.opts.sliding {
+			return r.client.Set(ctx, key, data, ttl).Err()
+		}
+		return writeScript.Run(ctx, r.client, r.writeKeys(key, nil)[:2], r.writeArgs(data, ttl, time.Now())...).Err()
+	})
+}
+
+// writeArgs returns the ARGV of writeScript for a value set at now.
+func (r *RedisSimpleCache) writeArgs(data []byte, ttl time.Duration, now time.Time) []any {
+	own, deadline := int64(-1), int64(0)
+	if r.opts.sliding {
+		own = redisMilliseconds(ttl)
+		if r.opts.maxLifetime > 0 {
+			ttl, _ = slidingTTL(ttl, now, r.opts.maxLifetime, now)
+			deadline = now.Add(r.opts.maxLifetime).UnixMilli()
+		}
+	}
+	return []any{data, redisMilliseconds(ttl), own, deadline}
+}
+
+// delScript deletes the keys KEYS and returns how many existed. Given the prefix of the tag indexes ARGV[1],
+// the keys are removed from their tag sets, and given the prefix ARGV[2] their sliding expiration is deleted too.
+var delScript = rediscache.NewScript(`
+local n = 0
+for _, key in ipairs(KEYS) do
+	if ARGV[1] ~= '' then
+		local index = ARGV[1] .. key
+		for _, tag in ipairs(redis.call('SMEMBERS', index)) do
+			redis.call('SREM', tag, key)
+		end
+		redis.call('DEL', index)
+	end
+	if ARGV[2] ~= '' then
+		redis.call('DEL', ARGV[2] .. key)
+	end
+	n = n + redis.call('DEL', key)
+end
+return n
+`)
+
+// del deletes keys and returns how many existed. Once the cache set tagged entries, the keys are removed
+// from their tags, and with sliding expiration their sliding state is deleted; otherwise it's a plain DEL.
+func (r *RedisSimpleCache) del(ctx context.Context, keys ...string) (n int, err error) {
+	err = r.opts.do(ctx, opWrite, func(ctx context.Context) error {
+		if !r.opts.sliding && !r.tagged.Load() {
+			deleted, err := r.client.Del(ctx, keys...).Result()
+			n = int(deleted)
+			return err
+		}
+		var index string
+		if r.tagged.Load() {
+			index = r.opts.internalKey(redisKeyTagsPrefix, "")
+		}
+		n, err = delScript.Run(ctx, r.client, keys, index, r.slidingPrefix()).Int()
+		return err
+	})
+	return n, err
+}
+
+// redisMilliseconds converts ttl to milliseconds for redis, rounding a ttl under a millisecond up rather than to 0.
+func redisMilliseconds(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	if ms := ttl.Milliseconds(); ms > 0 {
+		return ms
+	}
+	return 1
+}
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shaj13/libcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLibCacheSlidingExpiration(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("reads extend the ttl", func(t *testing.T) {
+		cache := NewTypedLibCache[string, string](libcache.LRU.New(0), 30*time.Millisecond, WithSlidingExpiration(0))
+		require.NoError(t, cache.Set(ctx, "key1", "value1"))
+		for i := 0; i < 5; i++ {
+			time.Sleep(15 * time.Millisecond)
+			require.NoError(t, cache.Get(ctx, "key1", new(string)))
+		}
+		time.Sleep(40 * time.Millisecond)
+		assert.ErrorIs(t, cache.Get(ctx, "key1", new(string)), ErrCacheMiss)
+	})
+
+	t.Run("max lifetime", func(t *testing.T) {
+		cache := NewTypedLibCache[string, string](libcache.LRU.New(0), 30*time.Millisecond, WithSlidingExpiration(50*time.Millisecond))
+		require.NoError(t, cache.SetWithTags(ctx, "key1", "value1", time.Hour, "tag"))
+		ttl, err := cache.TTL(ctx, "key1")
+		require.NoError(t, err)
+		assert.LessOrEqual(t, ttl, 50*time.Millisecond)
+
+		deadline := time.Now().Add(50 * time.Millisecond)
+		for time.Now().Before(deadline.Add(-10 * time.Millisecond)) {
+			require.NoError(t, cache.Get(ctx, "key1", new(string)))
+			time.Sleep(5 * time.Millisecond)
+		}
+		assert.Contains(t, cache.tags, "tag")
+		time.Sleep(time.Until(deadline))
+		assert.ErrorIs(t, cache.Get(ctx, "key1", new(string)), ErrCacheMiss)
+		assert.Empty(t, cache.lifetimes)
+		assert.Empty(t, cache.tags)
+	})
+
+	t.Run("own ttl", func(t *testing.T) {
+		cache := NewTypedLibCache[string, string](libcache.LRU.New(0), 30*time.Millisecond, WithSlidingExpiration(0))
+		require.NoError(t, cache.SetWithTTL(ctx, "hour", "value", time.Hour))
+		require.NoError(t, cache.SetWithTTL(ctx, "forever", "value", 0))
+		require.NoError(t, cache.Get(ctx, "hour", new(string)))
+		require.NoError(t, cache.Get(ctx, "forever", new(string)))
+
+		ttl, err := cache.TTL(ctx, "hour")
+		require.NoError(t, err)
+		assert.InDelta(t, time.Hour, ttl, float64(time.Second), "a read doesn't shrink the ttl to the default")
+		ttl, err = cache.TTL(ctx, "forever")
+		require.NoError(t, err)
+		assert.Equal(t, NoTTL, ttl, "a read doesn't give an expiration")
+	})
+}
+
+func TestShardedCacheSlidingExpiration(t *testing.T) {
+	ctx := context.Background()
+	cache, err := NewShardedCache[string, string](1, 0, 100*time.Millisecond, WithSlidingExpiration(250*time.Millisecond))
+	require.NoError(t, err)
+
+	deadline := time.Now().Add(250 * time.Millisecond)
+	require.NoError(t, cache.Set(ctx, "key1", "value1"))
+	for time.Now().Before(deadline.Add(-30 * time.Millisecond)) {
+		require.NoError(t, cache.Get(ctx, "key1", new(string)))
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(time.Until(deadline))
+	assert.ErrorIs(t, cache.Get(ctx, "key1", new(string)), ErrCacheMiss)
+
+	t.Run("own ttl", func(t *testing.T) {
+		cache, err := NewShardedCache[string, string](1, 0, 30*time.Millisecond, WithSlidingExpiration(0))
+		require.NoError(t, err)
+		require.NoError(t, cache.SetWithTTL(ctx, "hour", "value", time.Hour))
+		require.NoError(t, cache.SetWithTTL(ctx, "forever", "value", 0))
+		require.NoError(t, cache.Get(ctx, "hour", new(string)))
+		require.NoError(t, cache.Get(ctx, "forever", new(string)))
+
+		s := cache.shard("hour")
+		s.mu.Lock()
+		assert.InDelta(t, time.Hour, time.Until(time.Unix(0, s.entries["hour"].expiresAt)), float64(time.Second))
+		s.mu.Unlock()
+		s = cache.shard("forever")
+		s.mu.Lock()
+		assert.Zero(t, s.entries["forever"].expiresAt)
+		s.mu.Unlock()
+	})
+}
@@ -0,0 +1,212 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	rediscache "github.com/go-redis/redis/v8"
+)
+
+// snapshotHeader starts every snapshot, the last byte is the format version.
+var snapshotHeader = []byte("ICSNAP\x01")
+
+// snapshotMaxFrame bounds the size of a single entry, to fail fast on a corrupted snapshot.
+const snapshotMaxFrame = 1 << 30
+
+// snapshotEntry is a cache entry as written in a snapshot,
+// each one is encoded by the cache codec and prefixed by its length.
+type snapshotEntry[K comparable, T any] struct {
+	Key   K
+	Value T
+	// ExpiresAt is the expiration in unix nanoseconds, 0 means no expiration
+	ExpiresAt int64
+}
+
+// Snapshot writes the entries of the cache to w, encoded by the codec set with WithCodec.
+// The expired entries are skipped and the others keep their expiration, so Restore preserves their remaining TTL.
+func (l *TypedLibCache[K, T]) Snapshot(w io.Writer) (err error) {
+	defer wrapCacheError(&err, backendLibcache, "snapshot", nil)
+	l.lock()
+	l.cache.GC()
+	keys := l.cache.Keys()
+	entries := make([]snapshotEntry[K, T], 0, len(keys))
+	for _, key := range keys {
+		value, found := l.cache.Peek(key)
+		if !found {
+			continue
+		}
+		expiry, _ := l.cache.Expiry(key)
+		entry := snapshotEntry[K, T]{Key: key.(K), Value: value.(T)}
+		if !expiry.IsZero() {
+			entry.ExpiresAt = expiry.UnixNano()
+		}
+		entries = append(entries, entry)
+	}
+	l.unlock()
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(snapshotHeader); err != nil {
+		return err
+	}
+	var size [binary.MaxVarintLen64]byte
+	for _, entry := range entries {
+		data, err := l.opts.codec.Encode(entry)
+		if err != nil {
+			return fmt.Errorf("encoding snapshot entry %v: %w", entry.Key, err)
+		}
+		n := binary.PutUvarint(size[:], uint64(len(data)))
+		if _, err = bw.Write(size[:n]); err != nil {
+			return err
+		}
+		if _, err = bw.Write(data); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Restore loads the entries of a snapshot written by Snapshot into the cache, with their remaining TTL.
+// The entries expired since the snapshot are skipped, and the existing entries with the same key are replaced.
+func (l *TypedLibCache[K, T]) Restore(r io.Reader) (err error) {
+	defer wrapCacheError(&err, backendLibcache, "restore", nil)
+	br := bufio.NewReader(r)
+	header := make([]byte, len(snapshotHeader))
+	if _, err := io.ReadFull(br, header); err != nil {
+		return fmt.Errorf("%w: reading header: %v", ErrInvalidSnapshot, err)
+	}
+	if string(header) != string(snapshotHeader) {
+		return fmt.Errorf("%w: unknown header %q", ErrInvalidSnapshot, header)
+	}
+
+	for {
+		size, err := binary.ReadUvarint(br)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: reading entry size: %v", ErrInvalidSnapshot, err)
+		}
+		if size > snapshotMaxFrame {
+			return fmt.Errorf("%w: entry of %d bytes", ErrInvalidSnapshot, size)
+		}
+		data := make([]byte, size)
+		if _, err = io.ReadFull(br, data); err != nil {
+			return fmt.Errorf("%w: reading entry: %v", ErrInvalidSnapshot, err)
+		}
+
+		var entry snapshotEntry[K, T]
+		if err = l.opts.codec.Decode(data, &entry); err != nil {
+			return fmt.Errorf("decoding snapshot entry: %w", err)
+		}
+		var ttl time.Duration
+		if entry.ExpiresAt != 0 {
+			if ttl = time.Until(time.Unix(0, entry.ExpiresAt)); ttl <= 0 {
+				continue
+			}
+		}
+
+		l.lock()
+		err = l.set(entry.Key, entry.Value, ttl)
+		l.unlock()
+		if err != nil {
+			return fmt.Errorf("restoring key %v: %w", entry.Key, err)
+		}
+	}
+}
+
+// Snapshot writes the entries of the cache to w, see TypedLibCache.Snapshot.
+func (l *memLibCache) Snapshot(w io.Writer) error {
+	return l.cache.Snapshot(w)
+}
+
+// Restore loads the entries of a snapshot written by Snapshot, see TypedLibCache.Restore.
+func (l *memLibCache) Restore(r io.Reader) error {
+	return l.cache.Restore(r)
+}
+
+// warmScanCount is the number of keys asked to redis per SCAN iteration when warming a cache.
+const warmScanCount = 100
+
+// WarmFromRedis copies the keys matching pattern from redis into dst, typically an in-process cache on startup,
+// and returns the number of keys copied. The values are decoded as T with codec, json if nil, as RedisSimpleCache
+// stores them. The keys keep their remaining TTL in redis, the ones without expiration get the dst default TTL.
+func WarmFromRedis[T any](ctx context.Context, client *rediscache.Client, codec Codec, pattern string, dst TTLCache) (n int, err error) {
+	if codec == nil {
+		codec = &JsonCodec{}
+	}
+
+	iter := client.Scan(ctx, 0, pattern, warmScanCount).Iterator()
+	keys := make([]string, 0, warmScanCount)
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) < warmScanCount {
+			continue
+		}
+		copied, err := warmKeys[T](ctx, client, codec, keys, dst)
+		n += copied
+		if err != nil {
+			return n, err
+		}
+		keys = keys[:0]
+	}
+	if err = iter.Err(); err != nil {
+		return n, fmt.Errorf("scanning %s: %w", pattern, err)
+	}
+	copied, err := warmKeys[T](ctx, client, codec, keys, dst)
+	return n + copied, err
+}
+
+// warmKeys copies a batch of keys with their TTL, the keys deleted since the SCAN are skipped.
+func warmKeys[T any](ctx context.Context, client *rediscache.Client, codec Codec, keys []string, dst TTLCache) (n int, err error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	pipeline := client.Pipeline()
+	values := pipeline.MGet(ctx, keys...)
+	ttls := make([]*rediscache.DurationCmd, len(keys))
+	for i, key := range keys {
+		ttls[i] = pipeline.PTTL(ctx, key)
+	}
+	if _, err = pipeline.Exec(ctx); err != nil && !errors.Is(err, rediscache.Nil) {
+		return 0, fmt.Errorf("reading keys: %w", err)
+	}
+
+	for i, raw := range values.Val() {
+		var data []byte
+		switch v := raw.(type) {
+		case string:
+			data = []byte(v)
+		case []byte:
+			data = v
+		default:
+			continue
+		}
+
+		var value T
+		if err = codec.Decode(data, &value); err != nil {
+			return n, fmt.Errorf("decoding %s value: %w", keys[i], err)
+		}
+		ttl := ttls[i].Val()
+		switch {
+		case ttl > 0:
+			err = dst.SetWithTTL(ctx, keys[i], value, ttl)
+		case ttl == -1:
+			// the key has no expiration, redis replies -1
+			err = dst.Set(ctx, keys[i], value)
+		default:
+			// expired in between
+			continue
+		}
+		if err != nil {
+			return n, fmt.Errorf("warming key %s: %w", keys[i], err)
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shaj13/libcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypedLibCacheSnapshot(t *testing.T) {
+	ctx := context.Background()
+
+	type valueStruct struct {
+		Value string
+	}
+
+	for name, codec := range map[string]Codec{"json": &JsonCodec{}, "gob": &GobCodec{}} {
+		t.Run(name, func(t *testing.T) {
+			src := NewTypedLibCache[string, valueStruct](libcache.LRU.New(0), time.Minute, WithCodec(codec))
+			require.NoError(t, src.Set(ctx, "key1", valueStruct{Value: "value1"}))
+			require.NoError(t, src.SetWithTTL(ctx, "key2", valueStruct{Value: "value2"}, 0))
+			require.NoError(t, src.SetWithTTL(ctx, "key3", valueStruct{Value: "value3"}, time.Millisecond))
+			time.Sleep(2 * time.Millisecond)
+
+			var snapshot bytes.Buffer
+			require.NoError(t, src.Snapshot(&snapshot))
+
+			dst := NewTypedLibCache[string, valueStruct](libcache.LRU.New(0), time.Hour, WithCodec(codec))
+			require.NoError(t, dst.Restore(&snapshot))
+
+			value, err := Get[valueStruct](ctx, dst, "key1")
+			require.NoError(t, err)
+			assert.Equal(t, "value1", value.Value)
+			expiry, _ := dst.cache.Expiry("key1")
+			assert.WithinDuration(t, time.Now().Add(time.Minute), expiry, time.Second)
+
+			value, err = Get[valueStruct](ctx, dst, "key2")
+			require.NoError(t, err)
+			assert.Equal(t, "value2", value.Value)
+			expiry, _ = dst.cache.Expiry("key2")
+			assert.True(t, expiry.IsZero())
+
+			assert.ErrorIs(t, dst.Get(ctx, "key3", new(valueStruct)), ErrCacheMiss)
+		})
+	}
+
+	t.Run("expired since the snapshot", func(t *testing.T) {
+		src := NewTypedLibCache[string, string](libcache.LRU.New(0), 5*time.Millisecond)
+		require.NoError(t, src.Set(ctx, "key1", "value1"))
+
+		var snapshot bytes.Buffer
+		require.NoError(t, src.Snapshot(&snapshot))
+		time.Sleep(10 * time.Millisecond)
+
+		dst := NewTypedLibCache[string, string](libcache.LRU.New(0), time.Minute)
+		require.NoError(t, dst.Restore(&snapshot))
+		assert.Zero(t, dst.cache.Len())
+	})
+
+	t.Run("invalid snapshot", func(t *testing.T) {
+		dst := NewTypedLibCache[string, string](libcache.LRU.New(0), time.Minute)
+		require.ErrorIs(t, dst.Restore(bytes.NewBufferString("not a snapshot")), ErrInvalidSnapshot)
+		require.ErrorIs(t, dst.Restore(bytes.NewReader(append(snapshotHeader, 10, '{'))), ErrInvalidSnapshot)
+	})
+}
+
+func TestMemLibCacheSnapshot(t *testing.T) {
+	ctx := context.Background()
+
+	src, err := NewLibcache(0, time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, src.BatchSet(ctx, "key1", []byte("value1"), "key2", []byte("value2")))
+
+	var snapshot bytes.Buffer
+	require.NoError(t, src.Snapshot(&snapshot))
+
+	dst, err := NewLibcache(0, time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, dst.Restore(&snapshot))
+
+	values, err := dst.BatchGet(ctx, "key1", "key2")
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("value1"), []byte("value2")}, values)
+}
@@ -0,0 +1,220 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	rediscache "github.com/go-redis/redis/v8"
+)
+
+var (
+	_ TaggedCache = (*RedisSimpleCache)(nil)
+	_ TaggedCache = (*TypedLibCache[string, string])(nil)
+)
+
+// TaggedCache is a TTLCache able to invalidate its entries by tag, without knowing their keys.
+type TaggedCache interface {
+	TTLCache
+	// SetWithTags sets the key value like SetWithTTL and associates the key to tags,
+	// replacing the tags of a previous value.
+	SetWithTags(ctx context.Context, key any, value any, ttl time.Duration, tags ...string) (err error)
+	// InvalidateTags deletes every entry associated to one of tags.
+	InvalidateTags(ctx context.Context, tags ...string) (err error)
+}
+
+const (
+	// redisTagPrefix prefixes the redis sets holding the keys of a tag, under the internal prefix
+	redisTagPrefix = "tag:"
+	// redisKeyTagsPrefix prefixes the redis sets indexing the tags of a key under the internal prefix,
+	// so SetWithTags removes the key from the tag sets of its previous value
+	redisKeyTagsPrefix = "tags:"
+)
+
+// writeScript sets KEYS[1] to ARGV[1] with a ttl of ARGV[2] milliseconds, 0 for no expiration, along with its sliding
+// expiration KEYS[2]: the ttl ARGV[3] and the deadline ARGV[4], left untouched when ARGV[3] is negative. Given the tag index
+// KEYS[3], it replaces the tags of the key: it's removed from the tag sets listed in the index, and added to the tag
+// sets KEYS[4:], listed in the index instead. The index expires with the key, and a tag set with its longest living key.
+var writeScript = rediscache.NewScript(`
+local ttl = tonumber(ARGV[2])
+if ttl > 0 then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ttl)
+else
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+if tonumber(ARGV[3]) >= 0 then
+	redis.call('DEL', KEYS[2])
+	redis.call('HSET', KEYS[2], 'ttl', ARGV[3], 'deadline', ARGV[4])
+	if ttl > 0 then
+		redis.call('PEXPIRE', KEYS[2], ttl)
+	end
+end
+if #KEYS < 3 then
+	return 1
+end
+for _, tag in ipairs(redis.call('SMEMBERS', KEYS[3])) do
+	redis.call('SREM', tag, KEYS[1])
+end
+redis.call('DEL', KEYS[3])
+if #KEYS < 4 then
+	return 1
+end
+for i = 4, #KEYS do
+	local existed = redis.call('EXISTS', KEYS[i])
+	redis.call('SADD', KEYS[i], KEYS[1])
+	redis.call('SADD', KEYS[3], KEYS[i])
+	if ttl == 0 then
+		redis.call('PERSIST', KEYS[i])
+	else
+		local current = redis.call('PTTL', KEYS[i])
+		if existed == 0 or (current >= 0 and current < ttl) then
+			redis.call('PEXPIRE', KEYS[i], ttl)
+		end
+	end
+end
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[3], ttl)
+end
+return 1
+`)
+
+// writeKeys returns the KEYS of writeScript replacing the tags of key.
+func (r *RedisSimpleCache) writeKeys(key string, tags []string) []string {
+	keys := make([]string, 0, len(tags)+3)
+	keys = append(keys, key, r.opts.internalKey(redisSlidingPrefix, key), r.opts.internalKey(redisKeyTagsPrefix, key))
+	for _, tag := range tags {
+		keys = append(keys, r.opts.internalKey(redisTagPrefix, tag))
+	}
+	return keys
+}
+
+// invalidateTagsScript deletes the keys of the tag sets KEYS and the sets themselves, along with the tag index
+// and the sliding expiration of every key, prefixed by ARGV[1] and ARGV[2], an empty ARGV[2] when sliding expiration
+// is disabled. The keys are removed from their other tags.
+var invalidateTagsScript = rediscache.NewScript(`
+for _, tag in ipairs(KEYS) do
+	for _, key in ipairs(redis.call('SMEMBERS', tag)) do
+		local index = ARGV[1] .. key
+		for _, other in ipairs(redis.call('SMEMBERS', index)) do
+			if other ~= tag then
+				redis.call('SREM', other, key)
+			end
+		end
+		redis.call('DEL', key, index)
+		if ARGV[2] ~= '' then
+			redis.call('DEL', ARGV[2] .. key)
+		end
+	end
+	redis.call('DEL', tag)
+end
+return 1
+`)
+
+// SetWithTags sets the key value and adds the key to the redis set of every tag, removing it from the sets
+// of its previous tags. Set and Del leave the key in its tag sets, which are cleaned up as the keys expire:
+// invalidating them deletes the value set since as well.
+func (r *RedisSimpleCache) SetWithTags(ctx context.Context, key any, value any, ttl time.Duration, tags ...string) (err error) {
+	defer wrapCacheError(&err, backendRedis, "set with tags", key)
+	k, err := keyToString(key)
+	if err != nil {
+		return err
+	}
+	data, err := r.codec.Encode(value)
+	if err != nil {
+		return &codecError{sentinel: ErrEncode, err: err}
+	}
+	r.tagged.Store(true)
+	ttl = r.opts.jitter.apply(ttl)
+	return r.opts.do(ctx, opWrite, func(ctx context.Context) error {
+		return writeScript.Run(ctx, r.client, r.writeKeys(k, tags), r.writeArgs(data, ttl, time.Now())...).Err()
+	})
+}
+
+// InvalidateTags deletes the keys of every tag and the tag sets, atomically.
+func (r *RedisSimpleCache) InvalidateTags(ctx context.Context, tags ...string) (err error) {
+	defer wrapCacheError(&err, backendRedis, "invalidate tags", nil)
+	if len(tags) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		keys = append(keys, r.opts.internalKey(redisTagPrefix, tag))
+	}
+	return r.opts.do(ctx, opBatch, func(ctx context.Context) error {
+		return invalidateTagsScript.Run(ctx, r.client, keys, r.opts.internalKey(redisKeyTagsPrefix, ""), r.slidingPrefix()).Err()
+	})
+}
+
+// SetWithTags sets the key value and indexes the key by tags.
+// The index follows the entries evicted or expired, so it only holds the keys present in the cache.
+func (l *TypedLibCache[K, T]) SetWithTags(_ context.Context, key any, value any, ttl time.Duration, tags ...string) (err error) {
+	defer wrapCacheError(&err, backendLibcache, "set with tags", key)
+	if _, ok := key.(K); !ok {
+		return ErrInvalidKey
+	}
+	if _, ok := value.(T); !ok {
+		return ErrInvalidValue
+	}
+	l.lock()
+	defer l.unlock()
+
+	if l.keyTags == nil {
+		l.tags = make(map[string]map[any]struct{})
+		l.keyTags = make(map[any][]string)
+		if l.events == nil {
+			l.notify()
+			l.reserve()
+		}
+	}
+	if err = l.set(key, value, ttl); err != nil {
+		return err
+	}
+	l.tag(key, tags)
+	return nil
+}
+
+func (l *TypedLibCache[K, T]) InvalidateTags(_ context.Context, tags ...string) (err error) {
+	defer wrapCacheError(&err, backendLibcache, "invalidate tags", nil)
+	l.lock()
+	defer l.unlock()
+	for _, tag := range tags {
+		for key := range l.tags[tag] {
+			l.cache.Delete(key)
+			l.untag(key)
+		}
+	}
+	return nil
+}
+
+// tag indexes key by tags, it must be called with the lock held.
+func (l *TypedLibCache[K, T]) tag(key any, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+	unique := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		keys, found := l.tags[tag]
+		if !found {
+			keys = make(map[any]struct{})
+			l.tags[tag] = keys
+		}
+		if _, found = keys[key]; !found {
+			keys[key] = struct{}{}
+			unique = append(unique, tag)
+		}
+	}
+	l.keyTags[key] = unique
+}
+
+// untag removes key from the index, it must be called with the lock held.
+func (l *TypedLibCache[K, T]) untag(key any) {
+	if l.keyTags == nil {
+		return
+	}
+	for _, tag := range l.keyTags[key] {
+		delete(l.tags[tag], key)
+		if len(l.tags[tag]) == 0 {
+			delete(l.tags, tag)
+		}
+	}
+	delete(l.keyTags, key)
+}
@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shaj13/libcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLibCacheTags(t *testing.T) {
+	ctx := context.Background()
+	cache := NewTypedLibCache[string, string](libcache.LRU.New(3), time.Minute)
+
+	require.NoError(t, cache.SetWithTags(ctx, "key1", "value1", 0, "market:1", "subaccount:1"))
+	require.NoError(t, cache.SetWithTags(ctx, "key2", "value2", 0, "market:1"))
+	require.NoError(t, cache.SetWithTags(ctx, "key3", "value3", 0, "market:2", "market:2"))
+	require.ErrorIs(t, cache.SetWithTags(ctx, 1, "value", 0, "market:1"), ErrInvalidKey)
+	require.ErrorIs(t, cache.SetWithTags(ctx, "key", 1, 0, "market:1"), ErrInvalidValue)
+
+	t.Run("InvalidateTags", func(t *testing.T) {
+		require.NoError(t, cache.InvalidateTags(ctx, "subaccount:1", "missing"))
+		assert.ErrorIs(t, cache.Get(ctx, "key1", new(string)), ErrCacheMiss)
+		assert.NoError(t, cache.Get(ctx, "key2", new(string)))
+		assert.NotContains(t, cache.tags["market:1"], "key1")
+	})
+
+	t.Run("set again without tags", func(t *testing.T) {
+		require.NoError(t, cache.Set(ctx, "key2", "value2"))
+		require.NoError(t, cache.InvalidateTags(ctx, "market:1"))
+		assert.NoError(t, cache.Get(ctx, "key2", new(string)))
+	})
+
+	t.Run("evicted keys leave the index", func(t *testing.T) {
+		require.NoError(t, cache.SetWithTags(ctx, "key4", "value4", 0, "market:1"))
+		require.NoError(t, cache.SetWithTags(ctx, "key5", "value5", 0, "market:1"))
+		// key3 is the least recently used
+		assert.NotContains(t, cache.keyTags, "key3")
+		assert.NotContains(t, cache.tags, "market:2")
+	})
+
+	t.Run("expired keys leave the index", func(t *testing.T) {
+		require.NoError(t, cache.SetWithTags(ctx, "key6", "value6", time.Millisecond, "market:3"))
+		time.Sleep(2 * time.Millisecond)
+		assert.ErrorIs(t, cache.Get(ctx, "key6", new(string)), ErrCacheMiss)
+		assert.NotContains(t, cache.tags, "market:3")
+	})
+
+	t.Run("Clear", func(t *testing.T) {
+		require.NoError(t, cache.Clear(ctx))
+		assert.Empty(t, cache.tags)
+		assert.Empty(t, cache.keyTags)
+	})
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Timeouts bounds how long the operations of a cache can take, 0 means no bound.
+type Timeouts struct {
+	// Read bounds the single key reads
+	Read time.Duration
+	// Write bounds the single key writes and deletions
+	Write time.Duration
+	// Batch bounds the operations on several keys
+	Batch time.Duration
+}
+
+// opKind is the kind of an operation, to pick its timeout.
+type opKind int
+
+const (
+	opRead opKind = iota
+	opWrite
+	opBatch
+)
+
+func (t Timeouts) of(kind opKind) time.Duration {
+	switch kind {
+	case opRead:
+		return t.Read
+	case opWrite:
+		return t.Write
+	default:
+		return t.Batch
+	}
+}
+
+// WithTimeouts bounds every operation by the timeout of its kind, unless ctx has an earlier deadline.
+// An operation exceeding its timeout fails with ErrTimeout, the retries of WithRetryPolicy included.
+// It applies to the redis caches.
+func WithTimeouts(timeouts Timeouts) Option {
+	return func(o *options) {
+		o.timeouts = timeouts
+	}
+}
+
+// do runs fn with ctx bounded by the timeout of kind, retrying it according to the retry policy.
+func (o *options) do(ctx context.Context, kind opKind, fn func(ctx context.Context) error) error {
+	timeout := o.timeouts.of(kind)
+	if timeout <= 0 {
+		return o.retry.do(ctx, func() error {
+			return fn(ctx)
+		})
+	}
+
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		// the caller deadline comes first
+		return o.retry.do(ctx, func() error {
+			return fn(ctx)
+		})
+	}
+
+	bounded, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	err := o.retry.do(bounded, func() error {
+		return fn(bounded)
+	})
+	// the connection deadline set from ctx can expire right before ctx itself
+	if err != nil && ctx.Err() == nil && !time.Now().Before(deadline) {
+		return &timeoutError{timeout: timeout, err: err}
+	}
+	return err
+}
+
+// timeoutError is an operation exceeding its timeout, it matches ErrTimeout and unwraps to the error of the operation.
+type timeoutError struct {
+	timeout time.Duration
+	err     error
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("%v after %s: %v", ErrTimeout, e.timeout, e.err)
+}
+
+func (e *timeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+func (e *timeoutError) Unwrap() error {
+	return e.err
+}
+
+// detachedContext carries the values of its parent but not its deadline nor its cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key any) any {
+	return c.parent.Value(key)
+}
+
+// detach returns a context bounded by timeout only, for the work which must complete even once ctx is canceled.
+func detach(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(detachedContext{parent: ctx}, timeout)
+}
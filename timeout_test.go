@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	rediscache "github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stuckRedis accepts connections and never replies, like a redis stuck on a slow command.
+func stuckRedis(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+	t.Cleanup(func() {
+		_ = listener.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	})
+	return listener.Addr().String()
+}
+
+func TestTimeouts(t *testing.T) {
+	ctx := context.Background()
+
+	client := rediscache.NewClient(&rediscache.Options{Addr: stuckRedis(t), MaxRetries: -1})
+	defer client.Close()
+
+	timeouts := WithTimeouts(Timeouts{Read: 50 * time.Millisecond, Write: 60 * time.Millisecond, Batch: 70 * time.Millisecond})
+	byteCache := NewRedisCacheWithClient(ctx, client, time.Minute, timeouts)
+	simpleCache := NewRedisSimpleCache(client, nil, time.Minute, timeouts)
+
+	operations := map[string]struct {
+		timeout   time.Duration
+		operation func(ctx context.Context) error
+	}{
+		"Get": {50 * time.Millisecond, func(ctx context.Context) error {
+			_, err := byteCache.Get(ctx, "key")
+			return err
+		}},
+		"Set": {60 * time.Millisecond, func(ctx context.Context) error {
+			return byteCache.Set(ctx, "key", []byte("value"))
+		}},
+		"BatchGet": {70 * time.Millisecond, func(ctx context.Context) error {
+			_, err := byteCache.BatchGet(ctx, "key1", "key2")
+			return err
+		}},
+		"SimpleGet": {50 * time.Millisecond, func(ctx context.Context) error {
+			return simpleCache.Get(ctx, "key", new(int))
+		}},
+		"SimpleDel": {60 * time.Millisecond, func(ctx context.Context) error {
+			return simpleCache.Del(ctx, "key")
+		}},
+	}
+	for name, tt := range operations {
+		t.Run(name, func(t *testing.T) {
+			start := time.Now()
+			err := tt.operation(ctx)
+			assert.ErrorIs(t, err, ErrTimeout)
+			assert.GreaterOrEqual(t, time.Since(start), tt.timeout)
+			assert.Less(t, time.Since(start), tt.timeout+time.Second)
+		})
+	}
+
+	t.Run("earlier ctx deadline", func(t *testing.T) {
+		deadlineCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, err := byteCache.Get(deadlineCtx, "key")
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, ErrTimeout, "the caller deadline expired")
+		assert.Less(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("budget includes the retries", func(t *testing.T) {
+		c := NewRedisCacheWithClient(ctx, client, time.Minute,
+			WithTimeouts(Timeouts{Read: 50 * time.Millisecond}),
+			WithRetryPolicy(RetryPolicy{MaxAttempts: 10, MinBackoff: time.Millisecond}))
+
+		start := time.Now()
+		_, err := c.Get(ctx, "key")
+		assert.ErrorIs(t, err, ErrTimeout)
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+	})
+
+	t.Run("cause", func(t *testing.T) {
+		opts := newOptions([]Option{WithTimeouts(Timeouts{Write: 10 * time.Millisecond})})
+		err := opts.do(ctx, opWrite, func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		assert.ErrorIs(t, err, ErrTimeout)
+		assert.ErrorIs(t, err, context.DeadlineExceeded, "the error of the operation is kept")
+		assert.EqualError(t, err, "cache operation timed out after 10ms: context deadline exceeded")
+	})
+}
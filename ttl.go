@@ -0,0 +1,286 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	rediscache "github.com/go-redis/redis/v8"
+)
+
+var (
+	_ ExpiringCache = (*redisCache)(nil)
+	_ ExpiringCache = (*memLibCache)(nil)
+
+	_ ttlReader = (*TypedLibCache[string, any])(nil)
+	_ ttlReader = (*ShardedCache[string, any])(nil)
+	_ ttlReader = (*RedisSimpleCache)(nil)
+)
+
+// NoTTL is the TTL of a key without expiration.
+const NoTTL time.Duration = -1
+
+// ExpiringCache is a Cache controlling the expiration of every key instead of using the cache default ttl.
+// A ttl of 0 or NoTTL means no expiration, another negative ttl fails with ErrInvalidValue.
+type ExpiringCache interface {
+	Cache
+
+	SetWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// TTL returns the remaining time to live of key, NoTTL if it doesn't expire, ErrCacheMiss if it doesn't exist.
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	// Touch sets the ttl of an existing key, 0 removes its expiration. It returns ErrCacheMiss if the key doesn't exist.
+	Touch(ctx context.Context, key string, ttl time.Duration) error
+	// BatchSetWithTTL sets every item with its own ttl.
+	BatchSetWithTTL(ctx context.Context, items ...BatchItem) error
+}
+
+// ttlReader is a TTLCache reporting the remaining time to live of its keys, like ExpiringCache.TTL.
+type ttlReader interface {
+	TTL(ctx context.Context, key any) (time.Duration, error)
+}
+
+// BatchItem is an entry of BatchSetWithTTL.
+type BatchItem struct {
+	Key   string
+	Value []byte
+	// TTL is the time to live of the entry, 0 means no expiration
+	TTL time.Duration
+}
+
+func (r *redisCache) SetWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) (err error) {
+	defer wrapCacheError(&err, backendRedis, "set", key)
+	if ttl, err = checkTTL(ttl); err != nil {
+		return err
+	}
+	return r.opts.do(ctx, opWrite, func(ctx context.Context) error {
+		return r.client.Set(ctx, key, value, r.opts.jitter.apply(ttl)).Err()
+	})
+}
+
+func (r *redisCache) TTL(ctx context.Context, key string) (_ time.Duration, err error) {
+	defer wrapCacheError(&err, backendRedis, "ttl", key)
+	var ttl time.Duration
+	err = r.opts.do(ctx, opRead, func(ctx context.Context) (err error) {
+		ttl, err = r.client.PTTL(ctx, key).Result()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return redisTTL(ttl)
+}
+
+// TTL returns the remaining time to live of key, NoTTL if it doesn't expire, ErrCacheMiss if it doesn't exist.
+func (r *RedisSimpleCache) TTL(ctx context.Context, key any) (_ time.Duration, err error) {
+	defer wrapCacheError(&err, backendRedis, "ttl", key)
+	k, err := keyToString(key)
+	if err != nil {
+		return 0, err
+	}
+	var ttl time.Duration
+	err = r.opts.do(ctx, opRead, func(ctx context.Context) (err error) {
+		ttl, err = r.client.PTTL(ctx, k).Result()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return redisTTL(ttl)
+}
+
+// checkTTL validates the ttl of an ExpiringCache operation and returns it with NoTTL converted to 0,
+// which redis would take for KEEPTTL.
+func checkTTL(ttl time.Duration) (time.Duration, error) {
+	switch {
+	case ttl == NoTTL:
+		return 0, nil
+	case ttl < 0:
+		return 0, fmt.Errorf("%w: negative ttl %s", ErrInvalidValue, ttl)
+	default:
+		return ttl, nil
+	}
+}
+
+// redisTTL converts the reply of PTTL, -2 for a missing key and -1 for a key without expiration.
+func redisTTL(ttl time.Duration) (time.Duration, error) {
+	switch ttl {
+	case -2:
+		return 0, ErrCacheMiss
+	case -1:
+		return NoTTL, nil
+	default:
+		return ttl, nil
+	}
+}
+
+func (r *redisCache) Touch(ctx context.Context, key string, ttl time.Duration) (err error) {
+	defer wrapCacheError(&err, backendRedis, "touch", key)
+	if ttl, err = checkTTL(ttl); err != nil {
+		return err
+	}
+	if ttl > 0 {
+		var ok bool
+		err = r.opts.do(ctx, opWrite, func(ctx context.Context) (err error) {
+			ok, err = r.client.PExpire(ctx, key, r.opts.jitter.apply(ttl)).Result()
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrCacheMiss
+		}
+		return nil
+	}
+
+	// PERSIST replies 0 for a missing key and for a key without expiration
+	var exists *rediscache.IntCmd
+	err = r.opts.do(ctx, opWrite, func(ctx context.Context) error {
+		pipeline := r.client.TxPipeline()
+		exists = pipeline.Exists(ctx, key)
+		pipeline.Persist(ctx, key)
+		_, err := pipeline.Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if exists.Val() == 0 {
+		return ErrCacheMiss
+	}
+	return nil
+}
+
+func (r *redisCache) BatchSetWithTTL(ctx context.Context, items ...BatchItem) (err error) {
+	defer wrapCacheError(&err, backendRedis, "batch set", nil)
+	ttls := make([]time.Duration, len(items))
+	for i, item := range items {
+		if ttls[i], err = checkTTL(item.TTL); err != nil {
+			return fmt.Errorf("%w at index %d", err, i)
+		}
+	}
+	return r.opts.do(ctx, opBatch, func(ctx context.Context) error {
+		// same as BatchSet, in a single transaction
+		pipeline := r.client.TxPipeline()
+		for i, item := range items {
+			pipeline.Set(ctx, item.Key, item.Value, r.opts.jitter.apply(ttls[i]))
+		}
+
+		statuses, err := pipeline.Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range statuses {
+			if err = s.Err(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// TTL returns the remaining time to live of key, NoTTL if it doesn't expire, ErrCacheMiss if it doesn't exist.
+func (l *TypedLibCache[K, T]) TTL(_ context.Context, key any) (_ time.Duration, err error) {
+	defer wrapCacheError(&err, backendLibcache, "ttl", key)
+	if _, ok := key.(K); !ok {
+		return 0, ErrInvalidKey
+	}
+	l.lock()
+	defer l.unlock()
+	expiry, found := l.cache.Expiry(key)
+	if !found {
+		return 0, ErrCacheMiss
+	}
+	if expiry.IsZero() {
+		return NoTTL, nil
+	}
+	ttl := time.Until(expiry)
+	if ttl <= 0 {
+		// expired but not collected yet
+		return 0, ErrCacheMiss
+	}
+	return ttl, nil
+}
+
+// TTL returns the remaining time to live of key, NoTTL if it doesn't expire, ErrCacheMiss if it doesn't exist.
+func (c *ShardedCache[K, V]) TTL(_ context.Context, key any) (_ time.Duration, err error) {
+	defer wrapCacheError(&err, backendSharded, "ttl", key)
+	k, ok := key.(K)
+	if !ok {
+		return 0, ErrInvalidKey
+	}
+	s := c.shard(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, found := s.entries[k]
+	if !found {
+		return 0, ErrCacheMiss
+	}
+	if e.expiresAt == 0 {
+		return NoTTL, nil
+	}
+	ttl := time.Until(time.Unix(0, e.expiresAt))
+	if ttl <= 0 {
+		// expired but not collected yet
+		return 0, ErrCacheMiss
+	}
+	return ttl, nil
+}
+
+// Touch sets the ttl of an existing key, 0 or NoTTL removes its expiration and another negative ttl fails with
+// ErrInvalidValue. It returns ErrCacheMiss if the key doesn't exist. Like a read, it makes the key the most recently used.
+func (l *TypedLibCache[K, T]) Touch(_ context.Context, key any, ttl time.Duration) (err error) {
+	defer wrapCacheError(&err, backendLibcache, "touch", key)
+	if _, ok := key.(K); !ok {
+		return ErrInvalidKey
+	}
+	if ttl, err = checkTTL(ttl); err != nil {
+		return err
+	}
+	l.lock()
+	defer l.unlock()
+	value, found := l.cache.Peek(key)
+	if !found {
+		return ErrCacheMiss
+	}
+	ttl = l.opts.jitter.apply(ttl)
+	if lt, found := l.lifetimes[key]; found {
+		// the next reads extend the entry by its new ttl
+		lt.ttl = ttl
+		l.lifetimes[key] = lt
+	}
+	// storing the entry again resets its ttl, its tags have to be restored
+	tags := l.keyTags[key]
+	if err := l.store(key, value, ttl); err != nil {
+		return err
+	}
+	l.tag(key, tags)
+	return nil
+}
+
+func (l *memLibCache) SetWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) (err error) {
+	defer wrapCacheError(&err, backendLibcache, "set", key)
+	if ttl, err = checkTTL(ttl); err != nil {
+		return err
+	}
+	return l.cache.SetWithTTL(ctx, key, value, ttl)
+}
+
+func (l *memLibCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return l.cache.TTL(ctx, key)
+}
+
+func (l *memLibCache) Touch(ctx context.Context, key string, ttl time.Duration) error {
+	return l.cache.Touch(ctx, key, ttl)
+}
+
+func (l *memLibCache) BatchSetWithTTL(ctx context.Context, items ...BatchItem) (err error) {
+	defer wrapCacheError(&err, backendLibcache, "batch set", nil)
+	for _, item := range items {
+		if err = l.SetWithTTL(ctx, item.Key, item.Value, item.TTL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
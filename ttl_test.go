@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shaj13/libcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLibcacheTTL(t *testing.T) {
+	ctx := context.Background()
+	cache, err := NewLibcache(0, time.Minute)
+	require.NoError(t, err)
+
+	require.NoError(t, cache.Set(ctx, "key1", []byte("value1")))
+	require.NoError(t, cache.SetWithTTL(ctx, "key2", []byte("value2"), time.Hour))
+	require.NoError(t, cache.SetWithTTL(ctx, "key3", []byte("value3"), 0))
+
+	ttl, err := cache.TTL(ctx, "key1")
+	require.NoError(t, err)
+	assert.InDelta(t, time.Minute, ttl, float64(time.Second))
+	ttl, err = cache.TTL(ctx, "key2")
+	require.NoError(t, err)
+	assert.InDelta(t, time.Hour, ttl, float64(time.Second))
+	ttl, err = cache.TTL(ctx, "key3")
+	require.NoError(t, err)
+	assert.Equal(t, NoTTL, ttl)
+	_, err = cache.TTL(ctx, "missing")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+
+	t.Run("Touch", func(t *testing.T) {
+		require.NoError(t, cache.Touch(ctx, "key3", time.Millisecond))
+		time.Sleep(2 * time.Millisecond)
+		_, err = cache.Get(ctx, "key3")
+		assert.ErrorIs(t, err, ErrCacheMiss)
+
+		require.NoError(t, cache.Touch(ctx, "key1", 0))
+		ttl, err = cache.TTL(ctx, "key1")
+		require.NoError(t, err)
+		assert.Equal(t, NoTTL, ttl)
+
+		assert.ErrorIs(t, cache.Touch(ctx, "missing", time.Minute), ErrCacheMiss)
+	})
+
+	t.Run("negative ttl", func(t *testing.T) {
+		require.NoError(t, cache.Touch(ctx, "key2", NoTTL))
+		ttl, err = cache.TTL(ctx, "key2")
+		require.NoError(t, err)
+		assert.Equal(t, NoTTL, ttl)
+
+		assert.ErrorIs(t, cache.Touch(ctx, "key2", -time.Second), ErrInvalidValue)
+		assert.ErrorIs(t, cache.SetWithTTL(ctx, "key2", []byte("value2"), -time.Second), ErrInvalidValue)
+		assert.ErrorIs(t, cache.BatchSetWithTTL(ctx, BatchItem{Key: "key2", TTL: -time.Second}), ErrInvalidValue)
+		ttl, err = cache.TTL(ctx, "key2")
+		require.NoError(t, err)
+		assert.Equal(t, NoTTL, ttl)
+	})
+
+	t.Run("BatchSetWithTTL", func(t *testing.T) {
+		require.NoError(t, cache.BatchSetWithTTL(ctx,
+			BatchItem{Key: "key4", Value: []byte("value4"), TTL: time.Millisecond},
+			BatchItem{Key: "key5", Value: []byte("value5"), TTL: time.Hour},
+		))
+		time.Sleep(2 * time.Millisecond)
+
+		values, err := cache.BatchGet(ctx, "key4", "key5")
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{nil, []byte("value5")}, values)
+	})
+}
+
+func TestLibCacheTouchKeepsTags(t *testing.T) {
+	ctx := context.Background()
+	cache := NewTypedLibCache[string, string](libcache.LRU.New(0), time.Minute)
+
+	require.NoError(t, cache.SetWithTags(ctx, "key1", "value1", time.Minute, "tag"))
+	require.NoError(t, cache.Touch(ctx, "key1", time.Hour))
+	require.NoError(t, cache.InvalidateTags(ctx, "tag"))
+	assert.ErrorIs(t, cache.Get(ctx, "key1", new(string)), ErrCacheMiss)
+}
+
+func TestShardedCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	cache, err := NewShardedCache[string, int](1, 0, time.Minute)
+	require.NoError(t, err)
+	defer cache.Close()
+
+	require.NoError(t, cache.Set(ctx, "key1", 1))
+	require.NoError(t, cache.SetWithTTL(ctx, "key2", 2, 0))
+	require.NoError(t, cache.SetWithTTL(ctx, "key3", 3, time.Millisecond))
+	time.Sleep(2 * time.Millisecond)
+
+	ttl, err := cache.TTL(ctx, "key1")
+	require.NoError(t, err)
+	assert.InDelta(t, time.Minute, ttl, float64(time.Second))
+	ttl, err = cache.TTL(ctx, "key2")
+	require.NoError(t, err)
+	assert.Equal(t, NoTTL, ttl)
+	_, err = cache.TTL(ctx, "key3")
+	assert.ErrorIs(t, err, ErrCacheMiss, "expired")
+	_, err = cache.TTL(ctx, "missing")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+	_, err = cache.TTL(ctx, 1)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
@@ -0,0 +1,534 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWriteBehindQueueSize     = 1024
+	defaultWriteBehindBatchSize     = 128
+	defaultWriteBehindFlushInterval = 100 * time.Millisecond
+)
+
+// WriteBehindOptions configures a write-behind wrapper, zero values fall back to the defaults.
+type WriteBehindOptions struct {
+	// QueueSize is the maximum number of distinct keys waiting to be flushed,
+	// writers block once it is reached until the next flush makes room.
+	QueueSize int
+	// BatchSize is the maximum number of operations applied in a single flush.
+	BatchSize int
+	// FlushInterval is how often pending operations are flushed when the batch is not full yet.
+	FlushInterval time.Duration
+}
+
+func (o WriteBehindOptions) withDefaults() WriteBehindOptions {
+	if o.QueueSize <= 0 {
+		o.QueueSize = defaultWriteBehindQueueSize
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = defaultWriteBehindBatchSize
+	}
+	if o.BatchSize > o.QueueSize {
+		o.BatchSize = o.QueueSize
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = defaultWriteBehindFlushInterval
+	}
+	return o
+}
+
+// writeOp is a pending write, only the latest operation per key is kept.
+type writeOp struct {
+	key   any
+	value any
+	ttl   time.Duration
+	// expiresAt is when a write queued with a ttl expires, zero for the other operations
+	expiresAt time.Time
+	// defaultTTL is set when the operation should use the backend default ttl
+	defaultTTL bool
+	del        bool
+}
+
+// writeBehindQueue holds the pending operations and runs the flush loop,
+// the backend specific part is done by apply.
+type writeBehindQueue struct {
+	opts  WriteBehindOptions
+	apply func(ctx context.Context, ops []*writeOp)
+
+	mu       sync.Mutex
+	pending  map[any]*writeOp
+	order    []any
+	flushing map[any]*writeOp
+	closed   bool
+
+	// slots limits the number of distinct pending keys
+	slots   chan struct{}
+	kick    chan struct{}
+	stop    chan struct{}
+	stopped chan struct{}
+	flushMX sync.Mutex
+}
+
+func newWriteBehindQueue(opts WriteBehindOptions, apply func(ctx context.Context, ops []*writeOp)) *writeBehindQueue {
+	opts = opts.withDefaults()
+	q := &writeBehindQueue{
+		opts:     opts,
+		apply:    apply,
+		pending:  make(map[any]*writeOp),
+		flushing: make(map[any]*writeOp),
+		slots:    make(chan struct{}, opts.QueueSize),
+		kick:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// enqueue adds op to the queue, replacing any pending operation for the same key.
+// It blocks while the queue is full.
+func (q *writeBehindQueue) enqueue(ctx context.Context, op *writeOp) error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return ErrClosed
+	}
+	if _, found := q.pending[op.key]; found {
+		q.pending[op.key] = op
+		q.mu.Unlock()
+		return nil
+	}
+	q.mu.Unlock()
+
+	select {
+	case q.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-q.stop:
+		return ErrClosed
+	}
+
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		<-q.slots
+		return ErrClosed
+	}
+	if _, found := q.pending[op.key]; found {
+		// another writer queued the key while we were waiting for a slot
+		q.pending[op.key] = op
+		q.mu.Unlock()
+		<-q.slots
+		return nil
+	}
+	q.pending[op.key] = op
+	q.order = append(q.order, op.key)
+	full := len(q.order) >= q.opts.BatchSize
+	q.mu.Unlock()
+
+	if full {
+		select {
+		case q.kick <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// lookup returns the not yet applied operation for key, if any.
+func (q *writeBehindQueue) lookup(key any) (*writeOp, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if op, found := q.pending[key]; found {
+		return op, true
+	}
+	op, found := q.flushing[key]
+	return op, found
+}
+
+// drop discards all pending operations.
+func (q *writeBehindQueue) drop() {
+	q.mu.Lock()
+	n := len(q.order)
+	q.pending = make(map[any]*writeOp)
+	q.order = nil
+	q.mu.Unlock()
+	for i := 0; i < n; i++ {
+		<-q.slots
+	}
+}
+
+// flushBatch applies up to BatchSize pending operations and reports whether there are more left.
+func (q *writeBehindQueue) flushBatch(ctx context.Context) bool {
+	q.mu.Lock()
+	n := len(q.order)
+	if n > q.opts.BatchSize {
+		n = q.opts.BatchSize
+	}
+	ops := make([]*writeOp, 0, n)
+	for _, key := range q.order[:n] {
+		op := q.pending[key]
+		delete(q.pending, key)
+		q.flushing[key] = op
+		ops = append(ops, op)
+	}
+	q.order = q.order[n:]
+	q.mu.Unlock()
+
+	if len(ops) > 0 {
+		q.apply(ctx, ops)
+	}
+
+	q.mu.Lock()
+	for _, op := range ops {
+		delete(q.flushing, op.key)
+	}
+	more := len(q.order) > 0
+	q.mu.Unlock()
+
+	for range ops {
+		<-q.slots
+	}
+	return more
+}
+
+// flush applies every pending operation.
+func (q *writeBehindQueue) flush(ctx context.Context) error {
+	q.flushMX.Lock()
+	defer q.flushMX.Unlock()
+	for q.flushBatch(ctx) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *writeBehindQueue) run() {
+	defer close(q.stopped)
+
+	ticker := time.NewTicker(q.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-q.kick:
+		case <-q.stop:
+			_ = q.flush(context.Background())
+			return
+		}
+		_ = q.flush(context.Background())
+	}
+}
+
+// close stops accepting writes and waits until the queue is drained.
+func (q *writeBehindQueue) close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		<-q.stopped
+		return
+	}
+	q.closed = true
+	q.mu.Unlock()
+
+	close(q.stop)
+	<-q.stopped
+}
+
+var _ TTLCache = (*WriteBehind)(nil)
+
+// WriteBehind is a TTLCache that acknowledges writes immediately and applies them asynchronously
+// to the wrapped cache. Repeated writes to the same key are coalesced and only the latest one is applied.
+// Reads see the pending writes.
+type WriteBehind struct {
+	// OnErr is called for every operation that could not be applied to the wrapped cache
+	OnErr func(error)
+	cache TTLCache
+	queue *writeBehindQueue
+}
+
+// NewWriteBehind creates a new WriteBehind wrapping cache, Close must be called to flush the pending writes.
+func NewWriteBehind(cache TTLCache, opts WriteBehindOptions) *WriteBehind {
+	wb := &WriteBehind{
+		cache: cache,
+	}
+	wb.queue = newWriteBehindQueue(opts, wb.apply)
+	return wb
+}
+
+// Set queues the write, the key is validated by the wrapped cache when it's flushed
+// unless it can't be queued at all.
+func (w *WriteBehind) Set(ctx context.Context, key any, value any) (err error) {
+	if err = comparableKey(key); err != nil {
+		return err
+	}
+	return w.queue.enqueue(ctx, &writeOp{key: key, value: value, defaultTTL: true})
+}
+
+func (w *WriteBehind) SetWithTTL(ctx context.Context, key any, value any, ttl time.Duration) (err error) {
+	if err = comparableKey(key); err != nil {
+		return err
+	}
+	op := &writeOp{key: key, value: value, ttl: ttl}
+	if ttl > 0 {
+		op.expiresAt = time.Now().Add(ttl)
+	}
+	return w.queue.enqueue(ctx, op)
+}
+
+func (w *WriteBehind) Get(ctx context.Context, key any, value any) (err error) {
+	if err = comparableKey(key); err != nil {
+		return err
+	}
+	op, found := w.queue.lookup(key)
+	if !found {
+		return w.cache.Get(ctx, key, value)
+	}
+	if op.del || (!op.expiresAt.IsZero() && !time.Now().Before(op.expiresAt)) {
+		return ErrCacheMiss
+	}
+	return assign(value, op.value)
+}
+
+func (w *WriteBehind) Del(ctx context.Context, keys ...any) (err error) {
+	for _, key := range keys {
+		if err = comparableKey(key); err != nil {
+			return err
+		}
+	}
+	for _, key := range keys {
+		if err = w.queue.enqueue(ctx, &writeOp{key: key, del: true}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Clear discards the pending writes and clears the wrapped cache.
+func (w *WriteBehind) Clear(ctx context.Context) (err error) {
+	w.queue.flushMX.Lock()
+	defer w.queue.flushMX.Unlock()
+	w.queue.drop()
+	return w.cache.Clear(ctx)
+}
+
+// Flush applies all the pending writes before returning.
+func (w *WriteBehind) Flush(ctx context.Context) error {
+	return w.queue.flush(ctx)
+}
+
+// Close stops accepting writes and flushes the pending ones.
+func (w *WriteBehind) Close() error {
+	w.queue.close()
+	return nil
+}
+
+var (
+	_ batchSetter = (*RedisSimpleCache)(nil)
+	_ batchSetter = (*TypedLibCache[string, string])(nil)
+)
+
+// batchSetter is implemented by caches able to store several keys at once with their default ttl,
+// the writes queued with Set are flushed through BatchSet when the wrapped cache has it.
+type batchSetter interface {
+	BatchSet(ctx context.Context, keyvalues ...any) error
+}
+
+func (w *WriteBehind) apply(ctx context.Context, ops []*writeOp) {
+	var dels []any
+	var batch []any
+	batchSet, canBatch := w.cache.(batchSetter)
+	for _, op := range ops {
+		switch {
+		case op.del:
+			dels = append(dels, op.key)
+		case op.defaultTTL && canBatch:
+			batch = append(batch, op.key, op.value)
+		case op.defaultTTL:
+			w.report(op.key, w.cache.Set(ctx, op.key, op.value))
+		case op.expiresAt.IsZero():
+			w.report(op.key, w.cache.SetWithTTL(ctx, op.key, op.value, op.ttl))
+		default:
+			// the ttl runs from the write, an expired write must not leave an older value either
+			ttl := time.Until(op.expiresAt)
+			if ttl <= 0 {
+				dels = append(dels, op.key)
+				continue
+			}
+			w.report(op.key, w.cache.SetWithTTL(ctx, op.key, op.value, ttl))
+		}
+	}
+	if len(batch) > 0 {
+		if err := batchSet.BatchSet(ctx, batch...); err != nil && w.OnErr != nil {
+			w.OnErr(fmt.Errorf("flushing %d keys: %w", len(batch)/2, err))
+		}
+	}
+	if len(dels) > 0 {
+		if err := w.cache.Del(ctx, dels...); err != nil && w.OnErr != nil {
+			w.OnErr(fmt.Errorf("flushing %d deletions: %w", len(dels), err))
+		}
+	}
+}
+
+func (w *WriteBehind) report(key any, err error) {
+	if err != nil && w.OnErr != nil {
+		w.OnErr(fmt.Errorf("flushing key %v: %w", key, err))
+	}
+}
+
+var _ Cache = (*WriteBehindByteCache)(nil)
+
+// WriteBehindByteCache is the Cache counterpart of WriteBehind: Set, Del and BatchSet
+// are queued and flushed in batches through BatchSet.
+type WriteBehindByteCache struct {
+	// OnErr is called for every operation that could not be applied to the wrapped cache
+	OnErr func(error)
+	cache Cache
+	queue *writeBehindQueue
+}
+
+// NewWriteBehindByteCache creates a new WriteBehindByteCache wrapping cache,
+// Close flushes the pending writes and closes the wrapped cache.
+func NewWriteBehindByteCache(cache Cache, opts WriteBehindOptions) *WriteBehindByteCache {
+	wb := &WriteBehindByteCache{
+		cache: cache,
+	}
+	wb.queue = newWriteBehindQueue(opts, wb.apply)
+	return wb
+}
+
+func (w *WriteBehindByteCache) Set(ctx context.Context, key string, value []byte) error {
+	return w.queue.enqueue(ctx, &writeOp{key: key, value: value, defaultTTL: true})
+}
+
+func (w *WriteBehindByteCache) Get(ctx context.Context, key string) ([]byte, error) {
+	op, found := w.queue.lookup(key)
+	if !found {
+		return w.cache.Get(ctx, key)
+	}
+	if op.del {
+		return nil, ErrCacheMiss
+	}
+	return op.value.([]byte), nil
+}
+
+func (w *WriteBehindByteCache) Del(ctx context.Context, key string) error {
+	return w.queue.enqueue(ctx, &writeOp{key: key, del: true})
+}
+
+func (w *WriteBehindByteCache) BatchGet(ctx context.Context, keys ...string) ([][]byte, error) {
+	result, err := w.cache.BatchGet(ctx, keys...)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		op, found := w.queue.lookup(key)
+		if !found {
+			continue
+		}
+		if op.del {
+			result[i] = nil
+			continue
+		}
+		result[i] = op.value.([]byte)
+	}
+	return result, nil
+}
+
+func (w *WriteBehindByteCache) BatchSet(ctx context.Context, keyvalues ...interface{}) error {
+	if len(keyvalues)%2 != 0 {
+		return oddKeyValues(len(keyvalues))
+	}
+
+	ops := make([]*writeOp, 0, len(keyvalues)/2)
+	for i := 0; i < len(keyvalues); i += 2 {
+		key, ok := keyvalues[i].(string)
+		if !ok {
+			return fmt.Errorf("%w at index %d: expected string, got %T", ErrInvalidKey, i, keyvalues[i])
+		}
+
+		value, ok := keyvalues[i+1].([]byte)
+		if !ok {
+			return fmt.Errorf("%w at index %d: expected []byte, got %T", ErrInvalidValue, i+1, keyvalues[i+1])
+		}
+
+		ops = append(ops, &writeOp{key: key, value: value, defaultTTL: true})
+	}
+
+	for _, op := range ops {
+		if err := w.queue.enqueue(ctx, op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush applies all the pending writes before returning.
+func (w *WriteBehindByteCache) Flush(ctx context.Context) error {
+	return w.queue.flush(ctx)
+}
+
+func (w *WriteBehindByteCache) IsRunning(ctx context.Context) bool {
+	return w.cache.IsRunning(ctx)
+}
+
+// Close flushes the pending writes and closes the wrapped cache.
+func (w *WriteBehindByteCache) Close() error {
+	w.queue.close()
+	return w.cache.Close()
+}
+
+func (w *WriteBehindByteCache) apply(ctx context.Context, ops []*writeOp) {
+	var batch []any
+	for _, op := range ops {
+		if op.del {
+			if err := w.cache.Del(ctx, op.key.(string)); err != nil && w.OnErr != nil {
+				w.OnErr(fmt.Errorf("flushing key %s: %w", op.key, err))
+			}
+			continue
+		}
+		batch = append(batch, op.key, op.value)
+	}
+	if len(batch) > 0 {
+		if err := w.cache.BatchSet(ctx, batch...); err != nil && w.OnErr != nil {
+			w.OnErr(fmt.Errorf("flushing %d keys: %w", len(batch)/2, err))
+		}
+	}
+}
+
+// comparableKey rejects the keys which can't be queued, as they can't be compared.
+func comparableKey(key any) error {
+	if key == nil || !reflect.TypeOf(key).Comparable() {
+		return fmt.Errorf("%w: %T", ErrInvalidKey, key)
+	}
+	return nil
+}
+
+// assign stores src into the value pointed by dst, as a cache backend would do when decoding.
+func assign(dst any, src any) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return ErrInvalidValue
+	}
+	target := rv.Elem()
+	sv := reflect.ValueOf(src)
+	if !sv.IsValid() {
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+	if !sv.Type().AssignableTo(target.Type()) {
+		// the value was stored as a pointer and is read as a plain value
+		if sv.Kind() != reflect.Pointer || sv.IsNil() || !sv.Elem().Type().AssignableTo(target.Type()) {
+			return ErrInvalidValue
+		}
+		sv = sv.Elem()
+	}
+	target.Set(sv)
+	return nil
+}
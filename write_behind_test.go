@@ -0,0 +1,218 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/shaj13/libcache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteBehind(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("coalesce writes", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		cache := NewMockTTLCache(ctrl)
+		wb := NewWriteBehind(cache, WriteBehindOptions{FlushInterval: time.Hour})
+
+		cache.EXPECT().Set(gomock.Any(), "key", 5).Return(nil).Times(1)
+		cache.EXPECT().SetWithTTL(gomock.Any(), "other", 1, gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ any, _ any, ttl time.Duration) error {
+				assert.InDelta(t, time.Second, ttl, float64(100*time.Millisecond), "the ttl runs from the write")
+				return nil
+			}).Times(1)
+		cache.EXPECT().Del(gomock.Any(), "deleted").Return(nil).Times(1)
+
+		for i := 1; i <= 5; i++ {
+			require.NoError(t, wb.Set(ctx, "key", i))
+		}
+		require.NoError(t, wb.SetWithTTL(ctx, "other", 1, time.Second))
+		require.NoError(t, wb.Set(ctx, "deleted", 1))
+		require.NoError(t, wb.Del(ctx, "deleted"))
+
+		require.NoError(t, wb.Close())
+	})
+
+	t.Run("pending writes expire", func(t *testing.T) {
+		cache := NewTypedLibCache[string, int](libcache.LRU.New(10), time.Minute)
+		wb := NewWriteBehind(cache, WriteBehindOptions{FlushInterval: time.Hour})
+		defer wb.Close()
+
+		require.NoError(t, cache.Set(ctx, "key", 1))
+		require.NoError(t, wb.SetWithTTL(ctx, "key", 2, time.Millisecond))
+		time.Sleep(2 * time.Millisecond)
+		assert.ErrorIs(t, wb.Get(ctx, "key", new(int)), ErrCacheMiss)
+
+		require.NoError(t, wb.Flush(ctx))
+		assert.ErrorIs(t, cache.Get(ctx, "key", new(int)), ErrCacheMiss, "the older value is deleted")
+	})
+
+	t.Run("read pending writes", func(t *testing.T) {
+		cache := NewTypedLibCache[string, int](libcache.LRU.New(10), time.Minute)
+		wb := NewWriteBehind(cache, WriteBehindOptions{FlushInterval: time.Hour})
+		defer wb.Close()
+
+		require.NoError(t, cache.Set(ctx, "key1", 1))
+		require.NoError(t, wb.Set(ctx, "key2", 2))
+		require.NoError(t, wb.Del(ctx, "key1"))
+
+		value, err := Get[int](ctx, wb, "key2")
+		require.NoError(t, err)
+		assert.Equal(t, 2, value)
+		_, err = Get[int](ctx, wb, "key1")
+		assert.ErrorIs(t, err, ErrCacheMiss)
+
+		// nothing reached the wrapped cache yet
+		_, err = Get[int](ctx, cache, "key2")
+		assert.ErrorIs(t, err, ErrCacheMiss)
+		_, err = Get[int](ctx, cache, "key1")
+		assert.NoError(t, err)
+
+		require.NoError(t, wb.Flush(ctx))
+		value, err = Get[int](ctx, cache, "key2")
+		require.NoError(t, err)
+		assert.Equal(t, 2, value)
+		_, err = Get[int](ctx, cache, "key1")
+		assert.ErrorIs(t, err, ErrCacheMiss)
+	})
+
+	t.Run("flush on interval", func(t *testing.T) {
+		cache := NewTypedLibCache[string, int](libcache.LRU.New(10), time.Minute)
+		wb := NewWriteBehind(cache, WriteBehindOptions{FlushInterval: 10 * time.Millisecond})
+		defer wb.Close()
+
+		require.NoError(t, wb.Set(ctx, "key", 1))
+		require.Eventually(t, func() bool {
+			return cache.Get(ctx, "key", new(int)) == nil
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("full queue blocks writers", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		cache := NewMockTTLCache(ctrl)
+		wb := NewWriteBehind(cache, WriteBehindOptions{QueueSize: 1, FlushInterval: time.Hour})
+
+		unblock := make(chan struct{})
+		cache.EXPECT().Set(gomock.Any(), "key1", 1).DoAndReturn(func(context.Context, any, any) error {
+			<-unblock
+			return nil
+		})
+		cache.EXPECT().Set(gomock.Any(), "key2", 2).Return(nil)
+
+		require.NoError(t, wb.Set(ctx, "key1", 1))
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, wb.Set(timeoutCtx, "key2", 2), context.DeadlineExceeded)
+
+		close(unblock)
+		require.NoError(t, wb.Set(ctx, "key2", 2))
+		require.NoError(t, wb.Close())
+	})
+
+	t.Run("report errors", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		cache := NewMockTTLCache(ctrl)
+		wb := NewWriteBehind(cache, WriteBehindOptions{FlushInterval: time.Hour})
+
+		var gotErr error
+		wb.OnErr = func(err error) {
+			gotErr = err
+		}
+		cache.EXPECT().Set(gomock.Any(), "key", 1).Return(ErrInvalidValue)
+
+		require.NoError(t, wb.Set(ctx, "key", 1))
+		require.NoError(t, wb.Close())
+		require.ErrorIs(t, gotErr, ErrInvalidValue)
+		require.ErrorIs(t, wb.Set(ctx, "key", 1), ErrClosed)
+	})
+
+	t.Run("batched flush", func(t *testing.T) {
+		cache := &countingTTLCache{TypedLibCache: NewTypedLibCache[string, int](libcache.LRU.New(10), time.Minute)}
+		wb := NewWriteBehind(cache, WriteBehindOptions{BatchSize: 3, FlushInterval: time.Hour})
+
+		require.NoError(t, wb.Set(ctx, "key1", 1))
+		require.NoError(t, wb.Set(ctx, "key2", 2))
+		require.NoError(t, wb.Set(ctx, "key3", 3))
+		require.NoError(t, wb.Close())
+
+		assert.Equal(t, 1, cache.batchSets, "the writes are flushed in a single batch")
+		for i, key := range []string{"key1", "key2", "key3"} {
+			value, err := Get[int](ctx, cache, key)
+			require.NoError(t, err)
+			assert.Equal(t, i+1, value)
+		}
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		wb := NewWriteBehind(NewTypedLibCache[string, int](libcache.LRU.New(10), time.Minute), WriteBehindOptions{})
+		defer wb.Close()
+
+		invalid := []string{"not", "comparable"}
+		assert.ErrorIs(t, wb.Set(ctx, invalid, 1), ErrInvalidKey)
+		assert.ErrorIs(t, wb.Get(ctx, invalid, new(int)), ErrInvalidKey)
+		assert.ErrorIs(t, wb.Del(ctx, "key", invalid), ErrInvalidKey)
+	})
+}
+
+type countingTTLCache struct {
+	*TypedLibCache[string, int]
+	batchSets int
+}
+
+func (c *countingTTLCache) BatchSet(ctx context.Context, keyvalues ...any) error {
+	c.batchSets++
+	return c.TypedLibCache.BatchSet(ctx, keyvalues...)
+}
+
+func (c *countingTTLCache) Set(context.Context, any, any) error {
+	return errors.New("should use BatchSet")
+}
+
+type countingCache struct {
+	Cache
+	batchSets int
+}
+
+func (c *countingCache) BatchSet(ctx context.Context, keyvalues ...interface{}) error {
+	c.batchSets++
+	return c.Cache.BatchSet(ctx, keyvalues...)
+}
+
+func (c *countingCache) Set(context.Context, string, []byte) error {
+	return errors.New("should use BatchSet")
+}
+
+func TestWriteBehindByteCache(t *testing.T) {
+	ctx := context.Background()
+
+	mem, err := NewLibcache(0, time.Minute)
+	require.NoError(t, err)
+	cache := &countingCache{Cache: mem}
+	wb := NewWriteBehindByteCache(cache, WriteBehindOptions{BatchSize: 2, FlushInterval: time.Hour})
+
+	require.NoError(t, wb.Set(ctx, "key1", []byte("value1")))
+	require.NoError(t, wb.BatchSet(ctx, "key2", []byte("value2"), "key3", []byte("value3")))
+	require.ErrorIs(t, wb.BatchSet(ctx, "key4", "value4"), ErrInvalidValue)
+
+	values, err := wb.BatchGet(ctx, "key3", "key1", "missing")
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("value3"), []byte("value1"), nil}, values)
+
+	require.NoError(t, wb.Flush(ctx))
+	assert.Equal(t, 2, cache.batchSets, "3 writes with batches of 2")
+
+	value, err := mem.Get(ctx, "key2")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value2"), value)
+
+	require.NoError(t, wb.Del(ctx, "key2"))
+	_, err = wb.Get(ctx, "key2")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+	require.NoError(t, wb.Close())
+}
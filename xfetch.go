@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// XFetchOptions configures the probabilistic early expiration of a ResourceCoalescingCache.
+type XFetchOptions struct {
+	// TTL is the time to live of the entries, 1 minute by default
+	TTL time.Duration
+	// Beta scales how early the entries are recomputed, above 1 favors earlier recomputations, 1 by default
+	Beta float64
+	// Rand returns a random number in [0, 1), rand.Float64 by default
+	Rand func() float64
+}
+
+func (o XFetchOptions) withDefaults() XFetchOptions {
+	if o.TTL <= 0 {
+		o.TTL = time.Minute
+	}
+	if o.Beta <= 0 {
+		o.Beta = 1
+	}
+	if o.Rand == nil {
+		o.Rand = rand.Float64
+	}
+	return o
+}
+
+// XFetchEntry is what a ResourceCoalescingCache in XFetch mode stores in its cache: the value along with
+// the time it took to fetch it and its expiration, so every replica can decide to recompute it early.
+type XFetchEntry[T any] struct {
+	Value T
+	// Delta is how long the fetch of the value took
+	Delta time.Duration
+	// Expiry is when the entry expires
+	Expiry time.Time
+}
+
+// recomputeEarly implements the XFetch decision: the entry is recomputed with a probability growing
+// as it nears its expiry, and growing sooner for the values long to fetch.
+func (e XFetchEntry[T]) recomputeEarly(now time.Time, beta float64, random float64) bool {
+	if e.Expiry.IsZero() {
+		return false
+	}
+	// -log(random) is exponentially distributed, rarely large
+	early := time.Duration(float64(e.Delta) * beta * -math.Log(random))
+	return !now.Add(early).Before(e.Expiry)
+}
+
+// NewXFetchResourceCoalescingCache creates a new ResourceCoalescingCache which recomputes the entries before
+// they expire, with a probability growing as they near their expiry, so the recomputations are spread out over
+// the replicas sharing the cache instead of all happening at the expiry.
+// The cache stores XFetchEntry[T] values, a TypedLibCache must be declared with this value type.
+func NewXFetchResourceCoalescingCache[K comparable, T any](cache TTLCache, opts XFetchOptions) *ResourceCoalescingCache[K, T] {
+	opts = opts.withDefaults()
+	crc := NewResourceCoalescingCache[K, T](cache)
+	crc.xfetch = &opts
+	return crc
+}
+
+// getXFetch returns the cached value unless this call is picked to recompute it early.
+// When the early fetch fails the cached value, still valid, is returned.
+func (crc *ResourceCoalescingCache[K, T]) getXFetch(ctx context.Context, key K, fetch func() (T, error)) (result T, err error) {
+	var entry XFetchEntry[T]
+	if cacheErr := crc.cache.Get(ctx, key, &entry); cacheErr != nil {
+		return crc.coalesce(ctx, key, fetch)
+	}
+	// 1 - rand in (0, 1] so the log is finite
+	if !entry.recomputeEarly(time.Now(), crc.xfetch.Beta, 1-crc.xfetch.Rand()) {
+		return entry.Value, nil
+	}
+
+	crc.cacheMX.RLock()
+	_, inFlight := crc.inFlight[key]
+	crc.cacheMX.RUnlock()
+	if inFlight {
+		// another caller is already recomputing it
+		return entry.Value, nil
+	}
+
+	result, err = crc.coalesce(ctx, key, fetch)
+	if err != nil {
+		if crc.OnErr != nil {
+			crc.OnErr(err)
+		}
+		return entry.Value, nil
+	}
+	return result, nil
+}
+
+// store saves the fetched value, wrapped in an XFetchEntry in XFetch mode.
+func (crc *ResourceCoalescingCache[K, T]) store(ctx context.Context, key K, value T, delta time.Duration) error {
+	if crc.xfetch == nil {
+		return crc.cache.Set(ctx, key, value)
+	}
+	entry := XFetchEntry[T]{
+		Value:  value,
+		Delta:  delta,
+		Expiry: time.Now().Add(crc.xfetch.TTL),
+	}
+	return crc.cache.SetWithTTL(ctx, key, entry, crc.xfetch.TTL)
+}
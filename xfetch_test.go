@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/shaj13/libcache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXFetchEntryRecomputeEarly(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		entry  XFetchEntry[int]
+		random float64
+		want   bool
+	}{
+		{name: "no expiry", entry: XFetchEntry[int]{Delta: time.Hour}, random: 0.01, want: false},
+		{name: "expired", entry: XFetchEntry[int]{Expiry: now.Add(-time.Second)}, random: 1, want: true},
+		{name: "far from expiry", entry: XFetchEntry[int]{Delta: time.Millisecond, Expiry: now.Add(time.Hour)}, random: 0.01, want: false},
+		{name: "near expiry", entry: XFetchEntry[int]{Delta: time.Second, Expiry: now.Add(100 * time.Millisecond)}, random: 0.5, want: true},
+		{name: "near expiry lucky draw", entry: XFetchEntry[int]{Delta: time.Second, Expiry: now.Add(100 * time.Millisecond)}, random: 0.99, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.entry.recomputeEarly(now, 1, tt.random))
+		})
+	}
+
+	t.Run("probability grows near expiry", func(t *testing.T) {
+		r := rand.New(rand.NewSource(1))
+		recomputed := func(remaining time.Duration) int {
+			entry := XFetchEntry[int]{Delta: time.Second, Expiry: now.Add(remaining)}
+			var n int
+			for i := 0; i < 1000; i++ {
+				if entry.recomputeEarly(now, 1, 1-r.Float64()) {
+					n++
+				}
+			}
+			return n
+		}
+		far, near := recomputed(3*time.Second), recomputed(100*time.Millisecond)
+		require.Greater(t, near, far)
+		require.Greater(t, far, 0)
+		require.Less(t, near, 1000)
+	})
+}
+
+func TestXFetchResourceCoalescingCache(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	newRCC := func(random float64) (*TypedLibCache[string, XFetchEntry[int]], *ResourceCoalescingCache[string, int]) {
+		cache := NewTypedLibCache[string, XFetchEntry[int]](libcache.LRU.New(10), 0)
+		rcc := NewXFetchResourceCoalescingCache[string, int](cache, XFetchOptions{
+			TTL:  time.Minute,
+			Rand: func() float64 { return random },
+		})
+		return cache, rcc
+	}
+
+	t.Run("stores the fetch duration and expiry", func(t *testing.T) {
+		cache, rcc := newRCC(0)
+
+		before := time.Now()
+		res, err := rcc.Get(ctx, "key", func() (int, error) {
+			time.Sleep(10 * time.Millisecond)
+			return 42, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 42, res)
+
+		var entry XFetchEntry[int]
+		require.NoError(t, cache.Get(ctx, "key", &entry))
+		require.Equal(t, 42, entry.Value)
+		require.GreaterOrEqual(t, entry.Delta, 10*time.Millisecond)
+		require.WithinDuration(t, before.Add(time.Minute), entry.Expiry, time.Second)
+
+		ttl, err := cache.TTL(ctx, "key")
+		require.NoError(t, err)
+		require.InDelta(t, time.Minute, ttl, float64(time.Second))
+	})
+
+	t.Run("returns the cached value far from expiry", func(t *testing.T) {
+		cache, rcc := newRCC(0.5)
+		require.NoError(t, cache.Set(ctx, "key", XFetchEntry[int]{Value: 1, Delta: time.Millisecond, Expiry: time.Now().Add(time.Hour)}))
+
+		res, err := rcc.Get(ctx, "key", func() (int, error) {
+			return 0, errors.New("should not be called")
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, res)
+	})
+
+	t.Run("recomputes near expiry", func(t *testing.T) {
+		cache, rcc := newRCC(0.5)
+		require.NoError(t, cache.Set(ctx, "key", XFetchEntry[int]{Value: 1, Delta: time.Second, Expiry: time.Now().Add(100 * time.Millisecond)}))
+
+		res, err := rcc.Get(ctx, "key", func() (int, error) {
+			return 2, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 2, res)
+
+		var entry XFetchEntry[int]
+		require.NoError(t, cache.Get(ctx, "key", &entry))
+		require.Equal(t, 2, entry.Value)
+	})
+
+	t.Run("keeps the cached value when the early fetch fails", func(t *testing.T) {
+		cache, rcc := newRCC(0.5)
+		var reported error
+		rcc.OnErr = func(err error) { reported = err }
+		require.NoError(t, cache.Set(ctx, "key", XFetchEntry[int]{Value: 1, Delta: time.Second, Expiry: time.Now().Add(100 * time.Millisecond)}))
+
+		fetchErr := errors.New("backend down")
+		res, err := rcc.Get(ctx, "key", func() (int, error) {
+			return 0, fetchErr
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, res)
+		require.ErrorIs(t, reported, fetchErr)
+	})
+
+	t.Run("returns the fetch error on a miss", func(t *testing.T) {
+		_, rcc := newRCC(0.5)
+
+		fetchErr := errors.New("backend down")
+		_, err := rcc.Get(ctx, "key", func() (int, error) {
+			return 0, fetchErr
+		})
+		require.ErrorIs(t, err, fetchErr)
+	})
+}